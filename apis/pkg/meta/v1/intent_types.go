@@ -0,0 +1,68 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// IntentSpec specifies the configuration of an Intent.
+type IntentSpec struct {
+	// pods define the pod specification used by the controller for LCM/resource allocation
+	Pod *PodSpec `json:"pod,omitempty"`
+
+	MetaSpec `json:",inline"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:storageversion
+
+// An Intent is the description of a Ndd Intent package.
+type Intent struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec IntentSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:storageversion
+
+// An IntentList is the description of a Ndd Intent package.
+type IntentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Intent `json:"items"`
+}
+
+// Hub marks this type as the conversion hub.
+func (p *Intent) Hub() {}
+
+func init() {
+	SchemeBuilder.Register(&Intent{}, &IntentList{})
+}
+
+// Intent type metadata.
+var (
+	IntentKind             = reflect.TypeOf(Intent{}).Name()
+	IntentGroupKind        = schema.GroupKind{Group: Group, Kind: IntentKind}.String()
+	IntentKindAPIVersion   = IntentKind + "." + GroupVersion.String()
+	IntentGroupVersionKind = GroupVersion.WithKind(IntentKind)
+)
@@ -33,16 +33,52 @@ const (
 
 	// A PackageHealthy indicates whether a package is healthy.
 	ConditionKindPackageHealthy nddv1.ConditionKind = "PackageHealthy"
+
+	// A SignatureVerified indicates whether the signature of a package has
+	// been verified.
+	ConditionKindSignatureVerified nddv1.ConditionKind = "SignatureVerified"
+
+	// A Compatible indicates whether a package is compatible with the Ndd
+	// version.
+	ConditionKindCompatible nddv1.ConditionKind = "Compatible"
+
+	// A DependenciesResolved indicates whether the dependencies of the
+	// packages in the Lock have been resolved.
+	ConditionKindDependenciesResolved nddv1.ConditionKind = "DependenciesResolved"
 )
 
 // ConditionReasons a package is or is not installed.
 const (
-	ConditionReasonUnpacking     nddv1.ConditionReason = "UnpackingPackage"
-	ConditionReasonInactive      nddv1.ConditionReason = "InactivePackageRevision"
-	ConditionReasonActive        nddv1.ConditionReason = "ActivePackageRevision"
-	ConditionReasonUnhealthy     nddv1.ConditionReason = "UnhealthyPackageRevision"
-	ConditionReasonHealthy       nddv1.ConditionReason = "HealthyPackageRevision"
-	ConditionReasonUnknownHealth nddv1.ConditionReason = "UnknownPackageRevisionHealth"
+	ConditionReasonUnpacking      nddv1.ConditionReason = "UnpackingPackage"
+	ConditionReasonInactive       nddv1.ConditionReason = "InactivePackageRevision"
+	ConditionReasonActive         nddv1.ConditionReason = "ActivePackageRevision"
+	ConditionReasonCanary         nddv1.ConditionReason = "CanaryPackageRevision"
+	ConditionReasonMaintenance    nddv1.ConditionReason = "AwaitingMaintenanceWindow"
+	ConditionReasonInvalidWindow  nddv1.ConditionReason = "InvalidMaintenanceWindow"
+	ConditionReasonUnhealthy      nddv1.ConditionReason = "UnhealthyPackageRevision"
+	ConditionReasonHealthy        nddv1.ConditionReason = "HealthyPackageRevision"
+	ConditionReasonUnknownHealth  nddv1.ConditionReason = "UnknownPackageRevisionHealth"
+	ConditionReasonBreakingChange nddv1.ConditionReason = "BreakingSchemaChange"
+)
+
+// ConditionReasons a package signature is or is not verified.
+const (
+	ConditionReasonSignatureVerified    nddv1.ConditionReason = "VerifiedSignature"
+	ConditionReasonSignatureUnverified  nddv1.ConditionReason = "UnverifiedSignature"
+	ConditionReasonSignatureNotRequired nddv1.ConditionReason = "SignatureNotRequired"
+)
+
+// ConditionReasons a package is or is not compatible with the Ndd version.
+const (
+	ConditionReasonCompatible   nddv1.ConditionReason = "CompatibleNddVersion"
+	ConditionReasonIncompatible nddv1.ConditionReason = "IncompatibleNddVersion"
+)
+
+// ConditionReasons the dependencies in the Lock are or are not resolved.
+const (
+	ConditionReasonDependenciesResolved   nddv1.ConditionReason = "ResolvedDependencies"
+	ConditionReasonDependenciesUnresolved nddv1.ConditionReason = "UnresolvedDependencies"
+	ConditionReasonDependencyCycle        nddv1.ConditionReason = "DependencyCycle"
 )
 
 // Unpacking indicates that the package manager is waiting for a package
@@ -78,6 +114,41 @@ func Active() nddv1.Condition {
 	}
 }
 
+// Canary indicates that the package manager is running a package revision
+// next to the active revision until it passes its health gates.
+func Canary() nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindPackageInstalled,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonCanary,
+	}
+}
+
+// AwaitingMaintenanceWindow indicates that the package manager is waiting for
+// the package's maintenance window to open before activating a package
+// revision.
+func AwaitingMaintenanceWindow() nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindPackageInstalled,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonMaintenance,
+	}
+}
+
+// InvalidMaintenanceWindow indicates that the package manager cannot activate
+// a package revision because the package's maintenance window is invalid.
+func InvalidMaintenanceWindow(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindPackageInstalled,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonInvalidWindow,
+		Message:            msg,
+	}
+}
+
 // Unhealthy indicates that the current revision is unhealthy.
 func Unhealthy() nddv1.Condition {
 	return nddv1.Condition{
@@ -98,6 +169,75 @@ func Healthy() nddv1.Condition {
 	}
 }
 
+// BreakingSchemaChange indicates that the current revision cannot be installed
+// because it would break the schema of CRDs that are already installed.
+func BreakingSchemaChange(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindPackageHealthy,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonBreakingChange,
+		Message:            msg,
+	}
+}
+
+// SignatureVerified indicates that the package of the current revision carries
+// a signature made by a trusted key.
+func SignatureVerified() nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindSignatureVerified,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonSignatureVerified,
+	}
+}
+
+// SignatureUnverified indicates that the package of the current revision must
+// be signed but does not carry a signature made by a trusted key.
+func SignatureUnverified(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindSignatureVerified,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonSignatureUnverified,
+		Message:            msg,
+	}
+}
+
+// SignatureNotRequired indicates that no verification policy applies to the
+// package of the current revision.
+func SignatureNotRequired() nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindSignatureVerified,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonSignatureNotRequired,
+	}
+}
+
+// Compatible indicates that the package of the current revision is compatible
+// with the Ndd version.
+func Compatible() nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindCompatible,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonCompatible,
+	}
+}
+
+// Incompatible indicates that the package of the current revision requires a
+// Ndd version other than the one that is running.
+func Incompatible(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindCompatible,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonIncompatible,
+		Message:            msg,
+	}
+}
+
 // UnknownHealth indicates that the health of the current revision is unknown.
 func UnknownHealth() nddv1.Condition {
 	return nddv1.Condition{
@@ -107,3 +247,38 @@ func UnknownHealth() nddv1.Condition {
 		Reason:             ConditionReasonUnknownHealth,
 	}
 }
+
+// DependenciesResolved indicates that the dependencies of all packages in the
+// Lock have been resolved.
+func DependenciesResolved() nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindDependenciesResolved,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonDependenciesResolved,
+	}
+}
+
+// DependenciesUnresolved indicates that the dependencies of the packages in
+// the Lock could not be resolved.
+func DependenciesUnresolved(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindDependenciesResolved,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonDependenciesUnresolved,
+		Message:            msg,
+	}
+}
+
+// DependencyCycle indicates that the packages in the Lock depend on each other
+// in a cycle, so no additional packages are installed.
+func DependencyCycle(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindDependenciesResolved,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonDependencyCycle,
+		Message:            msg,
+	}
+}
@@ -59,6 +59,32 @@ var (
 	ProviderRevisionGroupVersionKind = GroupVersion.WithKind(ProviderRevisionKind)
 )
 
+// Intent type metadata.
+var (
+	IntentKind             = reflect.TypeOf(Intent{}).Name()
+	IntentGroupKind        = schema.GroupKind{Group: Group, Kind: IntentKind}.String()
+	IntentKindAPIVersion   = IntentKind + "." + GroupVersion.String()
+	IntentGroupVersionKind = GroupVersion.WithKind(IntentKind)
+)
+
+// IntentRevision type metadata.
+var (
+	IntentRevisionKind             = reflect.TypeOf(IntentRevision{}).Name()
+	IntentRevisionGroupKind        = schema.GroupKind{Group: Group, Kind: IntentRevisionKind}.String()
+	IntentRevisionKindAPIVersion   = IntentRevisionKind + "." + GroupVersion.String()
+	IntentRevisionGroupVersionKind = GroupVersion.WithKind(IntentRevisionKind)
+)
+
+// RevisionGroupVersionKind returns the GroupVersionKind of the supplied
+// package revision. Revisions are usually read without their type metadata,
+// so the kind is derived from the Go type.
+func RevisionGroupVersionKind(pr PackageRevision) schema.GroupVersionKind {
+	if _, ok := pr.(*IntentRevision); ok {
+		return IntentRevisionGroupVersionKind
+	}
+	return ProviderRevisionGroupVersionKind
+}
+
 // Lock type metadata.
 var (
 	LockKind             = reflect.TypeOf(Lock{}).Name()
@@ -66,3 +92,11 @@ var (
 	LockKindAPIVersion   = LockKind + "." + GroupVersion.String()
 	LockGroupVersionKind = GroupVersion.WithKind(LockKind)
 )
+
+// VerificationPolicy type metadata.
+var (
+	VerificationPolicyKind             = reflect.TypeOf(VerificationPolicy{}).Name()
+	VerificationPolicyGroupKind        = schema.GroupKind{Group: Group, Kind: VerificationPolicyKind}.String()
+	VerificationPolicyKindAPIVersion   = VerificationPolicyKind + "." + GroupVersion.String()
+	VerificationPolicyGroupVersionKind = GroupVersion.WithKind(VerificationPolicyKind)
+)
@@ -41,6 +41,9 @@ var (
 	// ManualActivation indicates that a user will manually activate package
 	// revisions.
 	ManualActivation RevisionActivationPolicy = "Manual"
+	// ProgressiveActivation indicates that package revisions should run next
+	// to the active revision and only be activated once they are healthy.
+	ProgressiveActivation RevisionActivationPolicy = "Progressive"
 )
 
 // RefNames converts a slice of LocalObjectReferences to a slice of strings.
@@ -53,6 +56,7 @@ func RefNames(refs []corev1.LocalObjectReference) []string {
 }
 
 var _ Package = &Provider{}
+var _ Package = &Intent{}
 
 // +k8s:deepcopy-gen=false
 type Package interface {
@@ -67,6 +71,12 @@ type Package interface {
 	GetActivationPolicy() *RevisionActivationPolicy
 	SetActivationPolicy(a *RevisionActivationPolicy)
 
+	GetProgressiveActivation() *ProgressiveActivationSpec
+	SetProgressiveActivation(a *ProgressiveActivationSpec)
+
+	GetMaintenanceWindow() *MaintenanceWindow
+	SetMaintenanceWindow(w *MaintenanceWindow)
+
 	GetPackagePullSecrets() []corev1.LocalObjectReference
 	SetPackagePullSecrets(s []corev1.LocalObjectReference)
 
@@ -85,8 +95,20 @@ type Package interface {
 	GetCurrentIdentifier() string
 	SetCurrentIdentifier(r string)
 
+	GetResolvedPackage() string
+	SetResolvedPackage(r string)
+
 	GetSkipDependencyResolution() *bool
 	SetSkipDependencyResolution(*bool)
+
+	GetRollbackPolicy() *RollbackPolicy
+	SetRollbackPolicy(r *RollbackPolicy)
+
+	GetLastHealthyRevision() string
+	SetLastHealthyRevision(r string)
+
+	GetLastRollback() *PackageRollback
+	SetLastRollback(r *PackageRollback)
 }
 
 // GetCondition of this Provider.
@@ -124,6 +146,26 @@ func (p *Provider) SetActivationPolicy(a *RevisionActivationPolicy) {
 	p.Spec.RevisionActivationPolicy = a
 }
 
+// GetProgressiveActivation of this Provider.
+func (p *Provider) GetProgressiveActivation() *ProgressiveActivationSpec {
+	return p.Spec.ProgressiveActivation
+}
+
+// SetProgressiveActivation of this Provider.
+func (p *Provider) SetProgressiveActivation(a *ProgressiveActivationSpec) {
+	p.Spec.ProgressiveActivation = a
+}
+
+// GetMaintenanceWindow of this Provider.
+func (p *Provider) GetMaintenanceWindow() *MaintenanceWindow {
+	return p.Spec.MaintenanceWindow
+}
+
+// SetMaintenanceWindow of this Provider.
+func (p *Provider) SetMaintenanceWindow(w *MaintenanceWindow) {
+	p.Spec.MaintenanceWindow = w
+}
+
 // GetPackagePullSecrets of this Provider.
 func (p *Provider) GetPackagePullSecrets() []corev1.LocalObjectReference {
 	return p.Spec.PackagePullSecrets
@@ -194,7 +236,213 @@ func (p *Provider) SetCurrentIdentifier(s string) {
 	p.Status.CurrentIdentifier = s
 }
 
+// GetResolvedPackage of this Provider.
+func (p *Provider) GetResolvedPackage() string {
+	return p.Status.ResolvedPackage
+}
+
+// SetResolvedPackage of this Provider.
+func (p *Provider) SetResolvedPackage(s string) {
+	p.Status.ResolvedPackage = s
+}
+
+// GetRollbackPolicy of this Provider.
+func (p *Provider) GetRollbackPolicy() *RollbackPolicy {
+	return p.Spec.RollbackPolicy
+}
+
+// SetRollbackPolicy of this Provider.
+func (p *Provider) SetRollbackPolicy(r *RollbackPolicy) {
+	p.Spec.RollbackPolicy = r
+}
+
+// GetLastHealthyRevision of this Provider.
+func (p *Provider) GetLastHealthyRevision() string {
+	return p.Status.LastHealthyRevision
+}
+
+// SetLastHealthyRevision of this Provider.
+func (p *Provider) SetLastHealthyRevision(r string) {
+	p.Status.LastHealthyRevision = r
+}
+
+// GetLastRollback of this Provider.
+func (p *Provider) GetLastRollback() *PackageRollback {
+	return p.Status.LastRollback
+}
+
+// SetLastRollback of this Provider.
+func (p *Provider) SetLastRollback(r *PackageRollback) {
+	p.Status.LastRollback = r
+}
+
+// GetCondition of this Intent.
+func (p *Intent) GetCondition(ct nddv1.ConditionKind) nddv1.Condition {
+	return p.Status.GetCondition(ct)
+}
+
+// SetConditions of this Intent.
+func (p *Intent) SetConditions(c ...nddv1.Condition) {
+	p.Status.SetConditions(c...)
+}
+
+// GetSource of this Intent.
+func (p *Intent) GetSource() string {
+	return p.Spec.Package
+}
+
+// SetSource of this Intent.
+func (p *Intent) SetSource(s string) {
+	p.Spec.Package = s
+}
+
+// GetKind of this Intent.
+func (p *Intent) GetKind() Kind {
+	return p.Spec.Kind
+}
+
+// GetActivationPolicy of this Intent.
+func (p *Intent) GetActivationPolicy() *RevisionActivationPolicy {
+	return p.Spec.RevisionActivationPolicy
+}
+
+// SetActivationPolicy of this Intent.
+func (p *Intent) SetActivationPolicy(a *RevisionActivationPolicy) {
+	p.Spec.RevisionActivationPolicy = a
+}
+
+// GetProgressiveActivation of this Intent.
+func (p *Intent) GetProgressiveActivation() *ProgressiveActivationSpec {
+	return p.Spec.ProgressiveActivation
+}
+
+// SetProgressiveActivation of this Intent.
+func (p *Intent) SetProgressiveActivation(a *ProgressiveActivationSpec) {
+	p.Spec.ProgressiveActivation = a
+}
+
+// GetMaintenanceWindow of this Intent.
+func (p *Intent) GetMaintenanceWindow() *MaintenanceWindow {
+	return p.Spec.MaintenanceWindow
+}
+
+// SetMaintenanceWindow of this Intent.
+func (p *Intent) SetMaintenanceWindow(w *MaintenanceWindow) {
+	p.Spec.MaintenanceWindow = w
+}
+
+// GetPackagePullSecrets of this Intent.
+func (p *Intent) GetPackagePullSecrets() []corev1.LocalObjectReference {
+	return p.Spec.PackagePullSecrets
+}
+
+// SetPackagePullSecrets of this Intent.
+func (p *Intent) SetPackagePullSecrets(s []corev1.LocalObjectReference) {
+	p.Spec.PackagePullSecrets = s
+}
+
+// GetPackagePullPolicy of this Intent.
+func (p *Intent) GetPackagePullPolicy() *corev1.PullPolicy {
+	return p.Spec.PackagePullPolicy
+}
+
+// SetPackagePullPolicy of this Intent.
+func (p *Intent) SetPackagePullPolicy(i *corev1.PullPolicy) {
+	p.Spec.PackagePullPolicy = i
+}
+
+// GetRevisionHistoryLimit of this Intent.
+func (p *Intent) GetRevisionHistoryLimit() *int64 {
+	return p.Spec.RevisionHistoryLimit
+}
+
+// SetRevisionHistoryLimit of this Intent.
+func (p *Intent) SetRevisionHistoryLimit(l *int64) {
+	p.Spec.RevisionHistoryLimit = l
+}
+
+// GetControllerRef of this Intent.
+func (p *Intent) GetControllerRef() *nddv1.Reference {
+	return p.Spec.ControllerReference
+}
+
+// SetControllerRef of this Intent.
+func (p *Intent) SetControllerRef(r *nddv1.Reference) {
+	p.Spec.ControllerReference = r
+}
+
+// GetCurrentRevision of this Intent.
+func (p *Intent) GetCurrentRevision() string {
+	return p.Status.CurrentRevision
+}
+
+// SetCurrentRevision of this Intent.
+func (p *Intent) SetCurrentRevision(s string) {
+	p.Status.CurrentRevision = s
+}
+
+// GetSkipDependencyResolution of this Intent.
+func (p *Intent) GetSkipDependencyResolution() *bool {
+	return p.Spec.SkipDependencyResolution
+}
+
+// SetSkipDependencyResolution of this Intent.
+func (p *Intent) SetSkipDependencyResolution(b *bool) {
+	p.Spec.SkipDependencyResolution = b
+}
+
+// GetCurrentIdentifier of this Intent.
+func (p *Intent) GetCurrentIdentifier() string {
+	return p.Status.CurrentIdentifier
+}
+
+// SetCurrentIdentifier of this Intent.
+func (p *Intent) SetCurrentIdentifier(s string) {
+	p.Status.CurrentIdentifier = s
+}
+
+// GetResolvedPackage of this Intent.
+func (p *Intent) GetResolvedPackage() string {
+	return p.Status.ResolvedPackage
+}
+
+// SetResolvedPackage of this Intent.
+func (p *Intent) SetResolvedPackage(s string) {
+	p.Status.ResolvedPackage = s
+}
+
+// GetRollbackPolicy of this Intent.
+func (p *Intent) GetRollbackPolicy() *RollbackPolicy {
+	return p.Spec.RollbackPolicy
+}
+
+// SetRollbackPolicy of this Intent.
+func (p *Intent) SetRollbackPolicy(r *RollbackPolicy) {
+	p.Spec.RollbackPolicy = r
+}
+
+// GetLastHealthyRevision of this Intent.
+func (p *Intent) GetLastHealthyRevision() string {
+	return p.Status.LastHealthyRevision
+}
+
+// SetLastHealthyRevision of this Intent.
+func (p *Intent) SetLastHealthyRevision(r string) {
+	p.Status.LastHealthyRevision = r
+}
+
+// GetLastRollback of this Intent.
+func (p *Intent) GetLastRollback() *PackageRollback {
+	return p.Status.LastRollback
+}
+
+// SetLastRollback of this Intent.
+func (p *Intent) SetLastRollback(r *PackageRollback) {
+	p.Status.LastRollback = r
+}
+
 var _ PackageRevision = &ProviderRevision{}
+var _ PackageRevision = &IntentRevision{}
 
 // PackageRevision is the interface satisfied by package revision types.
 // +k8s:deepcopy-gen=false
@@ -226,13 +474,23 @@ type PackageRevision interface {
 	GetRevision() int64
 	SetRevision(r int64)
 
+	GetCanaryReplicas() *int32
+	SetCanaryReplicas(r *int32)
+
 	GetSkipDependencyResolution() *bool
 	SetSkipDependencyResolution(*bool)
 
 	GetDependencyStatus() (found, installed, invalid int64)
 	SetDependencyStatus(found, installed, invalid int64)
 
+	GetDependencies() []DependencyStatus
+	SetDependencies(d []DependencyStatus)
+
 	GetPermissionsRequests() []rbacv1.PolicyRule
+	SetPermissionsRequests(r []rbacv1.PolicyRule)
+
+	GetDiff() *RevisionDiff
+	SetDiff(d *RevisionDiff)
 
 	GetRevName() string
 
@@ -263,6 +521,21 @@ func (p *ProviderRevision) GetPermissionsRequests() []rbacv1.PolicyRule {
 	return p.Status.PermissionRequests
 }
 
+// SetPermissionsRequests of this ProviderRevision.
+func (p *ProviderRevision) SetPermissionsRequests(r []rbacv1.PolicyRule) {
+	p.Status.PermissionRequests = r
+}
+
+// GetDiff of this ProviderRevision.
+func (p *ProviderRevision) GetDiff() *RevisionDiff {
+	return p.Status.Diff
+}
+
+// SetDiff of this ProviderRevision.
+func (p *ProviderRevision) SetDiff(d *RevisionDiff) {
+	p.Status.Diff = d
+}
+
 // GetCondition of this ProviderRevision.
 func (p *ProviderRevision) GetCondition(ct nddv1.ConditionKind) nddv1.Condition {
 	return p.Status.GetCondition(ct)
@@ -343,6 +616,16 @@ func (p *ProviderRevision) SetRevision(r int64) {
 	p.Spec.Revision = r
 }
 
+// GetCanaryReplicas of this ProviderRevision.
+func (p *ProviderRevision) GetCanaryReplicas() *int32 {
+	return p.Spec.CanaryReplicas
+}
+
+// SetCanaryReplicas of this ProviderRevision.
+func (p *ProviderRevision) SetCanaryReplicas(r *int32) {
+	p.Spec.CanaryReplicas = r
+}
+
 // GetDependencyStatus of this ProviderRevision.
 func (p *ProviderRevision) GetDependencyStatus() (found, installed, invalid int64) {
 	return p.Status.FoundDependencies, p.Status.InstalledDependencies, p.Status.InvalidDependencies
@@ -355,6 +638,16 @@ func (p *ProviderRevision) SetDependencyStatus(found, installed, invalid int64)
 	p.Status.InvalidDependencies = invalid
 }
 
+// GetDependencies of this ProviderRevision.
+func (p *ProviderRevision) GetDependencies() []DependencyStatus {
+	return p.Status.Dependencies
+}
+
+// SetDependencies of this ProviderRevision.
+func (p *ProviderRevision) SetDependencies(d []DependencyStatus) {
+	p.Status.Dependencies = d
+}
+
 // GetControllerRef of this ProviderRevision.
 func (p *ProviderRevision) GetControllerRef() *nddv1.Reference {
 	return p.Spec.ControllerReference
@@ -375,7 +668,176 @@ func (p *ProviderRevision) SetSkipDependencyResolution(b *bool) {
 	p.Spec.SkipDependencyResolution = b
 }
 
+func (p *IntentRevision) GetKind() string {
+	return p.Kind
+}
+
+func (p *IntentRevision) GetRevisionKind() Kind {
+	return p.Spec.Kind
+}
+
+func (p *IntentRevision) SetRevisionKind(k Kind) {
+	p.Spec.Kind = k
+}
+
+func (p *IntentRevision) GetRevName() string {
+	return p.GetName()
+}
+
+// GetPermissions of this IntentRevision.
+func (p *IntentRevision) GetPermissionsRequests() []rbacv1.PolicyRule {
+	return p.Status.PermissionRequests
+}
+
+// SetPermissionsRequests of this IntentRevision.
+func (p *IntentRevision) SetPermissionsRequests(r []rbacv1.PolicyRule) {
+	p.Status.PermissionRequests = r
+}
+
+// GetDiff of this IntentRevision.
+func (p *IntentRevision) GetDiff() *RevisionDiff {
+	return p.Status.Diff
+}
+
+// SetDiff of this IntentRevision.
+func (p *IntentRevision) SetDiff(d *RevisionDiff) {
+	p.Status.Diff = d
+}
+
+// GetCondition of this IntentRevision.
+func (p *IntentRevision) GetCondition(ct nddv1.ConditionKind) nddv1.Condition {
+	return p.Status.GetCondition(ct)
+}
+
+// SetConditions of this IntentRevision.
+func (p *IntentRevision) SetConditions(c ...nddv1.Condition) {
+	p.Status.SetConditions(c...)
+}
+
+// GetObjects of this IntentRevision.
+func (p *IntentRevision) GetObjects() []nddv1.TypedReference {
+	return p.Status.ObjectRefs
+}
+
+// SetObjects of this IntentRevision.
+func (p *IntentRevision) SetObjects(c []nddv1.TypedReference) {
+	p.Status.ObjectRefs = c
+}
+
+// GetControllerReference of this IntentRevision.
+func (p *IntentRevision) GetControllerReference() nddv1.Reference {
+	return p.Status.ControllerRef
+}
+
+// SetControllerReference of this IntentRevision.
+func (p *IntentRevision) SetControllerReference(c nddv1.Reference) {
+	p.Status.ControllerRef = c
+}
+
+// GetSource of this IntentRevision.
+func (p *IntentRevision) GetSource() string {
+	return p.Spec.PackageImage
+}
+
+// SetSource of this IntentRevision.
+func (p *IntentRevision) SetSource(s string) {
+	p.Spec.PackageImage = s
+}
+
+// GetPackagePullSecrets of this IntentRevision.
+func (p *IntentRevision) GetPackagePullSecrets() []corev1.LocalObjectReference {
+	return p.Spec.PackagePullSecrets
+}
+
+// SetPackagePullSecrets of this IntentRevision.
+func (p *IntentRevision) SetPackagePullSecrets(s []corev1.LocalObjectReference) {
+	p.Spec.PackagePullSecrets = s
+}
+
+// GetPackagePullPolicy of this IntentRevision.
+func (p *IntentRevision) GetPackagePullPolicy() *corev1.PullPolicy {
+	return p.Spec.PackagePullPolicy
+}
+
+// SetPackagePullPolicy of this IntentRevision.
+func (p *IntentRevision) SetPackagePullPolicy(i *corev1.PullPolicy) {
+	p.Spec.PackagePullPolicy = i
+}
+
+// GetDesiredState of this IntentRevision.
+func (p *IntentRevision) GetDesiredState() PackageRevisionDesiredState {
+	return p.Spec.DesiredState
+}
+
+// SetDesiredState of this IntentRevision.
+func (p *IntentRevision) SetDesiredState(s PackageRevisionDesiredState) {
+	p.Spec.DesiredState = s
+}
+
+// GetRevision of this IntentRevision.
+func (p *IntentRevision) GetRevision() int64 {
+	return p.Spec.Revision
+}
+
+// SetRevision of this IntentRevision.
+func (p *IntentRevision) SetRevision(r int64) {
+	p.Spec.Revision = r
+}
+
+// GetCanaryReplicas of this IntentRevision.
+func (p *IntentRevision) GetCanaryReplicas() *int32 {
+	return p.Spec.CanaryReplicas
+}
+
+// SetCanaryReplicas of this IntentRevision.
+func (p *IntentRevision) SetCanaryReplicas(r *int32) {
+	p.Spec.CanaryReplicas = r
+}
+
+// GetDependencyStatus of this IntentRevision.
+func (p *IntentRevision) GetDependencyStatus() (found, installed, invalid int64) {
+	return p.Status.FoundDependencies, p.Status.InstalledDependencies, p.Status.InvalidDependencies
+}
+
+// SetDependencyStatus of this IntentRevision.
+func (p *IntentRevision) SetDependencyStatus(found, installed, invalid int64) {
+	p.Status.FoundDependencies = found
+	p.Status.InstalledDependencies = installed
+	p.Status.InvalidDependencies = invalid
+}
+
+// GetDependencies of this IntentRevision.
+func (p *IntentRevision) GetDependencies() []DependencyStatus {
+	return p.Status.Dependencies
+}
+
+// SetDependencies of this IntentRevision.
+func (p *IntentRevision) SetDependencies(d []DependencyStatus) {
+	p.Status.Dependencies = d
+}
+
+// GetControllerRef of this IntentRevision.
+func (p *IntentRevision) GetControllerRef() *nddv1.Reference {
+	return p.Spec.ControllerReference
+}
+
+// SetControllerRef of this IntentRevision.
+func (p *IntentRevision) SetControllerRef(r *nddv1.Reference) {
+	p.Spec.ControllerReference = r
+}
+
+// GetSkipDependencyResolution of this IntentRevision.
+func (p *IntentRevision) GetSkipDependencyResolution() *bool {
+	return p.Spec.SkipDependencyResolution
+}
+
+// SetSkipDependencyResolution of this IntentRevision.
+func (p *IntentRevision) SetSkipDependencyResolution(b *bool) {
+	p.Spec.SkipDependencyResolution = b
+}
+
 var _ PackageRevisionList = &ProviderRevisionList{}
+var _ PackageRevisionList = &IntentRevisionList{}
 
 // PackageRevisionList is the interface satisfied by package revision list
 // types.
@@ -401,6 +863,26 @@ func (p *ProviderRevisionList) GetRevisions() []PackageRevision {
 	return prs
 }
 
+// GetRevisions of this IntentRevisionList.
+func (p *IntentRevisionList) GetRevisions() []PackageRevision {
+	prs := make([]PackageRevision, len(p.Items))
+	for i, r := range p.Items {
+		r := r // Pin range variable so we can take its address.
+		prs[i] = &r
+	}
+	return prs
+}
+
+// GetCondition of this Lock.
+func (l *Lock) GetCondition(ct nddv1.ConditionKind) nddv1.Condition {
+	return l.Status.GetCondition(ct)
+}
+
+// SetConditions of this Lock.
+func (l *Lock) SetConditions(c ...nddv1.Condition) {
+	l.Status.SetConditions(c...)
+}
+
 var _ dag.Node = &pkgmetav1.Dependency{}
 var _ dag.Node = &LockPackage{}
 
@@ -5,3 +5,28 @@ const (
 	CompositeProviderNameLabelKey     = Group + "/" + "composite-provider-name"
 	CompositeProviderNamespceLabelKey = Group + "/" + "composite-provider-namespace"
 )
+
+const (
+	// AllowBreakingChangesAnnotation on a package revision allows it to
+	// replace installed CRDs even if that removes served or stored versions or
+	// required properties. Its value must be "true".
+	AllowBreakingChangesAnnotation = Group + "/" + "allow-breaking-changes"
+
+	// KeepAnnotation on a dependency package created by the resolver prevents
+	// it from being removed once no installed package depends on it anymore.
+	// Its value must be "true".
+	KeepAnnotation = Group + "/" + "keep"
+
+	// DependencySourceAnnotation records the package source a dependency
+	// package was created for by the resolver.
+	DependencySourceAnnotation = Group + "/" + "dependency-source"
+
+	// UnreferencedSinceAnnotation records since when no installed package
+	// depends on a dependency package created by the resolver.
+	UnreferencedSinceAnnotation = Group + "/" + "unreferenced-since"
+
+	// CanarySinceAnnotation records when a package revision became a canary,
+	// so that health reported before that time does not count towards its
+	// health gates.
+	CanarySinceAnnotation = Group + "/" + "canary-since"
+)
@@ -18,6 +18,7 @@ package v1
 
 import (
 	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -40,12 +41,18 @@ type LockPackage struct {
 	Dependencies []pkgmetav1.Dependency `json:"dependencies"`
 }
 
+// LockStatus represents the status of the Lock.
+type LockStatus struct {
+	nddv1.ConditionedStatus `json:",inline"`
+}
+
 // +kubebuilder:object:root=true
 // +genclient
 // +genclient:nonNamespaced
 
 // LockSpec is the CRD type that tracks package dependencies.
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="RESOLVED",type="string",JSONPath=".status.conditions[?(@.kind=='DependenciesResolved')].status"
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:resource:scope=Cluster,categories={ndd,pkg},shortName=lock
 type Lock struct {
@@ -53,6 +60,7 @@ type Lock struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Packages []LockPackage `json:"packages,omitempty"`
+	Status   LockStatus    `json:"status,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -18,6 +18,7 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // PackageSpec defines the desired state of Package
@@ -30,15 +31,32 @@ type PackageSpec struct {
 	Kind Kind `json:"kind,omitempty"`
 
 	// Package is the name of the image of the package that is being requested.
+	// Instead of a tag or digest, the image may carry a semantic version
+	// constraint, e.g. registry/provider:~1.4, in which case the highest
+	// matching version tag is used. Such a package cannot have a pull policy
+	// of Never.
 	Package string `json:"package"`
 
 	// RevisionActivationPolicy specifies how the package controller should
-	// update from one revision to the next. Options are Automatic or Manual.
-	// Default is Automatic.
+	// update from one revision to the next. Options are Automatic, Manual or
+	// Progressive. Default is Automatic.
 	// +optional
 	// +kubebuilder:default=Automatic
 	RevisionActivationPolicy *RevisionActivationPolicy `json:"revisionActivationPolicy,omitempty"`
 
+	// ProgressiveActivation configures how a new revision is brought up next
+	// to the active revision when the revision activation policy is
+	// Progressive.
+	// +optional
+	ProgressiveActivation *ProgressiveActivationSpec `json:"progressiveActivation,omitempty"`
+
+	// MaintenanceWindow restricts when the package controller activates a new
+	// revision. Outside the window new revisions are created inactive and
+	// activated once the window opens. A package without an active revision
+	// is always activated immediately.
+	// +optional
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+
 	// RevisionHistoryLimit dictates how the package controller cleans up old
 	// inactive package revisions.
 	// Defaults to 1. Can be disabled by explicitly setting to 0.
@@ -64,6 +82,73 @@ type PackageSpec struct {
 	// +optional
 	// +kubebuilder:default=false
 	SkipDependencyResolution *bool `json:"skipDependencyResolution,omitempty"`
+
+	// RollbackPolicy specifies whether the package controller should
+	// reactivate the most recent previously healthy revision when the active
+	// revision becomes unhealthy, or refuses to be activated. Rollback is
+	// disabled when unset.
+	// +optional
+	RollbackPolicy *RollbackPolicy `json:"rollbackPolicy,omitempty"`
+}
+
+// ProgressiveActivationSpec specifies how a new package revision is run next to
+// the active revision before it is activated.
+type ProgressiveActivationSpec struct {
+	// Replicas is the number of controller replicas the new revision runs
+	// while the previous revision is still active.
+	// Default is 1.
+	// +optional
+	// +kubebuilder:default=1
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// HealthGatePeriod is the duration the new revision must report healthy
+	// without interruption before it is activated and the previous revision
+	// is deactivated. A revision reports unhealthy whenever its pods are not
+	// ready or a warning event is reported for its controller or pods.
+	// Default is 5m.
+	// +optional
+	// +kubebuilder:default="5m"
+	HealthGatePeriod *metav1.Duration `json:"healthGatePeriod,omitempty"`
+}
+
+// MaintenanceWindow specifies a recurring window in which new package
+// revisions may be activated.
+type MaintenanceWindow struct {
+	// Schedule is a cron expression, in UTC, at which the window opens. It
+	// uses the standard five fields: minute, hour, day of month, month and
+	// day of week, e.g. "0 2 * * 6" for every Saturday at 02:00.
+	// +kubebuilder:validation:Pattern=`^\S+(\s+\S+){4}$`
+	Schedule string `json:"schedule"`
+
+	// Duration is how long the window stays open after it opens.
+	Duration metav1.Duration `json:"duration"`
+}
+
+// RollbackPolicy specifies how the package controller rolls back from an
+// unhealthy package revision.
+type RollbackPolicy struct {
+	// FailureWindow is the duration the active revision must remain unhealthy
+	// before the package controller rolls back to the last healthy revision.
+	// Default is 5m.
+	// +optional
+	// +kubebuilder:default="5m"
+	FailureWindow *metav1.Duration `json:"failureWindow,omitempty"`
+}
+
+// PackageRollback records a rollback from one package revision to another.
+type PackageRollback struct {
+	// FromRevision is the name of the unhealthy revision that was deactivated.
+	FromRevision string `json:"fromRevision"`
+
+	// ToRevision is the name of the previously healthy revision that was
+	// reactivated.
+	ToRevision string `json:"toRevision"`
+
+	// Reason describes why the rollback was performed.
+	Reason string `json:"reason,omitempty"`
+
+	// Time at which the rollback was performed.
+	Time metav1.Time `json:"time,omitempty"`
 }
 
 // PackageStatus defines the observed state of Package
@@ -80,4 +165,18 @@ type PackageStatus struct {
 	// will cause the package manager to check that the current revision is
 	// correct for the given package source.
 	CurrentIdentifier string `json:"currentIdentifier,omitempty"`
+
+	// ResolvedPackage is the package image that the package source resolved
+	// to when the source carries a semantic version constraint.
+	ResolvedPackage string `json:"resolvedPackage,omitempty"`
+
+	// LastHealthyRevision is the name of the most recent package revision that
+	// was reported healthy while active. It is used as the rollback target
+	// when a rollback policy is configured.
+	LastHealthyRevision string `json:"lastHealthyRevision,omitempty"`
+
+	// LastRollback records the most recent rollback performed by the package
+	// controller. While the package source keeps resolving to the revision
+	// that was rolled back from, the rollback target stays active.
+	LastRollback *PackageRollback `json:"lastRollback,omitempty"`
 }
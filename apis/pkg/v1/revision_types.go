@@ -31,6 +31,10 @@ const (
 
 	// PackageRevisionInactive is an inactive package revision.
 	PackageRevisionInactive PackageRevisionDesiredState = "Inactive"
+
+	// PackageRevisionCanary is a package revision that runs its controller
+	// next to the active revision without taking control of its objects.
+	PackageRevisionCanary PackageRevisionDesiredState = "Canary"
 )
 
 // PackageRevisionSpec defines the desired state of Revision
@@ -44,7 +48,7 @@ type PackageRevisionSpec struct {
 	// +kubebuilder:validation:Enum=`worker`;`reconciler`
 	Kind Kind `json:"kind,omitempty"`
 
-	// DesiredState of the PackageRevision. Can be either Active or Inactive.
+	// DesiredState of the PackageRevision. Can be Active, Inactive or Canary.
 	DesiredState PackageRevisionDesiredState `json:"desiredState"`
 
 	// Package image used by install Pod to extract package contents.
@@ -64,6 +68,11 @@ type PackageRevisionSpec struct {
 	// +kubebuilder:default=IfNotPresent
 	PackagePullPolicy *corev1.PullPolicy `json:"packagePullPolicy,omitempty"`
 
+	// CanaryReplicas is the number of controller replicas the revision runs
+	// while its desired state is Canary.
+	// +optional
+	CanaryReplicas *int32 `json:"canaryReplicas,omitempty"`
+
 	// Revision number. Indicates when the revision will be garbage collected
 	// based on the parent's RevisionHistoryLimit.
 	Revision int64 `json:"revision"`
@@ -77,6 +86,111 @@ type PackageRevisionSpec struct {
 	SkipDependencyResolution *bool `json:"skipDependencyResolution,omitempty"`
 }
 
+// A RevisionDiff summarizes the changes between a package revision and the
+// previously active revision of the same package.
+type RevisionDiff struct {
+	// PreviousRevision is the name of the revision the diff was computed
+	// against.
+	PreviousRevision string `json:"previousRevision"`
+
+	// AddedCRDs are the CRDs that are only installed by this revision.
+	// +optional
+	AddedCRDs []string `json:"addedCRDs,omitempty"`
+
+	// RemovedCRDs are the CRDs that are no longer installed by this revision.
+	// +optional
+	RemovedCRDs []string `json:"removedCRDs,omitempty"`
+
+	// ChangedCRDs are the CRDs whose schema differs from the previous
+	// revision.
+	// +optional
+	ChangedCRDs []string `json:"changedCRDs,omitempty"`
+
+	// AddedPermissionRequests are the permissions only requested by this
+	// revision.
+	// +optional
+	AddedPermissionRequests []rbacv1.PolicyRule `json:"addedPermissionRequests,omitempty"`
+
+	// RemovedPermissionRequests are the permissions no longer requested by
+	// this revision.
+	// +optional
+	RemovedPermissionRequests []rbacv1.PolicyRule `json:"removedPermissionRequests,omitempty"`
+
+	// Containers are the controller containers whose image or args differ
+	// from the previous revision.
+	// +optional
+	Containers []ContainerDiff `json:"containers,omitempty"`
+}
+
+// A ContainerDiff describes how a controller container changed between two
+// package revisions. Fields of a container that was added or removed are left
+// empty for the revision that does not have it.
+type ContainerDiff struct {
+	// Name of the container.
+	Name string `json:"name"`
+
+	// PreviousImage is the image of the container in the previous revision.
+	// +optional
+	PreviousImage string `json:"previousImage,omitempty"`
+
+	// Image is the image of the container in this revision.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// PreviousArgs are the args of the container in the previous revision.
+	// +optional
+	PreviousArgs []string `json:"previousArgs,omitempty"`
+
+	// Args are the args of the container in this revision.
+	// +optional
+	Args []string `json:"args,omitempty"`
+}
+
+// A DependencyState is the state of a dependency of a package revision.
+type DependencyState string
+
+// Dependency states.
+const (
+	// DependencySatisfied indicates that the dependency is installed at a
+	// version that satisfies the constraint.
+	DependencySatisfied DependencyState = "Satisfied"
+
+	// DependencyMissing indicates that the dependency is not installed yet.
+	DependencyMissing DependencyState = "Missing"
+
+	// DependencyUnsatisfied indicates that the dependency is installed at a
+	// version that does not satisfy the constraint.
+	DependencyUnsatisfied DependencyState = "Unsatisfied"
+
+	// DependencyInvalid indicates that the constraint or the installed
+	// version of the dependency is not a valid semantic version.
+	DependencyInvalid DependencyState = "Invalid"
+)
+
+// DependencyStatus is the observed state of a dependency of a package
+// revision.
+type DependencyStatus struct {
+	// Package is the OCI image name of the dependency without a tag or
+	// digest.
+	Package string `json:"package"`
+
+	// Constraints is the semantic version constraint the package revision
+	// places on the dependency.
+	// +optional
+	Constraints string `json:"constraints,omitempty"`
+
+	// Version is the version of the dependency that is installed.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// State of the dependency.
+	State DependencyState `json:"state"`
+
+	// Reason explains the state of the dependency.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
 // PackageRevisionStatus defines the observed state of a PackageRevision
 type PackageRevisionStatus struct {
 	nddv1.ConditionedStatus `json:",inline"`
@@ -90,10 +204,19 @@ type PackageRevisionStatus struct {
 	InstalledDependencies int64 `json:"installedDependencies,omitempty"`
 	InvalidDependencies   int64 `json:"invalidDependencies,omitempty"`
 
+	// Dependencies is the state of each direct dependency of this revision.
+	// +optional
+	Dependencies []DependencyStatus `json:"dependencies,omitempty"`
+
 	// PermissionRequests made by this package. The package declares that its
 	// controller needs these permissions to run. The RBAC manager is
 	// responsible for granting them.
 	PermissionRequests []rbacv1.PolicyRule `json:"permissionRequests,omitempty"`
+
+	// Diff summarizes the changes this revision introduces with respect to
+	// the revision that was active when it was created.
+	// +optional
+	Diff *RevisionDiff `json:"diff,omitempty"`
 	// Api CRDs used by this package.
 	//Apis []pkgmetav1.Api `json:"apis,omitempty"`
 	// Pods used by this package in the Controller
@@ -0,0 +1,71 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VerificationRule lists the public keys that are trusted to sign the packages
+// of a repository.
+type VerificationRule struct {
+	// Repository is the OCI image name without a tag or digest the rule applies
+	// to, e.g. registry.example.com/org/provider. A trailing /* applies the
+	// rule to all repositories below the prefix, and * applies it to all
+	// packages.
+	Repository string `json:"repository"`
+
+	// PublicKeys are the PEM encoded public keys trusted to sign packages of
+	// the repository. A package signed by any of them is verified.
+	// +kubebuilder:validation:MinItems=1
+	PublicKeys []string `json:"publicKeys"`
+}
+
+// VerificationPolicySpec specifies which packages must be signed and by whom.
+type VerificationPolicySpec struct {
+	// Rules apply to the packages of the repositories they match. A package
+	// that matches at least one rule must carry a signature made by a key of
+	// one of the matching rules before it is installed.
+	Rules []VerificationRule `json:"rules"`
+}
+
+// +kubebuilder:object:root=true
+// +genclient
+// +genclient:nonNamespaced
+
+// A VerificationPolicy lists the public keys trusted to sign packages.
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:resource:scope=Cluster,categories={ndd,pkg}
+type VerificationPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec VerificationPolicySpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// VerificationPolicyList contains a list of VerificationPolicy.
+type VerificationPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VerificationPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VerificationPolicy{}, &VerificationPolicyList{})
+}
@@ -18,10 +18,14 @@ package corecmd
 
 import (
 	"os"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -29,6 +33,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"github.com/yndd/ndd-core/internal/controllers/pkg"
+	"github.com/yndd/ndd-core/internal/controllers/pkg/manager"
+	"github.com/yndd/ndd-core/internal/controllers/pkg/resolver"
+	"github.com/yndd/ndd-core/internal/controllers/pkg/revision"
 	"github.com/yndd/ndd-core/internal/nddpkg"
 	"github.com/yndd/ndd-runtime/pkg/logging"
 	//+kubebuilder:scaffold:imports
@@ -41,6 +48,22 @@ var (
 	concurrency          int
 	namespace            string
 	cacheDir             string
+	cacheMaxSize         string
+	cacheGCInterval      time.Duration
+	dependencySettings   string
+	uploadAddr           string
+	uploadMaxSize        string
+	uploadTokenFile      string
+	registryConfig       string
+	caBundles            []string
+	insecureRegistries   []string
+	registryQPS          float64
+	registryBurst        int
+	registryMaxRetries   int
+	webhookAddr          string
+	webhookSecretFile    string
+	webhookInsecure      bool
+	webhookPollInterval  time.Duration
 )
 
 // startCmd represents the start command for the network device driver
@@ -69,13 +92,98 @@ var startCmd = &cobra.Command{
 			return errors.Wrap(err, "Cannot create manager")
 		}
 
-		pkgCache := nddpkg.NewImageCache(cacheDir, afero.NewOsFs())
-		zlog.Info("Cache Directory", "cacheDir", cacheDir)
+		maxSize, err := resource.ParseQuantity(cacheMaxSize)
+		if err != nil {
+			return errors.Wrap(err, "Cannot parse cache max size")
+		}
+		pkgCache := nddpkg.NewImageCache(cacheDir, afero.NewOsFs(), nddpkg.WithMaxSize(maxSize.Value()))
+		zlog.Info("Cache Directory", "cacheDir", cacheDir, "cacheMaxSize", cacheMaxSize)
 		zlog.Info("Namespace", "namespace", namespace)
 
-		if err := pkg.Setup(mgr, logging.NewLogrLogger(zlog.WithName("nddcore-pkg")), pkgCache, namespace); err != nil {
+		settingsPolicy, err := resolver.ParseSettingsPolicy(dependencySettings)
+		if err != nil {
+			return errors.Wrap(err, "Cannot parse dependency settings policy")
+		}
+
+		regCfg, err := nddpkg.LoadRegistryConfig(afero.NewOsFs(), registryConfig)
+		if err != nil {
+			return errors.Wrap(err, "Cannot load registry config")
+		}
+		regCfg.CABundles = append(regCfg.CABundles, caBundles...)
+		regCfg.InsecureRegistries = append(regCfg.InsecureRegistries, insecureRegistries...)
+		rewriter, err := nddpkg.NewRewriter(regCfg)
+		if err != nil {
+			return errors.Wrap(err, "Cannot parse registry rewrite rules")
+		}
+		transport, err := nddpkg.NewRegistryTransport(afero.NewOsFs(), regCfg)
+		if err != nil {
+			return errors.Wrap(err, "Cannot create registry transport")
+		}
+		zlog.Info("Registry Config", "registryConfig", registryConfig, "mirrors", len(regCfg.Mirrors), "rewrites", len(regCfg.Rewrites), "caBundles", regCfg.CABundles, "insecureRegistries", regCfg.InsecureRegistries)
+
+		clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			return errors.Wrap(err, "Cannot create clientset")
+		}
+		// Rewrite before limiting, such that calls are limited per registry
+		// they are actually made to.
+		fetcher := nddpkg.NewRewritingFetcher(
+			nddpkg.NewLimitingFetcher(
+				nddpkg.NewK8sFetcher(clientset, namespace, nddpkg.WithRegistryTransport(transport)),
+				nddpkg.WithRateLimit(registryQPS, registryBurst),
+				nddpkg.WithMaxRetries(registryMaxRetries)),
+			rewriter)
+		zlog.Info("Registry Limits", "registryQPS", registryQPS, "registryBurst", registryBurst, "registryMaxRetries", registryMaxRetries)
+
+		// Packages are only polled at a long interval when pushed images are
+		// notified through the registry webhook.
+		var trigger *manager.PushTrigger
+		if webhookAddr != "" {
+			auth := nddpkg.WithWebhookInsecure()
+			if !webhookInsecure {
+				secret, err := readSecret(webhookSecretFile)
+				if err != nil {
+					return errors.Wrap(err, "Cannot read registry webhook secret")
+				}
+				auth = nddpkg.WithWebhookSecret(secret)
+			}
+			trigger = manager.NewPushTrigger(mgr.GetClient(), rewriter,
+				manager.WithPollInterval(webhookPollInterval),
+				manager.WithTriggerLogger(logging.NewLogrLogger(zlog.WithName("nddcore-webhook"))))
+			h := nddpkg.NewWebhookHandler(trigger,
+				auth,
+				nddpkg.WithWebhookLogger(logging.NewLogrLogger(zlog.WithName("nddcore-webhook"))))
+			if err := mgr.Add(nddpkg.NewWebhookServer(webhookAddr, h)); err != nil {
+				return errors.Wrap(err, "Cannot add registry webhook server to manager")
+			}
+			zlog.Info("Registry Webhook", "webhookAddr", webhookAddr, "authenticated", !webhookInsecure, "pollInterval", webhookPollInterval)
+		}
+
+		if err := pkg.Setup(mgr, logging.NewLogrLogger(zlog.WithName("nddcore-pkg")), pkgCache, fetcher, nddpkg.NewK8sSources(clientset, namespace, transport), rewriter, trigger, namespace, settingsPolicy); err != nil {
 			return errors.Wrap(err, "Cannot add ndd packages controllers to manager")
 		}
+		if err := revision.SetupCacheCollector(mgr, logging.NewLogrLogger(zlog.WithName("nddcore-pkg")), pkgCache, cacheGCInterval); err != nil {
+			return errors.Wrap(err, "Cannot add package cache garbage collector to manager")
+		}
+
+		if uploadAddr != "" {
+			uploadMax, err := resource.ParseQuantity(uploadMaxSize)
+			if err != nil {
+				return errors.Wrap(err, "Cannot parse package upload max size")
+			}
+			token, err := readSecret(uploadTokenFile)
+			if err != nil {
+				return errors.Wrap(err, "Cannot read package upload token")
+			}
+			h := nddpkg.NewUploadHandler(pkgCache,
+				nddpkg.WithUploadToken(token),
+				nddpkg.WithMaxUploadSize(uploadMax.Value()),
+				nddpkg.WithUploadLogger(logging.NewLogrLogger(zlog.WithName("nddcore-upload"))))
+			if err := mgr.Add(nddpkg.NewUploadServer(uploadAddr, h)); err != nil {
+				return errors.Wrap(err, "Cannot add package upload server to manager")
+			}
+			zlog.Info("Package Upload", "uploadAddr", uploadAddr, "uploadMaxSize", uploadMaxSize)
+		}
 
 		// +kubebuilder:scaffold:builder
 
@@ -103,7 +211,40 @@ func init() {
 	startCmd.Flags().IntVarP(&concurrency, "concurrency", "", 1, "Number of items to process simultaneously")
 	startCmd.Flags().StringVarP(&namespace, "namespace", "n", os.Getenv("POD_NAMESPACE"), "Namespace used to unpack and run packages.")
 	startCmd.Flags().StringVarP(&cacheDir, "cache-dir", "c", "/cache", "Directory used for caching package images.")
+	startCmd.Flags().StringVarP(&cacheMaxSize, "cache-max-size", "", "0", "Maximum total size of cached package images, e.g. 10Gi. Zero does not bound the cache.")
+	startCmd.Flags().DurationVarP(&cacheGCInterval, "cache-gc-interval", "", 10*time.Minute, "Interval at which package images no longer used by a provider revision are removed from the cache. Zero disables garbage collection.")
+	startCmd.Flags().StringVarP(&dependencySettings, "dependency-settings", "", string(resolver.DefaultSettingsPolicy), "How the pull settings of the packages that depend on a package are merged into the dependency package: Union, First or None.")
+	startCmd.Flags().StringVarP(&uploadAddr, "package-upload-bind-address", "", "", "The address the package upload endpoint binds to. Uploaded package images are imported into the cache for packages with a pull policy of Never. Empty disables package uploads.")
+	startCmd.Flags().StringVarP(&uploadMaxSize, "package-upload-max-size", "", "100Mi", "Maximum size of an uploaded package image.")
+	startCmd.Flags().StringVarP(&uploadTokenFile, "package-upload-token-file", "", "", "Path to a file with the token uploaded package images must carry in the "+nddpkg.UploadTokenHeader+" header. Required if package uploads are enabled.")
+	startCmd.Flags().StringVarP(&registryConfig, "registry-config", "", "", "Path to a file with registry mirrors and rewrite rules applied to package and controller images. A file that does not exist is ignored; changes require a restart.")
+	startCmd.Flags().StringSliceVarP(&caBundles, "ca-bundle", "", nil, "Paths to PEM encoded CA certificates, or directories of them, trusted when connecting to registries or downloading packages. Paths that do not exist are ignored.")
+	startCmd.Flags().StringSliceVarP(&insecureRegistries, "insecure-registry", "", nil, "Registries, e.g. registry.lab:5000, that may be reached over plain HTTP or without verifying their certificates. Also applies to packages downloaded from these hosts.")
+	startCmd.Flags().Float64VarP(&registryQPS, "registry-qps", "", nddpkg.DefaultRegistryQPS, "Sustained rate of calls per second to each registry. Zero does not limit calls.")
+	startCmd.Flags().IntVarP(&registryBurst, "registry-burst", "", nddpkg.DefaultRegistryBurst, "Number of calls to each registry that may exceed the sustained rate.")
+	startCmd.Flags().IntVarP(&registryMaxRetries, "registry-max-retries", "", nddpkg.DefaultMaxRetries, "Number of times a registry call is retried with exponential backoff when the registry is throttling or unavailable. A Retry-After reported by the registry is honoured.")
+	startCmd.Flags().StringVarP(&webhookAddr, "registry-webhook-bind-address", "", "", "The address the registry webhook endpoint binds to. Docker distribution, Harbor and GitHub push notifications sent to "+nddpkg.WebhookPath+" reconcile the packages that refer to the pushed image right away. Empty disables the webhook.")
+	startCmd.Flags().StringVarP(&webhookSecretFile, "registry-webhook-secret-file", "", "", "Path to a file with a secret that registry notifications must carry as an Authorization header or GitHub signature. Required if the webhook is enabled, unless it is insecure.")
+	startCmd.Flags().BoolVarP(&webhookInsecure, "registry-webhook-insecure", "", false, "Accept registry notifications without a secret. Anyone who can reach the webhook endpoint can then trigger package reconciles.")
+	startCmd.Flags().DurationVarP(&webhookPollInterval, "registry-webhook-poll-interval", "", manager.DefaultPushPollInterval, "Interval at which packages with a pull policy of Always are still polled for new images when the registry webhook is enabled.")
+
+}
 
+// readSecret reads a secret from the supplied file. It returns an error if the
+// file cannot be read or holds no secret.
+func readSecret(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("no secret file specified")
+	}
+	b, err := afero.ReadFile(afero.NewOsFs(), path)
+	if err != nil {
+		return "", err
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		return "", errors.Errorf("secret file %s is empty", path)
+	}
+	return s, nil
 }
 
 func nddConcurrency(c int) controller.Options {
@@ -29,6 +29,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	nddpkg "github.com/yndd/ndd-core/internal/nddpkg"
+	"github.com/yndd/ndd-core/internal/version"
 	"github.com/yndd/ndd-runtime/pkg/parser"
 )
 
@@ -38,11 +39,19 @@ const (
 	errBuildPackage    = "failed to build package"
 	errImageDigest     = "failed to get package digest"
 	errCreatePackage   = "failed to create package file"
+	errPackageTypeFmt  = "unknown package type %q, must be one of provider or intent"
+	errBuildTimestamp  = "failed to get package build timestamp"
+	errReproducibleFmt = "package build is not reproducible: first build has digest %s, second build has digest %s"
+
+	packageTypeProvider = "provider"
+	packageTypeIntent   = "intent"
 )
 
 var packageRoot string
 var packageType string
 var ignore []string
+var nddVersion string
+var verifyReproducible bool
 
 // buildCmd represents the build command
 var buildCmd = &cobra.Command{
@@ -87,21 +96,50 @@ var buildCmd = &cobra.Command{
 			return errors.New("cannot build object scheme for package parser")
 		}
 
-		var img v1.Image
-		img, err = nddpkg.Build(context.Background(),
-			parser.NewFsBackend(buildChild.fs, parser.FsDir(root), parser.FsFilters(buildFilters(root, ignore)...)),
-			parser.New(metaScheme, objScheme),
-			nddpkg.NewProviderLinter())
-		if err != nil {
-			return errors.Wrap(err, errBuildPackage)
+		var linter parser.Linter
+		switch packageType {
+		case packageTypeProvider:
+			linter = nddpkg.NewProviderLinter(version.NewVersioner(nddVersion))
+		case packageTypeIntent:
+			linter = nddpkg.NewIntentLinter(version.NewVersioner(nddVersion))
+		default:
+			return errors.Errorf(errPackageTypeFmt, packageType)
 		}
 
-		//fmt.Printf("packageType: %s\n", packageType)
+		ts, err := nddpkg.BuildTimestamp()
+		if err != nil {
+			return errors.Wrap(err, errBuildTimestamp)
+		}
+		build := func() (v1.Image, v1.Hash, error) {
+			img, err := nddpkg.Build(context.Background(),
+				parser.NewFsBackend(buildChild.fs, parser.FsDir(root), parser.FsFilters(buildFilters(root, ignore)...)),
+				parser.New(metaScheme, objScheme),
+				linter,
+				nddpkg.WithTimestamp(ts))
+			if err != nil {
+				return nil, v1.Hash{}, errors.Wrap(err, errBuildPackage)
+			}
+			hash, err := img.Digest()
+			if err != nil {
+				return nil, v1.Hash{}, errors.Wrap(err, errImageDigest)
+			}
+			return img, hash, nil
+		}
 
-		hash, err := img.Digest()
+		img, hash, err := build()
 		if err != nil {
-			return errors.Wrap(err, errImageDigest)
+			return err
 		}
+		if verifyReproducible {
+			_, again, err := build()
+			if err != nil {
+				return err
+			}
+			if again != hash {
+				return errors.Errorf(errReproducibleFmt, hash, again)
+			}
+		}
+
 		pkgName := buildChild.name
 		if pkgName == "" {
 			metaPath := filepath.Join(root, nddpkg.MetaFile)
@@ -127,7 +165,9 @@ func init() {
 	buildCmd.Flags().StringVarP(&packageRoot, "PackageRoot", "f", ".", "Path to package directory.")
 	buildCmd.Flags().StringSliceVarP(&ignore, "Ignore", "", i, "Paths, specified relative to --package-root, to exclude from the package.")
 	buildCmd.Flags().StringVarP(&packageName, "PackageName", "n", "", "Name of the package to be built. Uses name in ndd.yaml if not specified. Does not correspond to package tag.")
-	buildCmd.Flags().StringVarP(&packageType, "PackageType", "t", "provider", "Type of the package to be built. default: provider, other options: intent")
+	buildCmd.Flags().StringVarP(&packageType, "PackageType", "t", packageTypeProvider, "Type of the package to be built. default: provider, other options: intent")
+	buildCmd.Flags().StringVarP(&nddVersion, "NddVersion", "", version.New().GetVersionString(), "Ndd version the package must be compatible with. Defaults to the version of this plugin.")
+	buildCmd.Flags().BoolVarP(&verifyReproducible, "verify-reproducible", "", false, "Build the package twice and fail if the two builds do not have the same digest. Timestamps are taken from SOURCE_DATE_EPOCH if set.")
 }
 
 // default build filters skip directories, empty files, and files without YAML
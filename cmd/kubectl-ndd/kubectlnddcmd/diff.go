@@ -0,0 +1,167 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubectlnddcmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	nddv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+const (
+	errGetRevision    = "cannot get provider revision"
+	errListRevisions  = "cannot list provider revisions"
+	errNoRevision     = "provider has no revision"
+	errNoRevisionDiff = "provider revision has no diff"
+	errDiffArgs       = "specify either a revision name or a provider name"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:          "diff [revision]",
+	Short:        "show the changes of a ndd package revision",
+	Long:         "show the changes a ndd package revision introduces with respect to the previously active revision",
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if (len(args) == 0) == (providerName == "") {
+			return errors.New(errDiffArgs)
+		}
+		k8sclopts := client.Options{
+			Scheme: scheme,
+		}
+		c, err := client.New(config.GetConfigOrDie(), k8sclopts)
+		if err != nil {
+			return errors.Wrap(warnIfNotFound(err), errGetclient)
+		}
+
+		var pr *nddv1.ProviderRevision
+		if len(args) == 1 {
+			pr = &nddv1.ProviderRevision{}
+			if err := c.Get(context.Background(), types.NamespacedName{Name: args[0]}, pr); err != nil {
+				return errors.Wrap(warnIfNotFound(err), errGetRevision)
+			}
+		} else {
+			pr, err = latestRevision(context.Background(), c, providerName)
+			if err != nil {
+				return err
+			}
+		}
+		if pr.Status.Diff == nil {
+			return errors.Errorf("%s: %s", errNoRevisionDiff, pr.GetName())
+		}
+		return printRevisionDiff(os.Stdout, pr.GetName(), pr.Status.Diff)
+	},
+}
+
+// latestRevision returns the revision of the provider with the highest
+// revision number.
+func latestRevision(ctx context.Context, c client.Client, provider string) (*nddv1.ProviderRevision, error) {
+	prs := &nddv1.ProviderRevisionList{}
+	if err := c.List(ctx, prs, client.MatchingLabels(map[string]string{nddv1.ParentLabelKey: provider})); err != nil {
+		return nil, errors.Wrap(warnIfNotFound(err), errListRevisions)
+	}
+	var latest *nddv1.ProviderRevision
+	for i := range prs.Items {
+		if latest == nil || prs.Items[i].Spec.Revision > latest.Spec.Revision {
+			latest = &prs.Items[i]
+		}
+	}
+	if latest == nil {
+		return nil, errors.Errorf("%s: %s", errNoRevision, provider)
+	}
+	return latest, nil
+}
+
+// printRevisionDiff renders a revision diff in a human readable form.
+func printRevisionDiff(w io.Writer, name string, d *nddv1.RevisionDiff) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s/%s compared to %s\n", strings.ToLower(nddv1.ProviderRevisionGroupKind), name, d.PreviousRevision)
+
+	writeSection := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n%s:\n", title)
+		for _, l := range lines {
+			fmt.Fprintf(&b, "  %s\n", l)
+		}
+	}
+	writeSection("CRDs added", prefix("+ ", d.AddedCRDs))
+	writeSection("CRDs removed", prefix("- ", d.RemovedCRDs))
+	writeSection("CRD schemas changed", prefix("~ ", d.ChangedCRDs))
+	writeSection("Permission requests added", prefix("+ ", formatRules(d.AddedPermissionRequests)))
+	writeSection("Permission requests removed", prefix("- ", formatRules(d.RemovedPermissionRequests)))
+
+	containers := []string{}
+	for _, cd := range d.Containers {
+		switch {
+		case cd.PreviousImage == "":
+			containers = append(containers, fmt.Sprintf("+ %s: image %s args %v", cd.Name, cd.Image, cd.Args))
+		case cd.Image == "":
+			containers = append(containers, fmt.Sprintf("- %s: image %s args %v", cd.Name, cd.PreviousImage, cd.PreviousArgs))
+		default:
+			if cd.PreviousImage != cd.Image {
+				containers = append(containers, fmt.Sprintf("~ %s: image %s -> %s", cd.Name, cd.PreviousImage, cd.Image))
+			}
+			if strings.Join(cd.PreviousArgs, " ") != strings.Join(cd.Args, " ") {
+				containers = append(containers, fmt.Sprintf("~ %s: args %v -> %v", cd.Name, cd.PreviousArgs, cd.Args))
+			}
+		}
+	}
+	writeSection("Containers", containers)
+
+	if len(d.AddedCRDs)+len(d.RemovedCRDs)+len(d.ChangedCRDs)+len(d.AddedPermissionRequests)+len(d.RemovedPermissionRequests)+len(d.Containers) == 0 {
+		b.WriteString("\nno changes\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func prefix(p string, lines []string) []string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = p + l
+	}
+	return out
+}
+
+func formatRules(rules []rbacv1.PolicyRule) []string {
+	out := make([]string, len(rules))
+	for i, r := range rules {
+		out[i] = fmt.Sprintf("apiGroups=%v resources=%v verbs=%v", r.APIGroups, r.Resources, r.Verbs)
+		if len(r.NonResourceURLs) > 0 {
+			out[i] += fmt.Sprintf(" nonResourceURLs=%v", r.NonResourceURLs)
+		}
+	}
+	return out
+}
+
+func init() {
+	packageCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVarP(&providerName, "providerName", "", "", "Name of Provider. The diff of its latest revision is shown.")
+}
@@ -0,0 +1,367 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubectlnddcmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	nddv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-core/internal/dag"
+	nddpkg "github.com/yndd/ndd-core/internal/nddpkg"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+const (
+	lockName = "lock"
+
+	errGetLock        = "cannot get lock"
+	errBuildGraph     = "cannot build dependency graph"
+	errGraphOutputFmt = "unknown output format %q, must be one of tree, dot or json"
+
+	graphOutputTree = "tree"
+	graphOutputDot  = "dot"
+	graphOutputJSON = "json"
+)
+
+var graphOutput string
+
+// graphCmd represents the graph command
+var graphCmd = &cobra.Command{
+	Use:          "graph",
+	Short:        "show the dependency graph of the installed ndd packages",
+	Long:         "show the dependency graph recorded in the package lock as a tree, graphviz dot or json, highlighting missing packages, version constraint violations and cycles",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		k8sclopts := client.Options{
+			Scheme: scheme,
+		}
+		c, err := client.New(config.GetConfigOrDie(), k8sclopts)
+		if err != nil {
+			return errors.Wrap(warnIfNotFound(err), errGetclient)
+		}
+
+		lock := &nddv1.Lock{}
+		if err := c.Get(context.Background(), types.NamespacedName{Name: lockName}, lock); err != nil {
+			return errors.Wrap(warnIfNotFound(err), errGetLock)
+		}
+		g, err := buildPackageGraph(lock)
+		if err != nil {
+			return errors.Wrap(err, errBuildGraph)
+		}
+
+		switch graphOutput {
+		case graphOutputTree:
+			return printGraphTree(os.Stdout, g)
+		case graphOutputDot:
+			return printGraphDot(os.Stdout, g)
+		case graphOutputJSON:
+			return printGraphJSON(os.Stdout, g)
+		default:
+			return errors.Errorf(errGraphOutputFmt, graphOutput)
+		}
+	},
+}
+
+// A graphNode is a package in the dependency graph.
+type graphNode struct {
+	Source string `json:"source"`
+	Name   string `json:"name,omitempty"`
+	Type   string `json:"type,omitempty"`
+
+	// Version is the installed version of the package.
+	Version string `json:"version,omitempty"`
+
+	// Missing is true if the package is a dependency of another package but is
+	// not in the lock.
+	Missing bool `json:"missing"`
+}
+
+// A graphEdge is a dependency of one package on another.
+type graphEdge struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Constraints string `json:"constraints,omitempty"`
+
+	// Violation explains why the installed version of the dependency does
+	// not satisfy the constraints, if it does not.
+	Violation string `json:"violation,omitempty"`
+
+	// Cycle is true if the dependency is part of a cycle.
+	Cycle bool `json:"cycle"`
+}
+
+// A packageGraph is the dependency graph of the packages in the lock.
+type packageGraph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+
+	// Cycles are the dependency cycles in the graph. The first package of
+	// each cycle is repeated at its end.
+	Cycles [][]string `json:"cycles,omitempty"`
+}
+
+func buildPackageGraph(lock *nddv1.Lock) (*packageGraph, error) {
+	d := dag.NewMapDag()
+	implied, err := d.Init(nddv1.ToNodes(lock.Packages...))
+	if err != nil {
+		return nil, err
+	}
+
+	g := &packageGraph{}
+	installed := map[string]nddv1.LockPackage{}
+	for _, lp := range lock.Packages {
+		installed[lp.Source] = lp
+		g.Nodes = append(g.Nodes, graphNode{
+			Source:  lp.Source,
+			Name:    lp.Name,
+			Type:    string(lp.Type),
+			Version: lp.Version,
+		})
+	}
+	missing := map[string]bool{}
+	for _, n := range implied {
+		if missing[n.Identifier()] {
+			continue
+		}
+		missing[n.Identifier()] = true
+		g.Nodes = append(g.Nodes, graphNode{Source: n.Identifier(), Missing: true})
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Source < g.Nodes[j].Source })
+
+	for _, lp := range lock.Packages {
+		for _, dep := range lp.Dependencies {
+			e := graphEdge{From: lp.Source, To: dep.Package, Constraints: dep.Constraints}
+			if t, ok := installed[dep.Package]; ok {
+				e.Violation = constraintViolation(dep.Constraints, t.Version)
+			}
+			g.Edges = append(g.Edges, e)
+		}
+	}
+
+	g.Cycles = findCycles(lock.Packages)
+	inCycle := map[[2]string]bool{}
+	for _, c := range g.Cycles {
+		for i := 0; i+1 < len(c); i++ {
+			inCycle[[2]string{c[i], c[i+1]}] = true
+		}
+	}
+	for i := range g.Edges {
+		g.Edges[i].Cycle = inCycle[[2]string{g.Edges[i].From, g.Edges[i].To}]
+	}
+	return g, nil
+}
+
+// constraintViolation returns why the supplied version does not satisfy the
+// supplied constraints, or an empty string if it does. Versions that are not
+// semantic versions, e.g. digests, cannot be checked and are not reported.
+func constraintViolation(constraints, version string) string {
+	c, err := nddpkg.ParseConstraint(constraints)
+	if err != nil {
+		return fmt.Sprintf("invalid constraints %q", constraints)
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return ""
+	}
+	if !c.Check(v) {
+		return fmt.Sprintf("version %s does not satisfy %s", version, constraints)
+	}
+	return ""
+}
+
+// findCycles returns every dependency cycle reachable by a depth first search
+// of the supplied packages.
+func findCycles(pkgs []nddv1.LockPackage) [][]string {
+	deps := map[string][]string{}
+	sources := make([]string, 0, len(pkgs))
+	for _, lp := range pkgs {
+		sources = append(sources, lp.Source)
+		for _, dep := range lp.Dependencies {
+			deps[lp.Source] = append(deps[lp.Source], dep.Package)
+		}
+	}
+	sort.Strings(sources)
+
+	var cycles [][]string
+	done := map[string]bool{}
+	onPath := map[string]int{}
+	path := []string{}
+	var visit func(s string)
+	visit = func(s string) {
+		onPath[s] = len(path)
+		path = append(path, s)
+		for _, n := range deps[s] {
+			if i, ok := onPath[n]; ok {
+				cycle := append([]string{}, path[i:]...)
+				cycles = append(cycles, append(cycle, n))
+				continue
+			}
+			if !done[n] {
+				visit(n)
+			}
+		}
+		path = path[:len(path)-1]
+		delete(onPath, s)
+		done[s] = true
+	}
+	for _, s := range sources {
+		if !done[s] {
+			visit(s)
+		}
+	}
+	return cycles
+}
+
+// printGraphTree renders the graph as a tree rooted at the packages no other
+// package depends on. Packages that are only reachable through a cycle are
+// rendered as additional roots.
+func printGraphTree(w io.Writer, g *packageGraph) error {
+	nodes := map[string]graphNode{}
+	for _, n := range g.Nodes {
+		nodes[n.Source] = n
+	}
+	edges := map[string][]graphEdge{}
+	dependedOn := map[string]bool{}
+	for _, e := range g.Edges {
+		edges[e.From] = append(edges[e.From], e)
+		dependedOn[e.To] = true
+	}
+
+	var b strings.Builder
+	printed := map[string]bool{}
+	var walk func(source, indent string, onPath map[string]bool)
+	walk = func(source, indent string, onPath map[string]bool) {
+		printed[source] = true
+		onPath[source] = true
+		defer delete(onPath, source)
+		es := edges[source]
+		for i, e := range es {
+			branch, next := "├── ", "│   "
+			if i == len(es)-1 {
+				branch, next = "└── ", "    "
+			}
+			fmt.Fprintf(&b, "%s%s%s", indent, branch, formatTreeNode(nodes[e.To]))
+			if e.Constraints != "" {
+				fmt.Fprintf(&b, " (%s)", e.Constraints)
+			}
+			if e.Violation != "" {
+				fmt.Fprintf(&b, " [violation: %s]", e.Violation)
+			}
+			if onPath[e.To] {
+				b.WriteString(" [cycle]\n")
+				continue
+			}
+			b.WriteString("\n")
+			walk(e.To, indent+next, onPath)
+		}
+	}
+	root := func(n graphNode) {
+		fmt.Fprintf(&b, "%s\n", formatTreeNode(n))
+		walk(n.Source, "", map[string]bool{})
+	}
+	for _, n := range g.Nodes {
+		if !dependedOn[n.Source] {
+			root(n)
+		}
+	}
+	for _, n := range g.Nodes {
+		if !printed[n.Source] {
+			root(n)
+		}
+	}
+	if len(g.Nodes) == 0 {
+		b.WriteString("no packages\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatTreeNode(n graphNode) string {
+	if n.Missing {
+		return n.Source + " [missing]"
+	}
+	if n.Version == "" {
+		return n.Source
+	}
+	return n.Source + ":" + n.Version
+}
+
+// printGraphDot renders the graph in the graphviz dot language. Missing
+// packages are drawn dashed and red, constraint violations red and cycles
+// orange.
+func printGraphDot(w io.Writer, g *packageGraph) error {
+	var b strings.Builder
+	b.WriteString("digraph packages {\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, n := range g.Nodes {
+		switch {
+		case n.Missing:
+			fmt.Fprintf(&b, "  %q [label=%q, style=dashed, color=red, fontcolor=red];\n", n.Source, n.Source+"\nmissing")
+		case n.Version != "":
+			fmt.Fprintf(&b, "  %q [label=%q];\n", n.Source, n.Source+"\n"+n.Version)
+		default:
+			fmt.Fprintf(&b, "  %q;\n", n.Source)
+		}
+	}
+	for _, e := range g.Edges {
+		attrs := []string{}
+		label := e.Constraints
+		if e.Violation != "" {
+			label = e.Violation
+		}
+		if label != "" {
+			attrs = append(attrs, fmt.Sprintf("label=%q", label))
+		}
+		switch {
+		case e.Violation != "":
+			attrs = append(attrs, "color=red", "fontcolor=red")
+		case e.Cycle:
+			attrs = append(attrs, "color=orange", "style=bold")
+		}
+		if len(attrs) == 0 {
+			fmt.Fprintf(&b, "  %q -> %q;\n", e.From, e.To)
+			continue
+		}
+		fmt.Fprintf(&b, "  %q -> %q [%s];\n", e.From, e.To, strings.Join(attrs, ", "))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func printGraphJSON(w io.Writer, g *packageGraph) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(g)
+}
+
+func init() {
+	packageCmd.AddCommand(graphCmd)
+	graphCmd.Flags().StringVarP(&graphOutput, "output", "o", graphOutputTree, "Output format of the graph. One of tree, dot or json.")
+}
@@ -18,9 +18,12 @@ package kubectlnddcmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
 	"strings"
 
 	"github.com/google/go-containerregistry/pkg/name"
@@ -32,6 +35,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 )
@@ -39,6 +44,11 @@ import (
 const (
 	errPkgIdentifier = "invalid package image identifier"
 	errGetclient     = "cannot get k8s client"
+	errReadPkgFile   = "cannot read package file"
+	errUploadPackage = "cannot upload package to ndd core"
+	errUploadResult  = "cannot decode package upload result"
+	errUploadToken   = "cannot get package upload token"
+	errFromFileName  = "a package name is required to install from a file"
 )
 
 //var packageName string
@@ -46,6 +56,13 @@ const (
 var revisionHistoryLimit int64
 var PackagePullSecrets []string
 var manualActivation bool
+var fromFile string
+var coreNamespace string
+var uploadService string
+var uploadSecret string
+
+// uploadTokenKey is the key of the upload token in the upload secret.
+const uploadTokenKey = "token"
 
 // installCmd represents the install command
 var installCmd = &cobra.Command{
@@ -59,63 +76,124 @@ var installCmd = &cobra.Command{
 			rap = nddv1.ManualActivation
 		}
 
-		if providerName != "" {
-			pkgName := providerName
-			if pkgName == "" {
-				ref, err := name.ParseReference(packageName)
-				if err != nil {
-					return errors.Wrap(err, errPkgIdentifier)
-				}
-				pkgName = nddpkg.ToDNSLabel(ref.Context().RepositoryStr())
+		var pack nddv1.Package
+		var pkgName, kind string
+		switch {
+		case providerName != "":
+			pack, pkgName, kind = &nddv1.Provider{}, providerName, nddv1.ProviderGroupKind
+		case intentName != "":
+			pack, pkgName, kind = &nddv1.Intent{}, intentName, nddv1.IntentGroupKind
+		default:
+			if fromFile != "" {
+				return errors.New(errFromFileName)
 			}
-			packagePullSecrets := make([]corev1.LocalObjectReference, len(PackagePullSecrets))
-			for i, s := range PackagePullSecrets {
-				packagePullSecrets[i] = corev1.LocalObjectReference{
-					Name: s,
-				}
+			return nil
+		}
+		if pkgName == "" {
+			ref, err := name.ParseReference(packageName)
+			if err != nil {
+				return errors.Wrap(err, errPkgIdentifier)
 			}
-			cr := &nddv1.Provider{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: pkgName,
-				},
-				Spec: nddv1.ProviderSpec{
-					PackageSpec: nddv1.PackageSpec{
-						Package:                  packageName,
-						RevisionActivationPolicy: &rap,
-						RevisionHistoryLimit:     &revisionHistoryLimit,
-						PackagePullSecrets:       packagePullSecrets,
-					},
-				},
+			pkgName = nddpkg.ToDNSLabel(ref.Context().RepositoryStr())
+		}
+		packagePullSecrets := make([]corev1.LocalObjectReference, len(PackagePullSecrets))
+		for i, s := range PackagePullSecrets {
+			packagePullSecrets[i] = corev1.LocalObjectReference{
+				Name: s,
 			}
+		}
+		pack.SetName(pkgName)
+		pack.SetSource(packageName)
+		pack.SetActivationPolicy(&rap)
+		pack.SetRevisionHistoryLimit(&revisionHistoryLimit)
+		pack.SetPackagePullSecrets(packagePullSecrets)
 
-			fmt.Printf("cr %v", cr)
-			k8sclopts := client.Options{
-				Scheme: scheme,
-			}
-			c, err := client.New(config.GetConfigOrDie(), k8sclopts)
+		cfg := config.GetConfigOrDie()
+		if fromFile != "" {
+			source, err := uploadPackage(context.Background(), cfg, pkgName, fromFile)
 			if err != nil {
-				return errors.Wrap(warnIfNotFound(err), errGetclient)
+				return err
 			}
+			// The uploaded package can only be read from the cache of the
+			// ndd core.
+			never := corev1.PullNever
+			pack.SetSource(source)
+			pack.SetPackagePullPolicy(&never)
+		}
 
-			if err := c.Create(context.Background(), cr); err != nil {
-				return errors.Wrap(warnIfNotFound(err), "cannot create provider")
-			}
+		fmt.Printf("cr %v", pack)
+		k8sclopts := client.Options{
+			Scheme: scheme,
+		}
+		c, err := client.New(cfg, k8sclopts)
+		if err != nil {
+			return errors.Wrap(warnIfNotFound(err), errGetclient)
+		}
 
-			_, err = fmt.Fprintf(os.Stdout, "%s/%s created\n", strings.ToLower(nddv1.ProviderGroupKind), pkgName)
-			return err
+		if err := c.Create(context.Background(), pack); err != nil {
+			return errors.Wrapf(warnIfNotFound(err), "cannot create %s", strings.ToLower(kind))
 		}
-		return nil
+
+		_, err = fmt.Fprintf(os.Stdout, "%s/%s created\n", strings.ToLower(kind), pkgName)
+		return err
 	},
 }
 
 func init() {
 	i := make([]string, 0)
 	packageCmd.AddCommand(installCmd)
-	installCmd.PersistentFlags().StringVarP(&packageName, "PackageName", "p", "", "Image containing Provider package.")
+	installCmd.PersistentFlags().StringVarP(&packageName, "PackageName", "p", "", "Image containing Provider or Intent package.")
 	installCmd.Flags().StringVarP(&providerName, "providerName", "", "", "Name of Provider.")
+	installCmd.Flags().StringVarP(&intentName, "intentName", "", "", "Name of Intent.")
 	installCmd.Flags().Int64VarP(&revisionHistoryLimit, "RevisionHistoryLimit", "r", 1, "Revision history limit.")
 	installCmd.Flags().BoolVarP(&manualActivation, "ManualActivation", "", false, "Enable manual revision activation policy")
 	installCmd.Flags().StringSliceVarP(&PackagePullSecrets, "PackagePullSecrets", "", i, "List of secrets used to pull package.")
+	installCmd.Flags().StringVarP(&fromFile, "from-file", "", "", "Package file, e.g. built by kubectl ndd package build, to upload to the ndd core and install without registry access.")
+	installCmd.Flags().StringVarP(&coreNamespace, "CoreNamespace", "", "ndd-system", "Namespace of the ndd core that package files are uploaded to.")
+	installCmd.Flags().StringVarP(&uploadService, "UploadService", "", "ndd-core-package-upload:upload", "Service and port of the ndd core package upload endpoint.")
+	installCmd.Flags().StringVarP(&uploadSecret, "UploadSecret", "", "ndd-core-package-upload", "Secret in the ndd core namespace whose "+uploadTokenKey+" authenticates package uploads.")
+}
+
+// uploadPackage uploads a package file to the package upload endpoint of the
+// ndd core through the API server service proxy, and returns the source under
+// which the ndd core cached it. The upload is authenticated with the token of
+// the upload secret, which only users that may read it can upload with.
+func uploadPackage(ctx context.Context, cfg *rest.Config, pkgName, file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", errors.Wrap(err, errReadPkgFile)
+	}
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return "", errors.Wrap(err, errGetclient)
+	}
+	s, err := cs.CoreV1().Secrets(coreNamespace).Get(ctx, uploadSecret, metav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrap(err, errUploadToken)
+	}
+	token := strings.TrimSpace(string(s.Data[uploadTokenKey]))
+	if token == "" {
+		return "", errors.Errorf("%s: secret %s has no %s", errUploadToken, uploadSecret, uploadTokenKey)
+	}
+	raw, err := cs.CoreV1().RESTClient().Put().
+		Namespace(coreNamespace).
+		Resource("services").
+		Name(uploadService).
+		SubResource("proxy").
+		Suffix(path.Join(nddpkg.UploadPath, pkgName)).
+		SetHeader("Content-Type", "application/octet-stream").
+		SetHeader(nddpkg.UploadTokenHeader, token).
+		Body(b).
+		DoRaw(ctx)
+	if err != nil {
+		return "", errors.Wrap(warnIfNotFound(err), errUploadPackage)
+	}
+	res := nddpkg.UploadResult{}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return "", errors.Wrap(err, errUploadResult)
+	}
+	_, err = fmt.Fprintf(os.Stdout, "package %s uploaded as %s\n", res.Digest, res.Source)
+	return res.Source, err
 }
 
 func warnIfNotFound(err error) error {
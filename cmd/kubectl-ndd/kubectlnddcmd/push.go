@@ -17,6 +17,7 @@ limitations under the License.
 package kubectlnddcmd
 
 import (
+	"context"
 	"os"
 
 	"github.com/google/go-containerregistry/pkg/authn"
@@ -91,7 +92,15 @@ var pushCmd = &cobra.Command{
 				},
 			}, img, f)
 		}
-		return remote.Write(tag, img, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+		t, err := registryTransport(pushChild.fs)
+		if err != nil {
+			return err
+		}
+		ref, err := t.Reference(tag)
+		if err != nil {
+			return err
+		}
+		return remote.Write(ref, img, nddpkg.RemoteOptions(context.Background(), authn.DefaultKeychain, t)...)
 	},
 }
 
@@ -99,4 +108,5 @@ func init() {
 	packageCmd.AddCommand(pushCmd)
 	pushCmd.Flags().StringVarP(&nddPackageName, "NddPackageName", "p", "", "Path to package. If not specified and only one package exists in current directory it will be used.")
 	pushCmd.Flags().BoolVarP(&local, "local", "", false, "save image to tarball.")
+	addRegistryFlags(pushCmd)
 }
@@ -0,0 +1,61 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubectlnddcmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	nddpkg "github.com/yndd/ndd-core/internal/nddpkg"
+)
+
+const (
+	errCABundle          = "cannot read CA bundle"
+	errRegistryTransport = "cannot configure registry transport"
+)
+
+var (
+	caBundles          []string
+	insecureRegistries []string
+)
+
+// addRegistryFlags adds the flags that configure how a command connects to
+// registries.
+func addRegistryFlags(c *cobra.Command) {
+	c.Flags().StringSliceVarP(&caBundles, "ca-bundle", "", nil, "Paths to PEM encoded CA certificates, or directories of them, trusted when connecting to registries.")
+	c.Flags().StringSliceVarP(&insecureRegistries, "insecure-registry", "", nil, "Registries, e.g. registry.lab:5000, that may be reached over plain HTTP or without verifying their certificates.")
+}
+
+// registryTransport returns the RegistryTransport configured by the registry
+// flags, or nil if they are not set such that the remote defaults are used.
+func registryTransport(fs afero.Fs) (*nddpkg.RegistryTransport, error) {
+	if len(caBundles) == 0 && len(insecureRegistries) == 0 {
+		return nil, nil
+	}
+	// Unlike the core, which may mount CA bundles from an optional
+	// ConfigMap, a CA bundle that was asked for must exist.
+	for _, path := range caBundles {
+		if _, err := fs.Stat(path); err != nil {
+			return nil, errors.Wrap(err, errCABundle)
+		}
+	}
+	t, err := nddpkg.NewRegistryTransport(fs, nddpkg.RegistryConfig{
+		CABundles:          caBundles,
+		InsecureRegistries: insecureRegistries,
+	})
+	return t, errors.Wrap(err, errRegistryTransport)
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/spf13/cobra"
 	nddv1 "github.com/yndd/ndd-core/apis/pkg/v1"
 	nddpkg "github.com/yndd/ndd-core/internal/nddpkg"
+	"github.com/yndd/ndd-core/internal/version"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -62,7 +63,7 @@ func init() {
 
 	buildChild = &BuildChild{
 		fs:             afero.NewOsFs(),
-		providerLinter: nddpkg.NewProviderLinter(),
+		providerLinter: nddpkg.NewProviderLinter(version.New()),
 	}
 	pushChild = &PushChild{
 		fs: afero.NewOsFs(),
@@ -0,0 +1,241 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubectlnddcmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	nddpkg "github.com/yndd/ndd-core/internal/nddpkg"
+	"github.com/yndd/ndd-core/internal/version"
+	"github.com/yndd/ndd-runtime/pkg/parser"
+)
+
+const (
+	errValidateArgs         = "requires exactly one package directory, .nddpkg file or image reference"
+	errReadPackageDir       = "cannot read package directory"
+	errReadPackageFile      = "cannot read package file"
+	errFetchPackageImage    = "cannot fetch package image"
+	errValidateOutputFmt    = "unknown output format %q, must be one of text or json"
+	errValidationFailedFmt  = "package has %d error(s)"
+	validateOutputText      = "text"
+	validateOutputJSON      = "json"
+	validateSummaryFmt      = "%d error(s), %d warning(s)\n"
+	validateFindingLineFmt  = "%-7s %s: [%s] %s\n"
+	validateFindingNoLocFmt = "%-7s [%s] %s\n"
+)
+
+var (
+	validateOutput     string
+	validateIgnore     []string
+	validateNddVersion string
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:          "validate <dir|.nddpkg|image>",
+	Short:        "validate a ndd package",
+	Long:         "validate a ndd package directory, package file or package image, reporting every lint finding with its file and object location",
+	SilenceUsage: true,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New(errValidateArgs)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if validateOutput != validateOutputText && validateOutput != validateOutputJSON {
+			return errors.Errorf(errValidateOutputFmt, validateOutput)
+		}
+		ctx := context.Background()
+		docs, err := readPackageDocuments(ctx, afero.NewOsFs(), args[0], validateIgnore)
+		if err != nil {
+			return err
+		}
+
+		metaScheme, err := nddpkg.BuildMetaScheme()
+		if err != nil {
+			return errors.New("cannot build meta scheme for package parser")
+		}
+		objScheme, err := nddpkg.BuildObjectScheme()
+		if err != nil {
+			return errors.New("cannot build object scheme for package parser")
+		}
+		v := nddpkg.NewValidator(parser.New(metaScheme, objScheme), version.NewVersioner(validateNddVersion))
+		findings := v.Validate(ctx, docs)
+
+		if validateOutput == validateOutputJSON {
+			err = printFindingsJSON(os.Stdout, findings)
+		} else {
+			err = printFindingsText(os.Stdout, findings)
+		}
+		if err != nil {
+			return err
+		}
+		if n := countFindings(findings, nddpkg.SeverityError); n > 0 {
+			return errors.Errorf(errValidationFailedFmt, n)
+		}
+		return nil
+	},
+}
+
+// readPackageDocuments reads the YAML documents of a package directory, a
+// .nddpkg package file or a package image.
+func readPackageDocuments(ctx context.Context, fs afero.Fs, src string, ignore []string) ([]nddpkg.Document, error) {
+	if info, err := fs.Stat(src); err == nil {
+		if info.IsDir() {
+			docs, err := readPackageDir(fs, src, ignore)
+			return docs, errors.Wrap(err, errReadPackageDir)
+		}
+		img, err := tarball.ImageFromPath(src, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, errReadPackageFile)
+		}
+		docs, err := readPackageImage(img)
+		return docs, errors.Wrap(err, errReadPackageFile)
+	}
+	ref, err := name.ParseReference(src)
+	if err != nil {
+		return nil, errors.Wrap(err, errPkgIdentifier)
+	}
+	t, err := registryTransport(fs)
+	if err != nil {
+		return nil, err
+	}
+	if ref, err = t.Reference(ref); err != nil {
+		return nil, errors.Wrap(err, errPkgIdentifier)
+	}
+	img, err := remote.Image(ref, nddpkg.RemoteOptions(ctx, authn.DefaultKeychain, t)...)
+	if err != nil {
+		return nil, errors.Wrap(err, errFetchPackageImage)
+	}
+	docs, err := readPackageImage(img)
+	return docs, errors.Wrap(err, errFetchPackageImage)
+}
+
+// readPackageDir reads the documents of every file that would be included
+// when the package directory is built. Files are reported relative to the
+// package directory.
+func readPackageDir(fs afero.Fs, dir string, ignore []string) ([]nddpkg.Document, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	filters := buildFilters(root, ignore)
+	docs := []nddpkg.Document{}
+	err = afero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, skip := range filters {
+			s, err := skip(path, info)
+			if err != nil {
+				return err
+			}
+			if s {
+				return nil
+			}
+		}
+		f, err := fs.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		d, err := nddpkg.ReadDocuments(rel, f)
+		if err != nil {
+			return errors.Wrap(err, rel)
+		}
+		docs = append(docs, d...)
+		return nil
+	})
+	return docs, err
+}
+
+func readPackageImage(img v1.Image) ([]nddpkg.Document, error) {
+	rc, err := nddpkg.OpenStream(img)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+	return nddpkg.ReadDocuments(nddpkg.StreamFile, rc)
+}
+
+func countFindings(findings []nddpkg.Finding, s nddpkg.Severity) int {
+	n := 0
+	for _, f := range findings {
+		if f.Severity == s {
+			n++
+		}
+	}
+	return n
+}
+
+func printFindingsText(w io.Writer, findings []nddpkg.Finding) error {
+	var b strings.Builder
+	for _, f := range findings {
+		sev := strings.ToUpper(string(f.Severity))
+		if loc := f.Location.String(); loc != "" {
+			fmt.Fprintf(&b, validateFindingLineFmt, sev, loc, f.Rule, f.Message)
+			continue
+		}
+		fmt.Fprintf(&b, validateFindingNoLocFmt, sev, f.Rule, f.Message)
+	}
+	fmt.Fprintf(&b, validateSummaryFmt, countFindings(findings, nddpkg.SeverityError), countFindings(findings, nddpkg.SeverityWarning))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func printFindingsJSON(w io.Writer, findings []nddpkg.Finding) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(struct {
+		Findings []nddpkg.Finding `json:"findings"`
+		Errors   int              `json:"errors"`
+		Warnings int              `json:"warnings"`
+	}{
+		Findings: findings,
+		Errors:   countFindings(findings, nddpkg.SeverityError),
+		Warnings: countFindings(findings, nddpkg.SeverityWarning),
+	})
+}
+
+func init() {
+	i := make([]string, 0)
+	packageCmd.AddCommand(validateCmd)
+	validateCmd.Flags().StringVarP(&validateOutput, "output", "o", validateOutputText, "Output format of the findings. One of text or json.")
+	validateCmd.Flags().StringSliceVarP(&validateIgnore, "Ignore", "", i, "Paths, specified relative to the package directory, to exclude from validation.")
+	validateCmd.Flags().StringVarP(&validateNddVersion, "NddVersion", "", version.New().GetVersionString(), "Ndd version the package must be compatible with. Defaults to the version of this plugin.")
+	addRegistryFlags(validateCmd)
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+)
+
+const (
+	errParseMaintenanceSchedule = "cannot parse maintenance window schedule"
+	errMaintenanceDuration      = "maintenance window duration must be positive"
+	errMaintenanceNever         = "maintenance window schedule never opens"
+)
+
+// isManual returns true if the package's revisions are activated manually.
+func isManual(p pkgv1.Package) bool {
+	return p.GetActivationPolicy() != nil && *p.GetActivationPolicy() == pkgv1.ManualActivation
+}
+
+// scheduleParser parses the standard five cron fields, without descriptors
+// such as @daily.
+var scheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// maintenanceWindowWait returns how long to wait from now until the supplied
+// maintenance window opens. Zero is returned if the window is currently open.
+// An error is returned if the window can never open.
+func maintenanceWindowWait(w *pkgv1.MaintenanceWindow, now time.Time) (time.Duration, error) {
+	sched, err := scheduleParser.Parse(w.Schedule)
+	if err != nil {
+		return 0, errors.Wrap(err, errParseMaintenanceSchedule)
+	}
+	if w.Duration.Duration <= 0 {
+		return 0, errors.New(errMaintenanceDuration)
+	}
+	now = now.UTC()
+	// The window is open if it last opened less than its duration ago.
+	open := sched.Next(now.Add(-w.Duration.Duration))
+	if open.IsZero() {
+		return 0, errors.New(errMaintenanceNever)
+	}
+	if !open.After(now) {
+		return 0, nil
+	}
+	return open.Sub(now), nil
+}
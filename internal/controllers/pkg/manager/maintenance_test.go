@@ -0,0 +1,79 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+)
+
+func TestMaintenanceWindowWait(t *testing.T) {
+	// A Saturday.
+	now := time.Date(2021, time.November, 6, 1, 0, 0, 0, time.UTC)
+
+	cases := map[string]struct {
+		reason  string
+		window  pkgv1.MaintenanceWindow
+		want    time.Duration
+		wantErr bool
+	}{
+		"Closed": {
+			reason: "The wait until a closed window next opens should be returned.",
+			window: pkgv1.MaintenanceWindow{Schedule: "0 2 * * 6", Duration: metav1.Duration{Duration: time.Hour}},
+			want:   time.Hour,
+		},
+		"Open": {
+			reason: "No wait should be returned while the window is open.",
+			window: pkgv1.MaintenanceWindow{Schedule: "30 0 * * 6", Duration: metav1.Duration{Duration: time.Hour}},
+		},
+		"InvalidSchedule": {
+			reason:  "A schedule that is not a cron expression should be rejected.",
+			window:  pkgv1.MaintenanceWindow{Schedule: "saturday 2am", Duration: metav1.Duration{Duration: time.Hour}},
+			wantErr: true,
+		},
+		"Descriptor": {
+			reason:  "A schedule that is not made of the standard five fields should be rejected.",
+			window:  pkgv1.MaintenanceWindow{Schedule: "@daily", Duration: metav1.Duration{Duration: time.Hour}},
+			wantErr: true,
+		},
+		"NeverOpens": {
+			reason:  "A schedule that never fires should be rejected rather than treated as open.",
+			window:  pkgv1.MaintenanceWindow{Schedule: "0 2 30 2 *", Duration: metav1.Duration{Duration: time.Hour}},
+			wantErr: true,
+		},
+		"NoDuration": {
+			reason:  "A window that is never open for any time should be rejected.",
+			window:  pkgv1.MaintenanceWindow{Schedule: "0 2 * * 6"},
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := maintenanceWindowWait(&tc.window, now)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("\n%s\nmaintenanceWindowWait(...): error %v, want error %t", tc.reason, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("\n%s\nmaintenanceWindowWait(...): got %s, want %s", tc.reason, got, tc.want)
+			}
+		})
+	}
+}
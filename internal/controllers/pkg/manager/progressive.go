@@ -0,0 +1,109 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-runtime/pkg/meta"
+)
+
+const (
+	// defaultHealthGatePeriod is used when a progressive activation does not
+	// specify a health gate period.
+	defaultHealthGatePeriod = 5 * time.Minute
+)
+
+// isProgressive returns true if the package activates its revisions
+// progressively.
+func isProgressive(p pkgv1.Package) bool {
+	return p.GetActivationPolicy() != nil && *p.GetActivationPolicy() == pkgv1.ProgressiveActivation
+}
+
+// activePredecessor returns the name of the active revision that precedes the
+// current revision while the current revision is not yet active, or an empty
+// string if there is none.
+func activePredecessor(revisions []pkgv1.PackageRevision, current string) string {
+	var prev pkgv1.PackageRevision
+	for _, rev := range revisions {
+		if rev.GetName() == current {
+			if rev.GetDesiredState() == pkgv1.PackageRevisionActive {
+				return ""
+			}
+			continue
+		}
+		if rev.GetDesiredState() != pkgv1.PackageRevisionActive {
+			continue
+		}
+		if prev == nil || rev.GetRevision() > prev.GetRevision() {
+			prev = rev
+		}
+	}
+	if prev == nil {
+		return ""
+	}
+	return prev.GetName()
+}
+
+// canaryReplicas returns the number of replicas a canary revision runs with.
+func canaryReplicas(p pkgv1.Package) *int32 {
+	if pa := p.GetProgressiveActivation(); pa != nil && pa.Replicas != nil {
+		return pa.Replicas
+	}
+	return pointer.Int32Ptr(1)
+}
+
+// healthGatePeriod returns the duration a canary revision must be healthy
+// before it is activated.
+func healthGatePeriod(p pkgv1.Package) time.Duration {
+	if pa := p.GetProgressiveActivation(); pa != nil && pa.HealthGatePeriod != nil {
+		return pa.HealthGatePeriod.Duration
+	}
+	return defaultHealthGatePeriod
+}
+
+// markCanary sets the desired state of pr to Canary, recording when it became
+// a canary.
+func markCanary(pr pkgv1.PackageRevision) {
+	if pr.GetDesiredState() == pkgv1.PackageRevisionCanary {
+		return
+	}
+	pr.SetDesiredState(pkgv1.PackageRevisionCanary)
+	meta.AddAnnotations(pr, map[string]string{pkgv1.CanarySinceAnnotation: time.Now().UTC().Format(time.RFC3339)})
+}
+
+// healthGateRemaining returns how long the canary revision pr must remain
+// healthy before it passes its health gates. A revision that is not healthy
+// always returns the full health gate period.
+func healthGateRemaining(p pkgv1.Package, pr pkgv1.PackageRevision) time.Duration {
+	c := pr.GetCondition(pkgv1.ConditionKindPackageHealthy)
+	if pr.GetDesiredState() != pkgv1.PackageRevisionCanary || c.Status != corev1.ConditionTrue {
+		return healthGatePeriod(p)
+	}
+	since, err := time.Parse(time.RFC3339, pr.GetAnnotations()[pkgv1.CanarySinceAnnotation])
+	if err != nil {
+		return healthGatePeriod(p)
+	}
+	if c.LastTransitionTime.Time.After(since) {
+		since = c.LastTransitionTime.Time
+	}
+	return healthGatePeriod(p) - time.Since(since)
+}
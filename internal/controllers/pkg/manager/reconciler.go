@@ -18,6 +18,7 @@ package manager
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"strings"
 	"time"
@@ -25,7 +26,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/yndd/ndd-runtime/pkg/meta"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -46,10 +46,10 @@ const (
 	pullWait      = 1 * time.Minute
 )
 
-func pullBasedRequeue(p *corev1.PullPolicy) reconcile.Result {
+func pullBasedRequeue(p *corev1.PullPolicy, interval time.Duration) reconcile.Result {
 	r := reconcile.Result{}
 	if p != nil && *p == corev1.PullAlways {
-		r.RequeueAfter = pullWait
+		r.RequeueAfter = interval
 	}
 	return r
 }
@@ -63,6 +63,9 @@ const (
 
 	errUpdateStatus                  = "cannot update package status"
 	errUpdateInactivePackageRevision = "cannot update inactive package revision"
+	errRollbackPackageRevision       = "cannot roll back to last healthy package revision"
+	errPromotePackageRevision        = "cannot deactivate package revision replaced by canary"
+	errMaintenanceWindow             = "cannot evaluate package maintenance window"
 
 	errUnhealthyPackageRevision     = "current package revision is unhealthy"
 	errUnknownPackageRevisionHealth = "current package revision health is unknown"
@@ -75,6 +78,9 @@ const (
 	reasonTransitionRevision event.Reason = "TransitionRevision"
 	reasonGarbageCollect     event.Reason = "GarbageCollect"
 	reasonInstall            event.Reason = "InstallPackageRevision"
+	reasonRollback           event.Reason = "RollbackRevision"
+	reasonPromote            event.Reason = "PromoteRevision"
+	reasonMaintenance        event.Reason = "AwaitMaintenanceWindow"
 )
 
 // ReconcilerOption is used to configure the Reconciler.
@@ -123,44 +129,77 @@ func WithRecorder(er event.Recorder) ReconcilerOption {
 	}
 }
 
+// WithPullInterval specifies the interval at which packages with a pull
+// policy of Always are polled for new images.
+func WithPullInterval(d time.Duration) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.pullInterval = d
+	}
+}
+
 // Reconciler reconciles packages.
 type Reconciler struct {
-	client resource.ClientApplicator
-	pkg    Revisioner
-	log    logging.Logger
-	record event.Recorder
+	client       resource.ClientApplicator
+	pkg          Revisioner
+	log          logging.Logger
+	record       event.Recorder
+	pullInterval time.Duration
 
 	newPackage             func() pkgv1.Package
 	newPackageRevision     func() pkgv1.PackageRevision
 	newPackageRevisionList func() pkgv1.PackageRevisionList
 }
 
-// Setup adds a controller that reconciles Providers.
-func Setup(mgr ctrl.Manager, l logging.Logger, namespace string) error {
+// Setup adds a controller that reconciles Providers. Providers are also
+// reconciled when the supplied PushTrigger, if any, is notified of an image
+// they refer to.
+func Setup(mgr ctrl.Manager, l logging.Logger, f nddpkg.Fetcher, s nddpkg.Sources, namespace string, t *PushTrigger) error {
 	name := "packages/" + strings.ToLower(pkgv1.ProviderGroupKind)
 	np := func() pkgv1.Package { return &pkgv1.Provider{} }
 	nr := func() pkgv1.PackageRevision { return &pkgv1.ProviderRevision{} }
 	nrl := func() pkgv1.PackageRevisionList { return &pkgv1.ProviderRevisionList{} }
 
-	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
-	if err != nil {
-		return errors.Wrap(err, "failed to initialize clientset")
-	}
-
 	r := NewReconciler(mgr,
 		WithNewPackageFn(np),
 		WithNewPackageRevisionFn(nr),
 		WithNewPackageRevisionListFn(nrl),
-		WithRevisioner(NewPackageRevisioner(nddpkg.NewK8sFetcher(clientset, namespace))),
+		WithRevisioner(NewPackageRevisioner(f, s)),
 		WithLogger(l.WithValues("controller", name)),
 		WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
+		WithPullInterval(t.pullInterval()),
 	)
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		For(&pkgv1.Provider{}).
-		Owns(&pkgv1.ProviderRevision{}).
-		Complete(r)
+		Owns(&pkgv1.ProviderRevision{})
+	return t.watch(b, np()).Complete(r)
+}
+
+// SetupIntent adds a controller that reconciles Intents. Intents are also
+// reconciled when the supplied PushTrigger, if any, is notified of an image
+// they refer to.
+func SetupIntent(mgr ctrl.Manager, l logging.Logger, f nddpkg.Fetcher, s nddpkg.Sources, namespace string, t *PushTrigger) error {
+	name := "packages/" + strings.ToLower(pkgv1.IntentGroupKind)
+	np := func() pkgv1.Package { return &pkgv1.Intent{} }
+	nr := func() pkgv1.PackageRevision { return &pkgv1.IntentRevision{} }
+	nrl := func() pkgv1.PackageRevisionList { return &pkgv1.IntentRevisionList{} }
+
+	r := NewReconciler(mgr,
+		WithNewPackageFn(np),
+		WithNewPackageRevisionFn(nr),
+		WithNewPackageRevisionListFn(nrl),
+		WithRevisioner(NewPackageRevisioner(f, s)),
+		WithLogger(l.WithValues("controller", name)),
+		WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
+		WithPullInterval(t.pullInterval()),
+	)
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(&pkgv1.Intent{}).
+		Owns(&pkgv1.IntentRevision{})
+	return t.watch(b, np()).Complete(r)
 }
 
 // NewReconciler creates a new package reconciler.
@@ -170,9 +209,10 @@ func NewReconciler(mgr ctrl.Manager, opts ...ReconcilerOption) *Reconciler {
 			Client:     mgr.GetClient(),
 			Applicator: resource.NewAPIPatchingApplicator(mgr.GetClient()),
 		},
-		pkg:    NewNopRevisioner(),
-		log:    logging.NewNopLogger(),
-		record: event.NewNopRecorder(),
+		pkg:          NewNopRevisioner(),
+		log:          logging.NewNopLogger(),
+		record:       event.NewNopRecorder(),
+		pullInterval: pullWait,
 	}
 
 	for _, f := range opts {
@@ -191,6 +231,12 @@ func NewReconciler(mgr ctrl.Manager, opts ...ReconcilerOption) *Reconciler {
 // +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=providers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=providers/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=providers/finalizers,verbs=update
+// +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=intentrevisions,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=intentrevisions/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=intentrevisions/finalizers,verbs=update
+// +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=intents,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=intents/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=intents/finalizers,verbs=update
 
 // Reconcile package.
 func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) { // nolint:gocyclo
@@ -243,6 +289,12 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		return reconcile.Result{RequeueAfter: veryShortWait}, errors.Wrap(r.client.Status().Update(ctx, p), errUpdateStatus)
 	}
 
+	revisions := prs.GetRevisions()
+
+	// If the package was rolled back from the revision its source resolves
+	// to, keep the rollback target as the current revision.
+	revisionName, rolledBack := pinnedRevision(p, revisionName, revisions)
+
 	// Set the current revision and identifier.
 	p.SetCurrentRevision(revisionName)
 	p.SetCurrentIdentifier(p.GetSource())
@@ -251,7 +303,39 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	maxRevision := int64(0)
 	oldestRevision := int64(math.MaxInt64)
 	oldestRevisionIndex := -1
-	revisions := prs.GetRevisions()
+
+	result := pullBasedRequeue(p.GetPackagePullPolicy(), r.pullInterval)
+
+	// Automatic activation of a new revision is deferred until the package's
+	// maintenance window opens, as long as a previous revision is active. An
+	// invalid window never opens; activation stays deferred, and the package
+	// reports why, until the window is fixed, which reconciles it again.
+	predecessor := activePredecessor(revisions, revisionName)
+	deferred := false
+	var windowErr error
+	if predecessor != "" && p.GetMaintenanceWindow() != nil && !isManual(p) {
+		wait, err := maintenanceWindowWait(p.GetMaintenanceWindow(), time.Now())
+		switch {
+		case err != nil:
+			windowErr = errors.Wrap(err, errMaintenanceWindow)
+			deferred = true
+			log.Debug(errMaintenanceWindow, "error", err)
+			r.record.Event(p, event.Warning(reasonMaintenance, windowErr))
+		case wait > 0:
+			deferred = true
+			r.record.Event(p, event.Normal(reasonMaintenance, fmt.Sprintf("Deferring activation of package revision %s until the maintenance window opens in %s", revisionName, wait.Round(time.Second))))
+			if result.RequeueAfter == 0 || wait < result.RequeueAfter {
+				result.RequeueAfter = wait
+			}
+		}
+	}
+
+	// The previously active revision keeps running while activation is
+	// deferred, or, with progressive activation, until the current revision
+	// has passed its health gates.
+	if !deferred && !isProgressive(p) {
+		predecessor = ""
+	}
 
 	// Check to see if revision already exists.
 	for index, rev := range revisions {
@@ -275,6 +359,9 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 			// non-current revisions are inactive.
 			continue
 		}
+		if rev.GetName() == predecessor {
+			continue
+		}
 		if rev.GetDesiredState() == pkgv1.PackageRevisionActive {
 			// If revision is not the current revision, set to inactive. This
 			// should always be done, regardless of the package's revision
@@ -293,10 +380,14 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		pr.SetRevision(maxRevision + 1)
 	}
 
-	// Check to see if there are revisions eligible for garbage collection.
+	// Check to see if there are revisions eligible for garbage collection. The
+	// last healthy revision is kept as long as it is a rollback target, and
+	// the predecessor of a canary as long as it is active.
 	if p.GetRevisionHistoryLimit() != nil &&
 		*p.GetRevisionHistoryLimit() != 0 &&
-		len(revisions) > (int(*p.GetRevisionHistoryLimit())+1) {
+		len(revisions) > (int(*p.GetRevisionHistoryLimit())+1) &&
+		revisions[oldestRevisionIndex].GetName() != predecessor &&
+		!(p.GetRollbackPolicy() != nil && revisions[oldestRevisionIndex].GetName() == p.GetLastHealthyRevision()) {
 		gcRev := revisions[oldestRevisionIndex]
 		// Find the oldest revision and delete it.
 		if err := r.client.Delete(ctx, gcRev); err != nil {
@@ -306,13 +397,37 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		}
 	}
 
+	// Surface whether the package of the current revision is compatible with
+	// the Ndd version, once the revision has checked it.
+	if c := pr.GetCondition(pkgv1.ConditionKindCompatible); c.Status != corev1.ConditionUnknown {
+		p.SetConditions(c)
+	}
 	if pr.GetCondition(pkgv1.ConditionKindPackageHealthy).Status == corev1.ConditionTrue {
 		p.SetConditions(pkgv1.Healthy())
+		if pr.GetDesiredState() == pkgv1.PackageRevisionActive {
+			p.SetLastHealthyRevision(pr.GetName())
+		}
 		r.record.Event(p, event.Normal(reasonInstall, "Successfully installed package revision"))
 	}
 	if pr.GetCondition(pkgv1.ConditionKindPackageHealthy).Status == corev1.ConditionFalse {
 		p.SetConditions(pkgv1.Unhealthy())
 		r.record.Event(p, event.Warning(reasonInstall, errors.New(errUnhealthyPackageRevision)))
+
+		// Roll back to the last healthy revision right away if the current
+		// revision refused to be activated, or once it has been unhealthy for
+		// longer than the failure window.
+		if target, reason := refusedTarget(p, pr, revisions); target != nil {
+			return r.rollback(ctx, log, p, pr, target, reason)
+		}
+		if target, wait := rollbackTarget(p, pr, revisions); target != nil {
+			if wait <= 0 {
+				reason := fmt.Sprintf("package revision %s was unhealthy for longer than %s", pr.GetName(), failureWindow(p.GetRollbackPolicy()))
+				return r.rollback(ctx, log, p, pr, target, reason)
+			}
+			if result.RequeueAfter == 0 || wait < result.RequeueAfter {
+				result.RequeueAfter = wait
+			}
+		}
 	}
 	if pr.GetCondition(pkgv1.ConditionKindPackageHealthy).Status == corev1.ConditionUnknown {
 		p.SetConditions(pkgv1.UnknownHealth())
@@ -330,7 +445,11 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	}
 	pr.SetLabels(labels)
 	pr.SetRevisionKind(p.GetKind())
-	pr.SetSource(p.GetSource())
+	// A revision that was rolled back to keeps the source it was created
+	// from.
+	if !rolledBack {
+		pr.SetSource(packageImage(p))
+	}
 	pr.SetPackagePullPolicy(p.GetPackagePullPolicy())
 	pr.SetPackagePullSecrets(p.GetPackagePullSecrets())
 	pr.SetSkipDependencyResolution(p.GetSkipDependencyResolution())
@@ -339,10 +458,38 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	log.Debug("manager state", "state", pr.GetDesiredState(), "activation policy", p.GetActivationPolicy())
 	// If current revision is not active and we have an automatic or undefined
 	// activation policy, always activate.
-	if pr.GetDesiredState() != pkgv1.PackageRevisionActive && (p.GetActivationPolicy() == nil || *p.GetActivationPolicy() == pkgv1.AutomaticActivation) {
+	if !deferred && pr.GetDesiredState() != pkgv1.PackageRevisionActive && (p.GetActivationPolicy() == nil || *p.GetActivationPolicy() == pkgv1.AutomaticActivation) {
 		pr.SetDesiredState(pkgv1.PackageRevisionActive)
 	}
 
+	// If the current revision is not active and we have a progressive
+	// activation policy, run it as a canary next to its predecessor and only
+	// activate it once it passes its health gates. Without a predecessor
+	// there is nothing to progress from, so we activate directly.
+	if !deferred && pr.GetDesiredState() != pkgv1.PackageRevisionActive && isProgressive(p) {
+		pr.SetCanaryReplicas(canaryReplicas(p))
+		prev := findRevision(revisions, predecessor)
+		wait := healthGateRemaining(p, pr)
+		switch {
+		case prev == nil:
+			pr.SetDesiredState(pkgv1.PackageRevisionActive)
+		case wait <= 0:
+			prev.SetDesiredState(pkgv1.PackageRevisionInactive)
+			if err := r.client.Apply(ctx, prev, resource.MustBeControllableBy(p.GetUID())); err != nil {
+				log.Debug(errPromotePackageRevision, "error", err)
+				r.record.Event(p, event.Warning(reasonPromote, errors.Wrap(err, errPromotePackageRevision)))
+				return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.client.Status().Update(ctx, p), errUpdateStatus)
+			}
+			pr.SetDesiredState(pkgv1.PackageRevisionActive)
+			r.record.Event(p, event.Normal(reasonPromote, fmt.Sprintf("Promoted package revision %s, replacing %s", pr.GetName(), prev.GetName())))
+		default:
+			markCanary(pr)
+			if result.RequeueAfter == 0 || wait < result.RequeueAfter {
+				result.RequeueAfter = wait
+			}
+		}
+	}
+
 	controlRef := meta.AsController(meta.TypedReferenceTo(p, p.GetObjectKind().GroupVersionKind()))
 	controlRef.BlockOwnerDeletion = pointer.BoolPtr(true)
 	meta.AddOwnerReference(pr, controlRef)
@@ -355,8 +502,18 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 
 	p.SetConditions(pkgv1.Active())
 
-	// If current revision is still not active, the package is inactive.
-	if pr.GetDesiredState() != pkgv1.PackageRevisionActive {
+	// If current revision is still not active, the package is inactive,
+	// waiting for its canary to pass its health gates or waiting for its
+	// maintenance window.
+	switch {
+	case pr.GetDesiredState() == pkgv1.PackageRevisionActive:
+	case pr.GetDesiredState() == pkgv1.PackageRevisionCanary:
+		p.SetConditions(pkgv1.Canary())
+	case windowErr != nil:
+		p.SetConditions(pkgv1.InvalidMaintenanceWindow(windowErr.Error()))
+	case deferred:
+		p.SetConditions(pkgv1.AwaitingMaintenanceWindow())
+	default:
 		p.SetConditions(pkgv1.Inactive())
 	}
 
@@ -364,5 +521,5 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	// package, the health of the package is not set until the revision reports
 	// its health. If updating from an existing revision, the package health
 	// will match the health of the old revision until the next reconcile.
-	return pullBasedRequeue(p.GetPackagePullPolicy()), errors.Wrap(r.client.Status().Update(ctx, p), errUpdateStatus)
+	return result, errors.Wrap(r.client.Status().Update(ctx, p), errUpdateStatus)
 }
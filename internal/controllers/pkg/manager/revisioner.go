@@ -29,7 +29,10 @@ import (
 )
 
 const (
-	errFetchPackage = "failed to fetch package digest from remote"
+	errFetchPackage        = "failed to fetch package digest from remote"
+	errFetchTags           = "failed to fetch package tags from remote"
+	errNoMatchingVersion   = "no package version matches the version constraint"
+	errPullNeverConstraint = "a package with a version constraint cannot have a pull policy of Never"
 )
 
 // Revisioner extracts a revision name for a package source.
@@ -40,38 +43,100 @@ type Revisioner interface {
 // PackageRevisioner extracts a revision name for a package source.
 type PackageRevisioner struct {
 	fetcher nddpkg.Fetcher
+	sources nddpkg.Sources
 }
 
-// NewPackageRevisioner returns a new PackageRevisioner.
-func NewPackageRevisioner(fetcher nddpkg.Fetcher) *PackageRevisioner {
+// NewPackageRevisioner returns a new PackageRevisioner. Packages whose source
+// is not an OCI image reference are looked up in the supplied sources.
+func NewPackageRevisioner(fetcher nddpkg.Fetcher, sources nddpkg.Sources) *PackageRevisioner {
 	return &PackageRevisioner{
 		fetcher: fetcher,
+		sources: sources,
 	}
 }
 
-// Revision extracts a revision name for a package source.
+// Revision extracts a revision name for a package source. If the source
+// carries a semantic version constraint, the package image it resolves to is
+// recorded on the package.
 func (r *PackageRevisioner) Revision(ctx context.Context, log logging.Logger, p v1.Package) (string, error) {
 	pullPolicy := p.GetPackagePullPolicy()
 	if pullPolicy != nil && *pullPolicy == corev1.PullNever {
+		// A version constraint can only be resolved by listing the tags of
+		// its repository.
+		if _, _, ok := nddpkg.ParseSourceConstraint(p.GetSource()); ok {
+			return "", errors.Errorf("%s: %s", errPullNeverConstraint, p.GetSource())
+		}
 		return nddpkg.FriendlyID(p.GetName(), p.GetSource()), nil
 	}
+	// A version constraint is resolved before the pull policy is considered,
+	// since a new version matching it changes the package image even though
+	// the source stays the same.
+	resolved := p.GetResolvedPackage()
+	source, err := r.resolve(ctx, p)
+	if err != nil {
+		return "", err
+	}
 	if pullPolicy != nil && *pullPolicy == corev1.PullIfNotPresent {
-		if p.GetCurrentIdentifier() == p.GetSource() {
+		if p.GetCurrentIdentifier() == p.GetSource() && p.GetResolvedPackage() == resolved {
 			return p.GetCurrentRevision(), nil
 		}
 	}
-	ref, err := name.ParseReference(p.GetSource())
+	if _, ok := nddpkg.ParseSourceURL(source); ok {
+		d, err := r.sources.Head(ctx, source)
+		if err != nil {
+			return "", errors.Wrap(err, errFetchPackage)
+		}
+		return nddpkg.FriendlyID(p.GetName(), d.Digest.Hex), nil
+	}
+	ref, err := name.ParseReference(source)
 	if err != nil {
 		return "", err
 	}
 	log.Debug("Head fetcher", "Source", p.GetSource(), "CurrentIdentifier", p.GetCurrentIdentifier())
 	d, err := r.fetcher.Head(ctx, ref, v1.RefNames(p.GetPackagePullSecrets())...)
-	if err != nil || d == nil {
+	if err != nil {
 		return "", errors.Wrap(err, errFetchPackage)
 	}
+	if d == nil {
+		return "", errors.New(errFetchPackage)
+	}
 	return nddpkg.FriendlyID(p.GetName(), d.Digest.Hex), nil
 }
 
+// resolve returns the package image a package source refers to. A source with
+// a semantic version constraint resolves to the highest matching version tag.
+func (r *PackageRevisioner) resolve(ctx context.Context, p v1.Package) (string, error) {
+	repo, c, ok := nddpkg.ParseSourceConstraint(p.GetSource())
+	if !ok {
+		p.SetResolvedPackage("")
+		return p.GetSource(), nil
+	}
+	ref, err := name.ParseReference(repo)
+	if err != nil {
+		return "", err
+	}
+	tags, err := r.fetcher.Tags(ctx, ref, v1.RefNames(p.GetPackagePullSecrets())...)
+	if err != nil {
+		return "", errors.Wrap(err, errFetchTags)
+	}
+	tag := nddpkg.LatestVersion(tags, c)
+	if tag == "" {
+		return "", errors.Errorf("%s: %s", errNoMatchingVersion, p.GetSource())
+	}
+	source := repo + ":" + tag
+	p.SetResolvedPackage(source)
+	return source, nil
+}
+
+// packageImage returns the package image revisions of the package are created
+// from.
+func packageImage(p v1.Package) string {
+	if rp := p.GetResolvedPackage(); rp != "" {
+		return rp
+	}
+	return p.GetSource()
+}
+
 // NopRevisioner returns an empty revision name.
 type NopRevisioner struct{}
 
@@ -0,0 +1,170 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-core/internal/nddpkg"
+)
+
+// tagFetcher serves the tags of a single repository. The digest of each tag
+// is looked up in digests; a tag without a digest has no descriptor.
+type tagFetcher struct {
+	nddpkg.Fetcher
+	tags    []string
+	digests map[string]string
+	err     error
+}
+
+func (f *tagFetcher) Tags(_ context.Context, _ name.Reference, _ ...string) ([]string, error) {
+	return f.tags, f.err
+}
+
+func (f *tagFetcher) Head(_ context.Context, ref name.Reference, _ ...string) (*regv1.Descriptor, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	hex, ok := f.digests[ref.Identifier()]
+	if !ok {
+		return nil, nil
+	}
+	return &regv1.Descriptor{Digest: regv1.Hash{Algorithm: "sha256", Hex: hex}}, nil
+}
+
+func TestPackageRevisionerRevision(t *testing.T) {
+	always := corev1.PullAlways
+	ifNotPresent := corev1.PullIfNotPresent
+	never := corev1.PullNever
+	fetcher := &tagFetcher{
+		tags:    []string{"v0.1.0", "v0.1.1", "v0.2.0", "latest"},
+		digests: map[string]string{"v0.1.0": "a010", "v0.1.1": "a011", "v0.2.0": "a020"},
+	}
+
+	type args struct {
+		fetcher nddpkg.Fetcher
+		source  string
+		policy  *corev1.PullPolicy
+		// current is the source and revision the package was last
+		// reconciled with, and resolved the image its source resolved to.
+		current  string
+		revision string
+		resolved string
+	}
+	type want struct {
+		revision string
+		resolved string
+		err      bool
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Tag": {
+			reason: "A tagged source should return the revision of its digest.",
+			args:   args{fetcher: fetcher, source: "registry.lab/yndd/pkg:v0.1.0", policy: &always},
+			want:   want{revision: "pkg-a010"},
+		},
+		"TagIfNotPresent": {
+			reason: "A tagged source that did not change should keep its revision without contacting the registry.",
+			args: args{
+				fetcher: &tagFetcher{err: errors.New("boom")},
+				source:  "registry.lab/yndd/pkg:v0.1.0", policy: &ifNotPresent,
+				current: "registry.lab/yndd/pkg:v0.1.0", revision: "pkg-a010",
+			},
+			want: want{revision: "pkg-a010"},
+		},
+		"Constraint": {
+			reason: "A source with a version constraint should return the revision of the highest matching version.",
+			args:   args{fetcher: fetcher, source: "registry.lab/yndd/pkg:~0.1", policy: &always},
+			want:   want{revision: "pkg-a011", resolved: "registry.lab/yndd/pkg:v0.1.1"},
+		},
+		"ConstraintIfNotPresentNewVersion": {
+			reason: "A source with a version constraint should pick up a new matching version even if the pull policy is IfNotPresent.",
+			args: args{
+				fetcher: fetcher, source: "registry.lab/yndd/pkg:~0.1", policy: &ifNotPresent,
+				current: "registry.lab/yndd/pkg:~0.1", revision: "pkg-a010", resolved: "registry.lab/yndd/pkg:v0.1.0",
+			},
+			want: want{revision: "pkg-a011", resolved: "registry.lab/yndd/pkg:v0.1.1"},
+		},
+		"ConstraintIfNotPresentUnchanged": {
+			reason: "A source with a version constraint that still resolves to the same version should keep its revision.",
+			args: args{
+				fetcher: &tagFetcher{tags: fetcher.tags},
+				source:  "registry.lab/yndd/pkg:~0.1", policy: &ifNotPresent,
+				current: "registry.lab/yndd/pkg:~0.1", revision: "pkg-a011", resolved: "registry.lab/yndd/pkg:v0.1.1",
+			},
+			want: want{revision: "pkg-a011", resolved: "registry.lab/yndd/pkg:v0.1.1"},
+		},
+		"NoMatchingVersion": {
+			reason: "A source with a version constraint no tag satisfies should return an error.",
+			args:   args{fetcher: fetcher, source: "registry.lab/yndd/pkg:>=1.0.0", policy: &always},
+			want:   want{err: true},
+		},
+		"TagsFailed": {
+			reason: "A failure to list the tags of a constrained source should return an error.",
+			args:   args{fetcher: &tagFetcher{err: errors.New("boom")}, source: "registry.lab/yndd/pkg:~0.1", policy: &ifNotPresent},
+			want:   want{err: true},
+		},
+		"NoDescriptor": {
+			reason: "A registry that returns no descriptor should return an error rather than no revision.",
+			args:   args{fetcher: fetcher, source: "registry.lab/yndd/pkg:latest", policy: &always},
+			want:   want{err: true},
+		},
+		"PullNever": {
+			reason: "A source with a pull policy of Never should return a revision derived from the source.",
+			args:   args{fetcher: &tagFetcher{err: errors.New("boom")}, source: "registry.lab/yndd/pkg:v0.1.0", policy: &never},
+			want:   want{revision: nddpkg.FriendlyID("pkg", "registry.lab/yndd/pkg:v0.1.0")},
+		},
+		"PullNeverConstraint": {
+			reason: "A source with a version constraint cannot be resolved without pulling and should be rejected.",
+			args:   args{fetcher: fetcher, source: "registry.lab/yndd/pkg:~0.1", policy: &never},
+			want:   want{err: true},
+		},
+	}
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			p := &pkgv1.Provider{ObjectMeta: metav1.ObjectMeta{Name: "pkg"}}
+			p.SetSource(tc.args.source)
+			p.SetPackagePullPolicy(tc.args.policy)
+			p.SetCurrentIdentifier(tc.args.current)
+			p.SetCurrentRevision(tc.args.revision)
+			p.SetResolvedPackage(tc.args.resolved)
+
+			got, err := NewPackageRevisioner(tc.args.fetcher, nil).Revision(context.Background(), logging.NewNopLogger(), p)
+			if (err != nil) != tc.want.err {
+				t.Fatalf("\n%s\nRevision(...): error %v, want error %t", tc.reason, err, tc.want.err)
+			}
+			if got != tc.want.revision {
+				t.Errorf("\n%s\nRevision(...): got revision %q, want %q", tc.reason, got, tc.want.revision)
+			}
+			if !tc.want.err && p.GetResolvedPackage() != tc.want.resolved {
+				t.Errorf("\n%s\nRevision(...): got resolved package %q, want %q", tc.reason, p.GetResolvedPackage(), tc.want.resolved)
+			}
+		})
+	}
+}
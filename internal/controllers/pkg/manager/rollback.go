@@ -0,0 +1,174 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-runtime/pkg/event"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/ndd-runtime/pkg/resource"
+)
+
+const (
+	// defaultFailureWindow is used when a rollback policy does not specify a
+	// failure window.
+	defaultFailureWindow = 5 * time.Minute
+)
+
+// findRevision returns the revision with the supplied name, or nil if it does
+// not exist.
+func findRevision(revisions []pkgv1.PackageRevision, name string) pkgv1.PackageRevision {
+	for _, rev := range revisions {
+		if rev.GetName() == name {
+			return rev
+		}
+	}
+	return nil
+}
+
+// failureWindow returns the duration a revision may be unhealthy before it is
+// rolled back.
+func failureWindow(rp *pkgv1.RollbackPolicy) time.Duration {
+	if rp.FailureWindow == nil {
+		return defaultFailureWindow
+	}
+	return rp.FailureWindow.Duration
+}
+
+// rollbackTarget returns the revision the unhealthy revision pr should be
+// rolled back to, and how long to wait before doing so. A nil revision is
+// returned if the package has no rollback policy or no eligible target.
+func rollbackTarget(p pkgv1.Package, pr pkgv1.PackageRevision, revisions []pkgv1.PackageRevision) (pkgv1.PackageRevision, time.Duration) {
+	if p.GetRollbackPolicy() == nil || pr.GetDesiredState() != pkgv1.PackageRevisionActive {
+		return nil, 0
+	}
+	last := p.GetLastHealthyRevision()
+	if last == "" || last == pr.GetName() {
+		return nil, 0
+	}
+	target := findRevision(revisions, last)
+	if target == nil {
+		return nil, 0
+	}
+	unhealthySince := pr.GetCondition(pkgv1.ConditionKindPackageHealthy).LastTransitionTime.Time
+	return target, failureWindow(p.GetRollbackPolicy()) - time.Since(unhealthySince)
+}
+
+// refusal returns why the revision pr refused to be activated, or an empty
+// string if it did not. A revision refuses activation if it would break
+// installed CRDs, if its package is not signed by a trusted key or if its
+// package is not compatible with the Ndd version.
+func refusal(pr pkgv1.PackageRevision) string {
+	if c := pr.GetCondition(pkgv1.ConditionKindSignatureVerified); c.Status == corev1.ConditionFalse {
+		return fmt.Sprintf("package revision %s is not signed by a trusted key: %s", pr.GetName(), c.Message)
+	}
+	if c := pr.GetCondition(pkgv1.ConditionKindCompatible); c.Status == corev1.ConditionFalse {
+		return fmt.Sprintf("package revision %s is not compatible with the Ndd version: %s", pr.GetName(), c.Message)
+	}
+	if c := pr.GetCondition(pkgv1.ConditionKindPackageHealthy); c.Reason == pkgv1.ConditionReasonBreakingChange {
+		return fmt.Sprintf("package revision %s would break installed CRDs: %s", pr.GetName(), c.Message)
+	}
+	return ""
+}
+
+// refusedTarget returns the revision the revision pr should be rolled back to
+// because it refused to be activated, and why. A nil revision is returned if
+// the package has no rollback policy, pr did not refuse activation or there
+// is no eligible target. Such a revision is rolled back without waiting for
+// the failure window, since it never took over from its predecessor.
+func refusedTarget(p pkgv1.Package, pr pkgv1.PackageRevision, revisions []pkgv1.PackageRevision) (pkgv1.PackageRevision, string) {
+	if p.GetRollbackPolicy() == nil || pr.GetDesiredState() != pkgv1.PackageRevisionActive {
+		return nil, ""
+	}
+	reason := refusal(pr)
+	if reason == "" {
+		return nil, ""
+	}
+	last := p.GetLastHealthyRevision()
+	if last == "" || last == pr.GetName() {
+		return nil, ""
+	}
+	return findRevision(revisions, last), reason
+}
+
+// pinnedRevision returns the revision the package was rolled back to if its
+// source still resolves to the revision that was rolled back from, or to the
+// rollback target itself, and true. The package stays on the rollback target
+// until its source resolves to a different revision, or the revision that was
+// rolled back from is annotated to allow breaking changes. Otherwise the
+// supplied revision name and false are returned.
+func pinnedRevision(p pkgv1.Package, revisionName string, revisions []pkgv1.PackageRevision) (string, bool) {
+	rb := p.GetLastRollback()
+	if rb == nil || (rb.FromRevision != revisionName && rb.ToRevision != revisionName) {
+		return revisionName, false
+	}
+	if rb.FromRevision == revisionName && allowsBreakingChanges(findRevision(revisions, revisionName)) {
+		return revisionName, false
+	}
+	if findRevision(revisions, rb.ToRevision) == nil {
+		return revisionName, false
+	}
+	return rb.ToRevision, true
+}
+
+// allowsBreakingChanges returns true if the revision is annotated to allow
+// breaking changes to installed CRDs and its package is not refused for
+// another reason.
+func allowsBreakingChanges(pr pkgv1.PackageRevision) bool {
+	return pr != nil &&
+		pr.GetAnnotations()[pkgv1.AllowBreakingChangesAnnotation] == "true" &&
+		pr.GetCondition(pkgv1.ConditionKindSignatureVerified).Status != corev1.ConditionFalse
+}
+
+// rollback deactivates the unhealthy revision and reactivates the supplied
+// previously healthy revision.
+func (r *Reconciler) rollback(ctx context.Context, log logging.Logger, p pkgv1.Package, from, to pkgv1.PackageRevision, reason string) (reconcile.Result, error) {
+	from.SetDesiredState(pkgv1.PackageRevisionInactive)
+	if err := r.client.Apply(ctx, from, resource.MustBeControllableBy(p.GetUID())); err != nil {
+		log.Debug(errUpdateInactivePackageRevision, "error", err)
+		r.record.Event(p, event.Warning(reasonRollback, errors.Wrap(err, errUpdateInactivePackageRevision)))
+		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.client.Status().Update(ctx, p), errUpdateStatus)
+	}
+
+	to.SetDesiredState(pkgv1.PackageRevisionActive)
+	if err := r.client.Apply(ctx, to, resource.MustBeControllableBy(p.GetUID())); err != nil {
+		log.Debug(errRollbackPackageRevision, "error", err)
+		r.record.Event(p, event.Warning(reasonRollback, errors.Wrap(err, errRollbackPackageRevision)))
+		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.client.Status().Update(ctx, p), errUpdateStatus)
+	}
+
+	p.SetLastRollback(&pkgv1.PackageRollback{
+		FromRevision: from.GetName(),
+		ToRevision:   to.GetName(),
+		Reason:       reason,
+		Time:         metav1.Now(),
+	})
+	p.SetCurrentRevision(to.GetName())
+
+	log.Debug("rolled back package revision", "from", from.GetName(), "to", to.GetName())
+	r.record.Event(p, event.Normal(reasonRollback, fmt.Sprintf("Rolled back to package revision %s: %s", to.GetName(), reason)))
+	return reconcile.Result{RequeueAfter: veryShortWait}, errors.Wrap(r.client.Status().Update(ctx, p), errUpdateStatus)
+}
@@ -0,0 +1,305 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"testing"
+	"time"
+
+	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+)
+
+// pkgRevision returns a revision of the package "pkg" with the supplied name,
+// desired state and conditions.
+func pkgRevision(name string, state pkgv1.PackageRevisionDesiredState, c ...nddv1.Condition) *pkgv1.ProviderRevision {
+	pr := &pkgv1.ProviderRevision{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	pr.SetDesiredState(state)
+	pr.SetConditions(c...)
+	return pr
+}
+
+// unhealthyFor returns an Unhealthy condition that transitioned the supplied
+// duration ago.
+func unhealthyFor(d time.Duration) nddv1.Condition {
+	c := pkgv1.Unhealthy()
+	c.LastTransitionTime = metav1.NewTime(time.Now().Add(-d))
+	return c
+}
+
+// pkg returns the package "pkg" with the supplied rollback policy and last
+// healthy revision.
+func pkg(rp *pkgv1.RollbackPolicy, lastHealthy string) *pkgv1.Provider {
+	p := &pkgv1.Provider{ObjectMeta: metav1.ObjectMeta{Name: "pkg"}}
+	p.SetRollbackPolicy(rp)
+	p.SetLastHealthyRevision(lastHealthy)
+	return p
+}
+
+func TestFailureWindow(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		rp     *pkgv1.RollbackPolicy
+		want   time.Duration
+	}{
+		"Default": {
+			reason: "A policy without a failure window should use the default window.",
+			rp:     &pkgv1.RollbackPolicy{},
+			want:   defaultFailureWindow,
+		},
+		"Specified": {
+			reason: "The failure window of the policy should be used.",
+			rp:     &pkgv1.RollbackPolicy{FailureWindow: &metav1.Duration{Duration: time.Minute}},
+			want:   time.Minute,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := failureWindow(tc.rp); got != tc.want {
+				t.Errorf("\n%s\nfailureWindow(...): got %s, want %s", tc.reason, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRollbackTarget(t *testing.T) {
+	policy := &pkgv1.RollbackPolicy{FailureWindow: &metav1.Duration{Duration: 5 * time.Minute}}
+	healthy := pkgRevision("pkg-1", pkgv1.PackageRevisionInactive, pkgv1.Healthy())
+
+	cases := map[string]struct {
+		reason    string
+		p         *pkgv1.Provider
+		pr        *pkgv1.ProviderRevision
+		revisions []pkgv1.PackageRevision
+		want      string
+		// wantWait is true if the rollback should wait for the failure
+		// window to pass.
+		wantWait bool
+	}{
+		"InsideWindow": {
+			reason:    "A revision unhealthy for less than the failure window should be rolled back once the window passes.",
+			p:         pkg(policy, "pkg-1"),
+			pr:        pkgRevision("pkg-2", pkgv1.PackageRevisionActive, unhealthyFor(time.Minute)),
+			revisions: []pkgv1.PackageRevision{healthy},
+			want:      "pkg-1",
+			wantWait:  true,
+		},
+		"OutsideWindow": {
+			reason:    "A revision unhealthy for longer than the failure window should be rolled back right away.",
+			p:         pkg(policy, "pkg-1"),
+			pr:        pkgRevision("pkg-2", pkgv1.PackageRevisionActive, unhealthyFor(10*time.Minute)),
+			revisions: []pkgv1.PackageRevision{healthy},
+			want:      "pkg-1",
+		},
+		"NoPolicy": {
+			reason:    "A package without a rollback policy should never be rolled back.",
+			p:         pkg(nil, "pkg-1"),
+			pr:        pkgRevision("pkg-2", pkgv1.PackageRevisionActive, unhealthyFor(10*time.Minute)),
+			revisions: []pkgv1.PackageRevision{healthy},
+		},
+		"NoHealthyPredecessor": {
+			reason: "A package that was never healthy has nothing to roll back to.",
+			p:      pkg(policy, ""),
+			pr:     pkgRevision("pkg-2", pkgv1.PackageRevisionActive, unhealthyFor(10*time.Minute)),
+		},
+		"LastHealthyIsCurrent": {
+			reason: "A revision that was the last healthy revision has no predecessor to roll back to.",
+			p:      pkg(policy, "pkg-2"),
+			pr:     pkgRevision("pkg-2", pkgv1.PackageRevisionActive, unhealthyFor(10*time.Minute)),
+		},
+		"LastHealthyDeleted": {
+			reason: "A last healthy revision that no longer exists cannot be rolled back to.",
+			p:      pkg(policy, "pkg-1"),
+			pr:     pkgRevision("pkg-2", pkgv1.PackageRevisionActive, unhealthyFor(10*time.Minute)),
+		},
+		"Inactive": {
+			reason:    "An inactive revision never took over and should not be rolled back.",
+			p:         pkg(policy, "pkg-1"),
+			pr:        pkgRevision("pkg-2", pkgv1.PackageRevisionInactive, unhealthyFor(10*time.Minute)),
+			revisions: []pkgv1.PackageRevision{healthy},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			target, wait := rollbackTarget(tc.p, tc.pr, tc.revisions)
+			got := ""
+			if target != nil {
+				got = target.GetName()
+			}
+			if got != tc.want {
+				t.Errorf("\n%s\nrollbackTarget(...): got target %q, want %q", tc.reason, got, tc.want)
+			}
+			if tc.want != "" && (wait > 0) != tc.wantWait {
+				t.Errorf("\n%s\nrollbackTarget(...): got wait %s, want wait %t", tc.reason, wait, tc.wantWait)
+			}
+		})
+	}
+}
+
+func TestRefusedTarget(t *testing.T) {
+	policy := &pkgv1.RollbackPolicy{}
+	healthy := pkgRevision("pkg-1", pkgv1.PackageRevisionInactive, pkgv1.Healthy())
+
+	cases := map[string]struct {
+		reason    string
+		p         *pkgv1.Provider
+		pr        *pkgv1.ProviderRevision
+		revisions []pkgv1.PackageRevision
+		want      string
+	}{
+		"BreakingChange": {
+			reason:    "A revision that would break installed CRDs should be rolled back without waiting.",
+			p:         pkg(policy, "pkg-1"),
+			pr:        pkgRevision("pkg-2", pkgv1.PackageRevisionActive, pkgv1.BreakingSchemaChange("removed version v1")),
+			revisions: []pkgv1.PackageRevision{healthy},
+			want:      "pkg-1",
+		},
+		"Unsigned": {
+			reason:    "A revision whose package is not signed by a trusted key should be rolled back without waiting.",
+			p:         pkg(policy, "pkg-1"),
+			pr:        pkgRevision("pkg-2", pkgv1.PackageRevisionActive, pkgv1.SignatureUnverified("no trusted signature"), pkgv1.Unhealthy()),
+			revisions: []pkgv1.PackageRevision{healthy},
+			want:      "pkg-1",
+		},
+		"Incompatible": {
+			reason:    "A revision whose package is not compatible with the Ndd version should be rolled back without waiting.",
+			p:         pkg(policy, "pkg-1"),
+			pr:        pkgRevision("pkg-2", pkgv1.PackageRevisionActive, pkgv1.Incompatible("requires ndd >= v1.0.0"), pkgv1.Unhealthy()),
+			revisions: []pkgv1.PackageRevision{healthy},
+			want:      "pkg-1",
+		},
+		"NoPolicy": {
+			reason:    "A package without a rollback policy should not be rolled back, even if its revision refused activation.",
+			p:         pkg(nil, "pkg-1"),
+			pr:        pkgRevision("pkg-2", pkgv1.PackageRevisionActive, pkgv1.BreakingSchemaChange("removed version v1")),
+			revisions: []pkgv1.PackageRevision{healthy},
+		},
+		"NotRefused": {
+			reason:    "A revision that is merely unhealthy should wait for the failure window.",
+			p:         pkg(policy, "pkg-1"),
+			pr:        pkgRevision("pkg-2", pkgv1.PackageRevisionActive, pkgv1.Unhealthy()),
+			revisions: []pkgv1.PackageRevision{healthy},
+		},
+		"NoHealthyPredecessor": {
+			reason: "A package that was never healthy has nothing to roll back to.",
+			p:      pkg(policy, ""),
+			pr:     pkgRevision("pkg-2", pkgv1.PackageRevisionActive, pkgv1.BreakingSchemaChange("removed version v1")),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			target, reason := refusedTarget(tc.p, tc.pr, tc.revisions)
+			got := ""
+			if target != nil {
+				got = target.GetName()
+			}
+			if got != tc.want {
+				t.Errorf("\n%s\nrefusedTarget(...): got target %q, want %q", tc.reason, got, tc.want)
+			}
+			if got != "" && reason == "" {
+				t.Errorf("\n%s\nrefusedTarget(...): got no reason for rolling back", tc.reason)
+			}
+		})
+	}
+}
+
+func TestPinnedRevision(t *testing.T) {
+	rolledBack := func() *pkgv1.Provider {
+		p := pkg(&pkgv1.RollbackPolicy{}, "pkg-1")
+		p.SetLastRollback(&pkgv1.PackageRollback{FromRevision: "pkg-2", ToRevision: "pkg-1"})
+		return p
+	}
+	allowed := pkgRevision("pkg-2", pkgv1.PackageRevisionInactive, pkgv1.BreakingSchemaChange("removed version v1"))
+	allowed.SetAnnotations(map[string]string{pkgv1.AllowBreakingChangesAnnotation: "true"})
+	unsigned := pkgRevision("pkg-2", pkgv1.PackageRevisionInactive, pkgv1.SignatureUnverified("no trusted signature"))
+	unsigned.SetAnnotations(map[string]string{pkgv1.AllowBreakingChangesAnnotation: "true"})
+
+	cases := map[string]struct {
+		reason       string
+		p            *pkgv1.Provider
+		revisionName string
+		revisions    []pkgv1.PackageRevision
+		want         string
+		wantPinned   bool
+	}{
+		"NoRollback": {
+			reason:       "A package that was never rolled back should use the revision its source resolves to.",
+			p:            pkg(&pkgv1.RollbackPolicy{}, "pkg-1"),
+			revisionName: "pkg-2",
+			revisions:    []pkgv1.PackageRevision{pkgRevision("pkg-1", pkgv1.PackageRevisionActive)},
+			want:         "pkg-2",
+		},
+		"SourceUnchanged": {
+			reason:       "A package whose source still resolves to the revision it was rolled back from should stay on the rollback target.",
+			p:            rolledBack(),
+			revisionName: "pkg-2",
+			revisions:    []pkgv1.PackageRevision{pkgRevision("pkg-1", pkgv1.PackageRevisionActive), pkgRevision("pkg-2", pkgv1.PackageRevisionInactive)},
+			want:         "pkg-1",
+			wantPinned:   true,
+		},
+		"SourceResolvesToTarget": {
+			reason:       "A package whose source resolves to the rollback target should stay on it.",
+			p:            rolledBack(),
+			revisionName: "pkg-1",
+			revisions:    []pkgv1.PackageRevision{pkgRevision("pkg-1", pkgv1.PackageRevisionActive), pkgRevision("pkg-2", pkgv1.PackageRevisionInactive)},
+			want:         "pkg-1",
+			wantPinned:   true,
+		},
+		"SourceChanged": {
+			reason:       "A package whose source resolves to a new revision should no longer be pinned.",
+			p:            rolledBack(),
+			revisionName: "pkg-3",
+			revisions:    []pkgv1.PackageRevision{pkgRevision("pkg-1", pkgv1.PackageRevisionActive), pkgRevision("pkg-2", pkgv1.PackageRevisionInactive)},
+			want:         "pkg-3",
+		},
+		"AllowBreakingChanges": {
+			reason:       "A revision annotated to allow breaking changes should release the pin.",
+			p:            rolledBack(),
+			revisionName: "pkg-2",
+			revisions:    []pkgv1.PackageRevision{pkgRevision("pkg-1", pkgv1.PackageRevisionActive), allowed},
+			want:         "pkg-2",
+		},
+		"AllowBreakingChangesUnsigned": {
+			reason:       "Allowing breaking changes should not release the pin of a revision that is not signed by a trusted key.",
+			p:            rolledBack(),
+			revisionName: "pkg-2",
+			revisions:    []pkgv1.PackageRevision{pkgRevision("pkg-1", pkgv1.PackageRevisionActive), unsigned},
+			want:         "pkg-1",
+			wantPinned:   true,
+		},
+		"TargetDeleted": {
+			reason:       "A rollback target that no longer exists cannot be pinned to.",
+			p:            rolledBack(),
+			revisionName: "pkg-2",
+			revisions:    []pkgv1.PackageRevision{pkgRevision("pkg-2", pkgv1.PackageRevisionInactive)},
+			want:         "pkg-2",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, pinned := pinnedRevision(tc.p, tc.revisionName, tc.revisions)
+			if got != tc.want {
+				t.Errorf("\n%s\npinnedRevision(...): got %q, want %q", tc.reason, got, tc.want)
+			}
+			if pinned != tc.wantPinned {
+				t.Errorf("\n%s\npinnedRevision(...): got pinned %t, want %t", tc.reason, pinned, tc.wantPinned)
+			}
+		})
+	}
+}
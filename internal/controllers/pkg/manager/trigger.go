@@ -0,0 +1,190 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlevent "sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-core/internal/nddpkg"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+)
+
+const (
+	// DefaultPushPollInterval is the default interval at which packages
+	// with a pull policy of Always are polled for new images when pushed
+	// images are notified.
+	DefaultPushPollInterval = 1 * time.Hour
+
+	// triggerBuffer bounds the reconciles triggered but not yet picked up by
+	// a controller.
+	triggerBuffer = 256
+
+	errListProviders = "cannot list providers"
+	errListIntents   = "cannot list intents"
+)
+
+// PushTriggerOption configures a PushTrigger.
+type PushTriggerOption func(*PushTrigger)
+
+// WithPollInterval sets the interval at which packages with a pull policy of
+// Always are still polled, as a safety net for missed notifications.
+func WithPollInterval(d time.Duration) PushTriggerOption {
+	return func(t *PushTrigger) {
+		t.pollInterval = d
+	}
+}
+
+// WithTriggerLogger specifies how the PushTrigger should log messages.
+func WithTriggerLogger(l logging.Logger) PushTriggerOption {
+	return func(t *PushTrigger) {
+		t.log = l
+	}
+}
+
+// A PushTrigger reconciles the packages whose source refers to a pushed
+// image immediately, rather than when they are next polled.
+type PushTrigger struct {
+	client       client.Reader
+	rewriter     *nddpkg.Rewriter
+	pollInterval time.Duration
+	log          logging.Logger
+
+	providers chan ctrlevent.GenericEvent
+	intents   chan ctrlevent.GenericEvent
+}
+
+// NewPushTrigger returns a PushTrigger that finds packages using the supplied
+// client. A package also matches images pushed to the location its source is
+// rewritten to by the supplied Rewriter, e.g. a mirror.
+func NewPushTrigger(c client.Reader, rw *nddpkg.Rewriter, o ...PushTriggerOption) *PushTrigger {
+	t := &PushTrigger{
+		client:       c,
+		rewriter:     rw,
+		pollInterval: DefaultPushPollInterval,
+		log:          logging.NewNopLogger(),
+		providers:    make(chan ctrlevent.GenericEvent, triggerBuffer),
+		intents:      make(chan ctrlevent.GenericEvent, triggerBuffer),
+	}
+	for _, fn := range o {
+		fn(t)
+	}
+	return t
+}
+
+// Notify triggers a reconcile of the packages that match the pushed images.
+func (t *PushTrigger) Notify(ctx context.Context, events []nddpkg.PushEvent) error {
+	providers := &pkgv1.ProviderList{}
+	if err := t.client.List(ctx, providers); err != nil {
+		return errors.Wrap(err, errListProviders)
+	}
+	for i := range providers.Items {
+		t.trigger(t.providers, &providers.Items[i], events)
+	}
+	intents := &pkgv1.IntentList{}
+	if err := t.client.List(ctx, intents); err != nil {
+		return errors.Wrap(err, errListIntents)
+	}
+	for i := range intents.Items {
+		t.trigger(t.intents, &intents.Items[i], events)
+	}
+	return nil
+}
+
+func (t *PushTrigger) trigger(ch chan<- ctrlevent.GenericEvent, p pkgv1.Package, events []nddpkg.PushEvent) {
+	for _, e := range events {
+		if !t.matches(p, e) {
+			continue
+		}
+		// Never block a registry on a busy controller; the package is still
+		// polled if its reconcile is dropped.
+		select {
+		case ch <- ctrlevent.GenericEvent{Object: p}:
+			t.log.Debug("Triggered package reconcile", "name", p.GetName(), "repository", e.Repository, "tag", e.Tag)
+		default:
+			t.log.Info("Dropped package reconcile triggered by pushed image", "name", p.GetName(), "repository", e.Repository, "tag", e.Tag)
+		}
+		return
+	}
+}
+
+// matches returns true if the supplied package may resolve to a different
+// image because of the supplied pushed image. That is the case if its source
+// is the pushed tag, or a version constraint on the pushed repository.
+// Sources that are digests or URLs never change.
+func (t *PushTrigger) matches(p pkgv1.Package, e nddpkg.PushEvent) bool {
+	if pp := p.GetPackagePullPolicy(); pp != nil && *pp == corev1.PullNever {
+		return false
+	}
+	if e.Tag == "" {
+		return false
+	}
+	source := p.GetSource()
+	if _, ok := nddpkg.ParseSourceURL(source); ok {
+		return false
+	}
+	if repo, _, ok := nddpkg.ParseSourceConstraint(source); ok {
+		r, err := name.NewRepository(repo)
+		return err == nil && t.matchesRepository(r.Tag(e.Tag), e)
+	}
+	ref, err := name.ParseReference(source)
+	if err != nil {
+		return false
+	}
+	tag, ok := ref.(name.Tag)
+	return ok && tag.TagStr() == e.Tag && t.matchesRepository(tag, e)
+}
+
+func (t *PushTrigger) matchesRepository(ref name.Tag, e nddpkg.PushEvent) bool {
+	if ref.Context().Name() == e.Repository {
+		return true
+	}
+	rw, err := t.rewriter.Rewrite(ref)
+	return err == nil && rw.Context().Name() == e.Repository
+}
+
+// pullInterval returns the interval at which packages with a pull policy of
+// Always are polled. A nil PushTrigger polls them frequently.
+func (t *PushTrigger) pullInterval() time.Duration {
+	if t == nil {
+		return pullWait
+	}
+	return t.pollInterval
+}
+
+// watch adds the reconciles triggered for packages of the supplied type to
+// the supplied controller builder. A nil PushTrigger adds nothing.
+func (t *PushTrigger) watch(b *builder.Builder, p pkgv1.Package) *builder.Builder {
+	if t == nil {
+		return b
+	}
+	ch := t.providers
+	if _, ok := p.(*pkgv1.Intent); ok {
+		ch = t.intents
+	}
+	return b.Watches(&source.Channel{Source: ch}, &handler.EnqueueRequestForObject{})
+}
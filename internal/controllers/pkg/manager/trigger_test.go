@@ -0,0 +1,151 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-core/internal/nddpkg"
+)
+
+func TestPushTriggerMatches(t *testing.T) {
+	rw, err := nddpkg.NewRewriter(nddpkg.RegistryConfig{
+		Mirrors:  map[string]string{"docker.io": "harbor.lab/dockerhub"},
+		Rewrites: []nddpkg.RewriteRule{{From: "ghcr.io/yndd/*", To: "harbor.lab/yndd-mirror/*"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	never := corev1.PullNever
+
+	type args struct {
+		source     string
+		pullPolicy *corev1.PullPolicy
+		event      nddpkg.PushEvent
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   bool
+	}{
+		"Tag": {
+			reason: "A package should match a push of its tag.",
+			args: args{
+				source: "ghcr.io/yndd/nddp-srl:v0.1.0",
+				event:  nddpkg.PushEvent{Repository: "ghcr.io/yndd/nddp-srl", Tag: "v0.1.0"},
+			},
+			want: true,
+		},
+		"OtherTag": {
+			reason: "A package should not match a push of another tag of its repository.",
+			args: args{
+				source: "ghcr.io/yndd/nddp-srl:v0.1.0",
+				event:  nddpkg.PushEvent{Repository: "ghcr.io/yndd/nddp-srl", Tag: "v0.2.0"},
+			},
+		},
+		"OtherRepository": {
+			reason: "A package should not match a push of its tag to another repository.",
+			args: args{
+				source: "ghcr.io/yndd/nddp-srl:v0.1.0",
+				event:  nddpkg.PushEvent{Repository: "ghcr.io/yndd/nddp-ndda", Tag: "v0.1.0"},
+			},
+		},
+		"DefaultRegistry": {
+			reason: "A package should match a push to its fully qualified repository.",
+			args: args{
+				source: "yndd/nddp-srl:v0.1.0",
+				event:  nddpkg.PushEvent{Repository: "index.docker.io/yndd/nddp-srl", Tag: "v0.1.0"},
+			},
+			want: true,
+		},
+		"Constraint": {
+			reason: "A package with a version constraint should match any tag pushed to its repository.",
+			args: args{
+				source: "ghcr.io/yndd/nddp-srl:~0.1",
+				event:  nddpkg.PushEvent{Repository: "ghcr.io/yndd/nddp-srl", Tag: "v0.1.3"},
+			},
+			want: true,
+		},
+		"ConstraintOtherRepository": {
+			reason: "A package with a version constraint should not match tags pushed to another repository.",
+			args: args{
+				source: "ghcr.io/yndd/nddp-srl:~0.1",
+				event:  nddpkg.PushEvent{Repository: "ghcr.io/yndd/nddp-ndda", Tag: "v0.1.3"},
+			},
+		},
+		"RewrittenTag": {
+			reason: "A package should match a push of its tag to the location its source is rewritten to.",
+			args: args{
+				source: "ghcr.io/yndd/nddp-srl:v0.1.0",
+				event:  nddpkg.PushEvent{Repository: "harbor.lab/yndd-mirror/nddp-srl", Tag: "v0.1.0"},
+			},
+			want: true,
+		},
+		"MirroredConstraint": {
+			reason: "A package with a version constraint should match tags pushed to the mirror of its registry.",
+			args: args{
+				source: "yndd/nddp-srl:>=0.1.0",
+				event:  nddpkg.PushEvent{Repository: "harbor.lab/dockerhub/yndd/nddp-srl", Tag: "v0.1.3"},
+			},
+			want: true,
+		},
+		"Digest": {
+			reason: "A package whose source is a digest never changes and should not match.",
+			args: args{
+				source: "ghcr.io/yndd/nddp-srl@sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+				event:  nddpkg.PushEvent{Repository: "ghcr.io/yndd/nddp-srl", Tag: "v0.1.0"},
+			},
+		},
+		"Untagged": {
+			reason: "A push without a tag cannot change what a package resolves to and should not match.",
+			args: args{
+				source: "ghcr.io/yndd/nddp-srl:~0.1",
+				event:  nddpkg.PushEvent{Repository: "ghcr.io/yndd/nddp-srl", Digest: "sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf"},
+			},
+		},
+		"URL": {
+			reason: "A package that is not fetched from a registry should not match.",
+			args: args{
+				source: "https://packages.lab/nddp-srl.nddpkg",
+				event:  nddpkg.PushEvent{Repository: "packages.lab/nddp-srl.nddpkg", Tag: "v0.1.0"},
+			},
+		},
+		"PullNever": {
+			reason: "A package with a pull policy of Never is never fetched and should not match.",
+			args: args{
+				source:     "ghcr.io/yndd/nddp-srl:v0.1.0",
+				pullPolicy: &never,
+				event:      nddpkg.PushEvent{Repository: "ghcr.io/yndd/nddp-srl", Tag: "v0.1.0"},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := &pkgv1.Provider{}
+			p.SetSource(tc.args.source)
+			p.SetPackagePullPolicy(tc.args.pullPolicy)
+
+			got := NewPushTrigger(nil, rw).matches(p, tc.args.event)
+			if got != tc.want {
+				t.Errorf("\n%s\nmatches(...): got %t, want %t", tc.reason, got, tc.want)
+			}
+		})
+	}
+}
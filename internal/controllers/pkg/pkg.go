@@ -27,21 +27,30 @@ import (
 	"github.com/yndd/ndd-runtime/pkg/logging"
 )
 
-// Setup package controllers.
-func Setup(mgr ctrl.Manager, l logging.Logger, c nddpkg.Cache, namespace string) error {
-	for _, setup := range []func(ctrl.Manager, logging.Logger, string) error{
+// Setup package controllers. Package images are fetched using the supplied
+// Fetcher, or the supplied Sources if they are not in a registry, and the images of packaged controllers are rewritten using the
+// supplied Rewriter. Packages are also reconciled when the supplied
+// PushTrigger, if any, is notified of an image they refer to.
+func Setup(mgr ctrl.Manager, l logging.Logger, c nddpkg.Cache, f nddpkg.Fetcher, s nddpkg.Sources, rw *nddpkg.Rewriter, t *manager.PushTrigger, namespace string, sp resolver.SettingsPolicy) error {
+	for _, setup := range []func(ctrl.Manager, logging.Logger, nddpkg.Fetcher, nddpkg.Sources, string, *manager.PushTrigger) error{
 		manager.Setup,
-		resolver.Setup,
-		composite.Setup,
+		manager.SetupIntent,
 	} {
-		if err := setup(mgr, l, namespace); err != nil {
+		if err := setup(mgr, l, f, s, namespace, t); err != nil {
 			return err
 		}
 	}
-	for _, setup := range []func(ctrl.Manager, logging.Logger, nddpkg.Cache, string) error{
+	if err := composite.Setup(mgr, l, namespace); err != nil {
+		return err
+	}
+	if err := resolver.Setup(mgr, l, f, sp); err != nil {
+		return err
+	}
+	for _, setup := range []func(ctrl.Manager, logging.Logger, nddpkg.Cache, nddpkg.Fetcher, nddpkg.Sources, *nddpkg.Rewriter, string) error{
 		revision.SetupProviderRevision,
+		revision.SetupIntentRevision,
 	} {
-		if err := setup(mgr, l, c, namespace); err != nil {
+		if err := setup(mgr, l, c, f, s, rw, namespace); err != nil {
 			return err
 		}
 	}
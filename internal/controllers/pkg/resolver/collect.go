@@ -0,0 +1,106 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-runtime/pkg/meta"
+	"github.com/yndd/ndd-runtime/pkg/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// collectGracePeriod is how long a dependency package must be without
+	// dependents before it is removed. Dependents briefly leave the Lock while
+	// they switch revisions, which must not remove their dependencies.
+	collectGracePeriod = 2 * time.Minute
+
+	errListDependencies  = "cannot list dependency packages"
+	errUpdateDependency  = "cannot update dependency package"
+	errDeleteDependency  = "cannot delete dependency package"
+	errParseUnreferenced = "cannot parse time since dependency package is unreferenced"
+)
+
+// collect removes the dependency packages controlled by the Lock that no
+// package in the Lock depends on anymore. It returns how long to wait before
+// dependency packages that are pending removal should be checked again, or
+// zero if none are pending.
+func (r *Reconciler) collect(ctx context.Context, lock *v1.Lock) (time.Duration, error) { // nolint:gocyclo
+	pkgs, err := r.packages(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, errListDependencies)
+	}
+
+	// Count the packages in the Lock that depend on each source.
+	refs := map[string]int{}
+	for _, lp := range lock.Packages {
+		for _, d := range lp.Dependencies {
+			refs[d.Package]++
+		}
+	}
+
+	var requeue time.Duration
+	now := time.Now()
+	for _, p := range pkgs {
+		if !metav1.IsControlledBy(p, lock) || meta.WasDeleted(p) {
+			continue
+		}
+		since, pending := p.GetAnnotations()[v1.UnreferencedSinceAnnotation]
+		if refs[p.GetAnnotations()[v1.DependencySourceAnnotation]] > 0 || p.GetAnnotations()[v1.KeepAnnotation] == "true" {
+			if pending {
+				meta.RemoveAnnotations(p, v1.UnreferencedSinceAnnotation)
+				if err := r.client.Update(ctx, p); err != nil {
+					return 0, errors.Wrap(err, errUpdateDependency)
+				}
+			}
+			continue
+		}
+		if !pending {
+			meta.AddAnnotations(p, map[string]string{v1.UnreferencedSinceAnnotation: now.UTC().Format(time.RFC3339)})
+			if err := r.client.Update(ctx, p); err != nil {
+				return 0, errors.Wrap(err, errUpdateDependency)
+			}
+			requeue = shortest(requeue, collectGracePeriod)
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return 0, errors.Wrap(err, errParseUnreferenced)
+		}
+		if wait := t.Add(collectGracePeriod).Sub(now); wait > 0 {
+			requeue = shortest(requeue, wait)
+			continue
+		}
+		r.log.Debug("removing dependency package that is no longer depended on", "name", p.GetName())
+		if err := r.client.Delete(ctx, p); resource.IgnoreNotFound(err) != nil {
+			return 0, errors.Wrap(err, errDeleteDependency)
+		}
+	}
+	return requeue, nil
+}
+
+// shortest returns the shortest of the supplied non-zero durations.
+func shortest(a, b time.Duration) time.Duration {
+	if a == 0 || b < a {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/ndd-runtime/pkg/meta"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+	v1 "github.com/yndd/ndd-core/apis/pkg/v1"
+)
+
+const depSource = "registry.lab/yndd/nddp-c"
+
+// lockWith returns a Lock holding a package for each supplied list of
+// dependencies.
+func lockWith(deps ...[]pkgmetav1.Dependency) *v1.Lock {
+	l := &v1.Lock{ObjectMeta: metav1.ObjectMeta{Name: "lock", UID: types.UID("lock-uid")}}
+	for _, d := range deps {
+		l.Packages = append(l.Packages, v1.LockPackage{Dependencies: d})
+	}
+	return l
+}
+
+// dependencyPackage returns the dependency package of depSource. It is
+// controlled by the supplied Lock, if any, and carries the supplied
+// annotations.
+func dependencyPackage(l *v1.Lock, annotations map[string]string) *v1.Provider {
+	p := &v1.Provider{ObjectMeta: metav1.ObjectMeta{Name: "nddp-c"}}
+	meta.AddAnnotations(p, map[string]string{v1.DependencySourceAnnotation: depSource})
+	meta.AddAnnotations(p, annotations)
+	if l != nil {
+		meta.AddOwnerReference(p, meta.AsController(meta.TypedReferenceTo(l, v1.LockGroupVersionKind)))
+	}
+	return p
+}
+
+func unreferencedSince(d time.Duration) map[string]string {
+	return map[string]string{v1.UnreferencedSinceAnnotation: time.Now().Add(-d).UTC().Format(time.RFC3339)}
+}
+
+func TestReconcilerCollect(t *testing.T) {
+	lock := lockWith()
+	dependedOn := []pkgmetav1.Dependency{{Package: depSource}}
+	other := []pkgmetav1.Dependency{{Package: "registry.lab/yndd/nddp-d"}}
+
+	type want struct {
+		exists  bool
+		pending bool
+		// requeue is the range the returned requeue duration must be in.
+		minRequeue time.Duration
+		maxRequeue time.Duration
+	}
+	cases := map[string]struct {
+		reason string
+		lock   *v1.Lock
+		pkg    *v1.Provider
+		want   want
+	}{
+		"Referenced": {
+			reason: "A dependency package that a package in the Lock depends on should be kept.",
+			lock:   lockWith(dependedOn),
+			pkg:    dependencyPackage(lock, nil),
+			want:   want{exists: true},
+		},
+		"ReferencedByOne": {
+			reason: "A dependency package should be kept as long as any package in the Lock depends on it.",
+			lock:   lockWith(other, dependedOn),
+			pkg:    dependencyPackage(lock, nil),
+			want:   want{exists: true},
+		},
+		"ReferencedAgain": {
+			reason: "A dependency package that is depended on again should no longer be pending removal.",
+			lock:   lockWith(dependedOn),
+			pkg:    dependencyPackage(lock, unreferencedSince(time.Hour)),
+			want:   want{exists: true},
+		},
+		"Unreferenced": {
+			reason: "A dependency package that nothing depends on anymore should be marked pending removal for the grace period.",
+			lock:   lockWith(other),
+			pkg:    dependencyPackage(lock, nil),
+			want:   want{exists: true, pending: true, minRequeue: collectGracePeriod, maxRequeue: collectGracePeriod},
+		},
+		"WithinGracePeriod": {
+			reason: "A dependency package should be kept until it has been unreferenced for the grace period.",
+			lock:   lockWith(),
+			pkg:    dependencyPackage(lock, unreferencedSince(time.Minute)),
+			want:   want{exists: true, pending: true, minRequeue: 50 * time.Second, maxRequeue: time.Minute},
+		},
+		"GracePeriodPassed": {
+			reason: "A dependency package that has been unreferenced for longer than the grace period should be removed.",
+			lock:   lockWith(),
+			pkg:    dependencyPackage(lock, unreferencedSince(3*time.Minute)),
+			want:   want{exists: false},
+		},
+		"Keep": {
+			reason: "A dependency package annotated to be kept should never be removed.",
+			lock:   lockWith(),
+			pkg:    dependencyPackage(lock, map[string]string{v1.KeepAnnotation: "true"}),
+			want:   want{exists: true},
+		},
+		"KeepPending": {
+			reason: "A dependency package annotated to be kept while pending removal should no longer be pending removal.",
+			lock:   lockWith(),
+			pkg: dependencyPackage(lock, map[string]string{
+				v1.KeepAnnotation:              "true",
+				v1.UnreferencedSinceAnnotation: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+			}),
+			want: want{exists: true},
+		},
+		"NotControlled": {
+			reason: "A package the Lock does not control was installed by a user and should never be removed.",
+			lock:   lockWith(),
+			pkg:    dependencyPackage(nil, unreferencedSince(time.Hour)),
+			want:   want{exists: true, pending: true},
+		},
+	}
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			s := runtime.NewScheme()
+			if err := v1.AddToScheme(s); err != nil {
+				t.Fatal(err)
+			}
+			c := fake.NewClientBuilder().WithScheme(s).WithObjects(tc.pkg).Build()
+			r := &Reconciler{client: c, log: logging.NewNopLogger()}
+
+			requeue, err := r.collect(context.Background(), tc.lock)
+			if err != nil {
+				t.Fatalf("\n%s\ncollect(...): %v", tc.reason, err)
+			}
+			if requeue < tc.want.minRequeue || requeue > tc.want.maxRequeue {
+				t.Errorf("\n%s\ncollect(...): got requeue after %s, want between %s and %s", tc.reason, requeue, tc.want.minRequeue, tc.want.maxRequeue)
+			}
+
+			got := &v1.Provider{}
+			err = c.Get(context.Background(), client.ObjectKeyFromObject(tc.pkg), got)
+			if kerrors.IsNotFound(err) {
+				if tc.want.exists {
+					t.Errorf("\n%s\ncollect(...): dependency package was removed", tc.reason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.want.exists {
+				t.Errorf("\n%s\ncollect(...): dependency package was not removed", tc.reason)
+			}
+			if _, pending := got.GetAnnotations()[v1.UnreferencedSinceAnnotation]; pending != tc.want.pending {
+				t.Errorf("\n%s\ncollect(...): got pending removal %t, want %t", tc.reason, pending, tc.want.pending)
+			}
+		})
+	}
+}
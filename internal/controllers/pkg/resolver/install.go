@@ -0,0 +1,351 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Masterminds/semver"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+	v1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-core/internal/nddpkg"
+	"github.com/yndd/ndd-runtime/pkg/event"
+	"github.com/yndd/ndd-runtime/pkg/meta"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	errListPackages      = "cannot list packages"
+	errFetchPackage      = "cannot fetch dependency package"
+	errParsePackage      = "cannot parse dependency package"
+	errNotOneMeta        = "dependency package does not have exactly one meta object"
+	errUpgradeDependency = "cannot upgrade dependency package"
+
+	msgCreateDependencyFmt  = "installing dependency %s at version %s"
+	msgUpgradeDependencyFmt = "upgrading dependency %s from version %s to %s"
+)
+
+// A dependencyCache caches the dependencies of package versions that are not
+// installed, which are read from their package image. Package versions are
+// assumed to be immutable.
+type dependencyCache struct {
+	mu   sync.RWMutex
+	deps map[string][]pkgmetav1.Dependency
+}
+
+func (c *dependencyCache) get(ref string) ([]pkgmetav1.Dependency, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	d, ok := c.deps[ref]
+	return d, ok
+}
+
+func (c *dependencyCache) set(ref string, deps []pkgmetav1.Dependency) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deps[ref] = deps
+}
+
+// resolve picks a consistent set of versions for all packages in the Lock and
+// their dependencies. It creates the dependency packages that are missing and
+// upgrades the dependency packages the Lock controls whose installed version
+// does not satisfy the packages that depend on them.
+func (r *Reconciler) resolve(ctx context.Context, lock *v1.Lock) error { // nolint:gocyclo
+	pkgs, err := r.packages(ctx)
+	if err != nil {
+		return errors.Wrap(err, errListPackages)
+	}
+	controlled := map[string]v1.Package{}
+	for _, p := range pkgs {
+		if metav1.IsControlledBy(p, lock) {
+			controlled[p.GetAnnotations()[v1.DependencySourceAnnotation]] = p
+		}
+	}
+
+	// Only dependency packages that the Lock controls may change version.
+	installed := map[string]*semver.Version{}
+	deps := map[string][]pkgmetav1.Dependency{}
+	fixed := map[string]bool{}
+	pkgTypes := map[string]pkgmetav1.PackageType{}
+	for _, lp := range lock.Packages {
+		// Versions that are not semantic versions, e.g. digests, are
+		// recorded as unknown.
+		v, _ := semver.NewVersion(lp.Version)
+		installed[lp.Source] = v
+		deps[lp.Source] = lp.Dependencies
+		if _, ok := controlled[lp.Source]; !ok {
+			fixed[lp.Source] = true
+		}
+		for _, d := range lp.Dependencies {
+			pkgTypes[d.Package] = d.Type
+		}
+	}
+
+	s := &solver{
+		versions: func(ctx context.Context, source string) ([]*semver.Version, error) {
+			vs, err := r.versions(ctx, lock, source)
+			if err != nil {
+				r.recordDependents(ctx, lock, source, event.Warning(reasonResolve, err))
+			}
+			return vs, err
+		},
+		dependencies: func(ctx context.Context, source string, v *semver.Version) ([]pkgmetav1.Dependency, error) {
+			if iv := installed[source]; iv != nil && iv.Equal(v) {
+				return deps[source], nil
+			}
+			ds, err := r.dependenciesOf(ctx, lock, source, v)
+			if err != nil {
+				r.recordDependents(ctx, lock, source, event.Warning(reasonResolve, err))
+			}
+			for _, d := range ds {
+				pkgTypes[d.Package] = d.Type
+			}
+			return ds, err
+		},
+		installed: installed,
+		fixed:     fixed,
+	}
+	solved, err := s.Solve(ctx, deps)
+	var ue *unsatisfiableError
+	if errors.As(err, &ue) {
+		// Every package that places a constraint on the unsatisfiable
+		// package is told why its dependencies cannot be installed.
+		for _, req := range ue.requirements {
+			r.recordRevision(ctx, lock, req.from, event.Warning(reasonResolve, err))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Apply the solution in order so that packages are created
+	// deterministically.
+	sources := make([]string, 0, len(solved))
+	for src := range solved {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+	for _, src := range sources {
+		v := solved[src]
+		if fixed[src] || v == nil {
+			continue
+		}
+		ref, err := name.ParseReference(src)
+		if err != nil {
+			return errors.Wrap(err, errInvalidDependency)
+		}
+		source := fmt.Sprintf(packageTagFmt, ref.String(), v.Original())
+		if p, ok := controlled[src]; ok {
+			// A dependency package that is not in the Lock yet is still
+			// being installed.
+			if iv := installed[src]; iv == nil || iv.Equal(v) {
+				continue
+			}
+			r.log.Debug("upgrading dependency package", "name", p.GetName(), "from", installed[src].Original(), "to", v.Original())
+			p.SetSource(source)
+			if err := r.client.Update(ctx, p); err != nil {
+				err = errors.Wrap(err, errUpgradeDependency)
+				r.recordDependents(ctx, lock, src, event.Warning(reasonResolve, err))
+				return err
+			}
+			r.recordDependents(ctx, lock, src, event.Normal(reasonResolve, fmt.Sprintf(msgUpgradeDependencyFmt, src, installed[src].Original(), v.Original())))
+			continue
+		}
+		if _, ok := installed[src]; ok {
+			continue
+		}
+		if err := r.create(ctx, lock, src, pkgTypes[src], ref, source); err != nil {
+			r.recordDependents(ctx, lock, src, event.Warning(reasonResolve, err))
+			return err
+		}
+		r.recordDependents(ctx, lock, src, event.Normal(reasonResolve, fmt.Sprintf(msgCreateDependencyFmt, src, v.Original())))
+	}
+	return nil
+}
+
+// packages returns all installed packages, of every package type.
+func (r *Reconciler) packages(ctx context.Context) ([]v1.Package, error) {
+	pl := &v1.ProviderList{}
+	if err := r.client.List(ctx, pl); err != nil {
+		return nil, err
+	}
+	il := &v1.IntentList{}
+	if err := r.client.List(ctx, il); err != nil {
+		return nil, err
+	}
+	pkgs := make([]v1.Package, 0, len(pl.Items)+len(il.Items))
+	for i := range pl.Items {
+		pkgs = append(pkgs, &pl.Items[i])
+	}
+	for i := range il.Items {
+		pkgs = append(pkgs, &il.Items[i])
+	}
+	return pkgs, nil
+}
+
+// create creates a dependency package, controlled by the Lock.
+func (r *Reconciler) create(ctx context.Context, lock *v1.Lock, src string, t pkgmetav1.PackageType, ref name.Reference, source string) error {
+	var pack v1.Package
+	switch t {
+	case pkgmetav1.ProviderPackageType:
+		pack = &v1.Provider{}
+	case pkgmetav1.IntentPackageType:
+		pack = &v1.Intent{}
+	default:
+		return errors.New(errInvalidPackageType)
+	}
+
+	// The dependency inherits pull secrets and other settings from the
+	// packages that depend on it, such that it can be fetched from the same
+	// private registries.
+	dependents, err := r.dependents(ctx, lock, src)
+	if err != nil {
+		return err
+	}
+	inheritSettings(r.settings, dependents, pack)
+
+	pack.SetName(nddpkg.ToDNSLabel(ref.Context().RepositoryStr()))
+	pack.SetSource(source)
+
+	// The Lock controls the packages it creates, such that they can be removed
+	// once nothing depends on them anymore.
+	meta.AddAnnotations(pack, map[string]string{v1.DependencySourceAnnotation: src})
+	meta.AddOwnerReference(pack, meta.AsController(meta.TypedReferenceTo(lock, v1.LockGroupVersionKind)))
+	if err := r.client.Create(ctx, pack); err != nil && !kerrors.IsAlreadyExists(err) {
+		return errors.Wrap(err, errCreateDependency)
+	}
+	return nil
+}
+
+// versions returns the versions of a package that are available in its
+// registry. Tags that are not semantic versions are skipped.
+func (r *Reconciler) versions(ctx context.Context, lock *v1.Lock, source string) ([]*semver.Version, error) {
+	ref, err := name.ParseReference(source)
+	if err != nil {
+		return nil, errors.Wrap(err, errInvalidDependency)
+	}
+	secrets, err := r.pullSecrets(ctx, lock, source)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := r.fetcher.Tags(ctx, ref, secrets...)
+	if err != nil {
+		return nil, errors.Wrap(err, errFetchTags)
+	}
+	vs := make([]*semver.Version, 0, len(tags))
+	for _, t := range tags {
+		v, err := semver.NewVersion(t)
+		if err != nil {
+			continue
+		}
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+// dependenciesOf returns the dependencies of a version of a package that is
+// not installed by reading its package image.
+func (r *Reconciler) dependenciesOf(ctx context.Context, lock *v1.Lock, source string, v *semver.Version) ([]pkgmetav1.Dependency, error) {
+	tag := fmt.Sprintf(packageTagFmt, source, v.Original())
+	if deps, ok := r.deps.get(tag); ok {
+		return deps, nil
+	}
+	ref, err := name.ParseReference(tag)
+	if err != nil {
+		return nil, errors.Wrap(err, errInvalidDependency)
+	}
+	secrets, err := r.pullSecrets(ctx, lock, source)
+	if err != nil {
+		return nil, err
+	}
+	img, err := r.fetcher.Fetch(ctx, ref, secrets...)
+	if err != nil {
+		return nil, errors.Wrap(err, errFetchPackage)
+	}
+	rc, err := nddpkg.OpenStream(img)
+	if err != nil {
+		return nil, errors.Wrap(err, errFetchPackage)
+	}
+	pkg, err := r.parser.Parse(ctx, rc)
+	if err != nil {
+		return nil, errors.Wrap(err, errParsePackage)
+	}
+	if len(pkg.GetMeta()) != 1 {
+		return nil, errors.New(errNotOneMeta)
+	}
+	m, ok := nddpkg.TryConvertToPkg(pkg.GetMeta()[0], &pkgmetav1.Provider{}, &pkgmetav1.Intent{})
+	if !ok {
+		return nil, errors.New(errInvalidDependency)
+	}
+	r.deps.set(tag, m.GetDependencies())
+	return m.GetDependencies(), nil
+}
+
+// pullSecrets returns the pull secrets of all packages in the Lock that depend
+// on the supplied package source.
+func (r *Reconciler) pullSecrets(ctx context.Context, lock *v1.Lock, source string) ([]string, error) {
+	dependents, err := r.dependents(ctx, lock, source)
+	if err != nil {
+		return nil, err
+	}
+	p := &v1.Provider{}
+	inheritSettings(SettingsPolicyUnion, dependents, p)
+	return v1.RefNames(p.GetPackagePullSecrets()), nil
+}
+
+// recordDependents records an event on the revisions of the packages in the
+// Lock that depend on the supplied package source.
+func (r *Reconciler) recordDependents(ctx context.Context, lock *v1.Lock, source string, e event.Event) {
+	for _, lp := range lock.Packages {
+		if dependsOn(lp, source) {
+			r.recordRevision(ctx, lock, lp.Source, e)
+		}
+	}
+}
+
+// recordRevision records an event on the revision of the package in the Lock
+// with the supplied source. Events cannot be recorded for packages that are
+// not in the Lock.
+func (r *Reconciler) recordRevision(ctx context.Context, lock *v1.Lock, source string, e event.Event) {
+	for _, lp := range lock.Packages {
+		if lp.Source != source {
+			continue
+		}
+		var pr v1.PackageRevision
+		switch lp.Type {
+		case pkgmetav1.ProviderPackageType:
+			pr = &v1.ProviderRevision{}
+		case pkgmetav1.IntentPackageType:
+			pr = &v1.IntentRevision{}
+		default:
+			return
+		}
+		if err := r.client.Get(ctx, types.NamespacedName{Name: lp.Name}, pr); err != nil {
+			r.log.Debug(errGetDependentRevision, "error", err)
+			return
+		}
+		r.record.Event(pr, e)
+		return
+	}
+}
@@ -18,22 +18,19 @@ package resolver
 
 import (
 	"context"
-	"fmt"
-	"sort"
 	"strings"
 	"time"
 
-	"github.com/Masterminds/semver"
-	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/pkg/errors"
 	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
 	v1 "github.com/yndd/ndd-core/apis/pkg/v1"
 	"github.com/yndd/ndd-core/internal/dag"
 	"github.com/yndd/ndd-core/internal/nddpkg"
+	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
 	"github.com/yndd/ndd-runtime/pkg/event"
 	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/ndd-runtime/pkg/parser"
 	"github.com/yndd/ndd-runtime/pkg/resource"
-	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -51,18 +48,23 @@ const (
 const (
 	finalizer = "lock.pkg.ndd.yndd.io"
 
-	errGetLock              = "cannot get package lock"
-	errAddFinalizer         = "cannot add lock finalizer"
-	errBuildDAG             = "cannot build DAG"
-	errSortDAG              = "cannot sort DAG"
-	errMissingDependencyFmt = "missing package (%s) is not a dependency"
-	errInvalidConstraint    = "version constraint on dependency is invalid"
-	errInvalidDependency    = "dependency package is not valid"
-	errFetchTags            = "cannot fetch dependency package tags"
-	errNoValidVersion       = "cannot find a valid version for package constraints"
-	errNoValidVersionFmt    = "dependency (%s) does not have version in constraints (%s)"
-	errInvalidPackageType   = "cannot create invalid package dependency type"
-	errCreateDependency     = "cannot create dependency package"
+	errGetLock             = "cannot get package lock"
+	errAddFinalizer        = "cannot add lock finalizer"
+	errBuildDAG            = "cannot build DAG"
+	errSortDAG             = "cannot sort DAG"
+	errInvalidConstraint   = "version constraint on dependency is invalid"
+	errInvalidDependency   = "dependency package is not valid"
+	errFetchTags           = "cannot fetch dependency package tags"
+	errInvalidPackageType  = "cannot create invalid package dependency type"
+	errCreateDependency    = "cannot create dependency package"
+	errCollectDependencies = "cannot remove unused dependency packages"
+	errResolve             = "cannot resolve package dependencies"
+	errUpdateStatus        = "cannot update lock status"
+	errInCycleFmt          = "package %s is part of a dependency cycle: %s"
+
+	// Event reasons
+	reasonResolve event.Reason = "ResolveDependencies"
+	reasonCycle   event.Reason = "DependencyCycle"
 )
 
 // ReconcilerOption is used to configure the Reconciler.
@@ -103,47 +105,80 @@ func WithFetcher(f nddpkg.Fetcher) ReconcilerOption {
 	}
 }
 
+// WithParser specifies how the Reconciler should parse the packages of
+// dependency versions that are not installed.
+func WithParser(p parser.Parser) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.parser = p
+	}
+}
+
+// WithSettingsPolicy specifies how the Reconciler should set the settings of
+// the dependency packages it creates from the packages that depend on them.
+func WithSettingsPolicy(p SettingsPolicy) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.settings = p
+	}
+}
+
 // Reconciler reconciles packages.
 type Reconciler struct {
-	client  client.Client
-	log     logging.Logger
-	record  event.Recorder
-	lock    resource.Finalizer
-	newDag  dag.NewDAGFn
-	fetcher nddpkg.Fetcher
+	client   client.Client
+	log      logging.Logger
+	record   event.Recorder
+	lock     resource.Finalizer
+	newDag   dag.NewDAGFn
+	fetcher  nddpkg.Fetcher
+	parser   parser.Parser
+	settings SettingsPolicy
+	deps     *dependencyCache
 }
 
-// Setup adds a controller that reconciles the Lock.
-func Setup(mgr ctrl.Manager, l logging.Logger, namespace string) error {
+// Setup adds a controller that reconciles the Lock. Dependency packages it
+// creates inherit the settings of their dependents according to the supplied
+// policy. Package tags are fetched using the supplied Fetcher.
+func Setup(mgr ctrl.Manager, l logging.Logger, f nddpkg.Fetcher, p SettingsPolicy) error {
 	name := "packages/" + strings.ToLower(v1.LockGroupKind)
 
-	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	metaScheme, err := nddpkg.BuildMetaScheme()
+	if err != nil {
+		return errors.New("cannot build meta scheme for package parser")
+	}
+	objScheme, err := nddpkg.BuildObjectScheme()
 	if err != nil {
-		return errors.Wrap(err, "failed to initialize clientset")
+		return errors.New("cannot build object scheme for package parser")
 	}
 
 	r := NewReconciler(mgr,
 		WithLogger(l.WithValues("controller", name)),
 		WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
-		WithFetcher(nddpkg.NewK8sFetcher(clientset, namespace)),
+		WithFetcher(f),
+		WithParser(parser.New(metaScheme, objScheme)),
+		WithSettingsPolicy(p),
 	)
 
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		For(&v1.Lock{}).
 		Owns(&v1.ProviderRevision{}).
+		Owns(&v1.Provider{}).
+		Owns(&v1.IntentRevision{}).
+		Owns(&v1.Intent{}).
 		Complete(r)
 }
 
 // NewReconciler creates a new package revision reconciler.
 func NewReconciler(mgr manager.Manager, opts ...ReconcilerOption) *Reconciler {
 	r := &Reconciler{
-		client:  mgr.GetClient(),
-		lock:    resource.NewAPIFinalizer(mgr.GetClient(), finalizer),
-		log:     logging.NewNopLogger(),
-		record:  event.NewNopRecorder(),
-		newDag:  dag.NewMapDag,
-		fetcher: nddpkg.NewNopFetcher(),
+		client:   mgr.GetClient(),
+		lock:     resource.NewAPIFinalizer(mgr.GetClient(), finalizer),
+		log:      logging.NewNopLogger(),
+		record:   event.NewNopRecorder(),
+		newDag:   dag.NewMapDag,
+		fetcher:  nddpkg.NewNopFetcher(),
+		parser:   parser.New(nil, nil),
+		settings: SettingsPolicyNone,
+		deps:     &dependencyCache{deps: map[string][]pkgmetav1.Dependency{}},
 	}
 
 	for _, f := range opts {
@@ -153,6 +188,8 @@ func NewReconciler(mgr manager.Manager, opts ...ReconcilerOption) *Reconciler {
 	return r
 }
 
+// +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=locks/status,verbs=get;update;patch
+
 // Reconcile package revision.
 func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) { // nolint:gocyclo
 	log := r.log.WithValues("request", req)
@@ -183,99 +220,86 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		"name", lock.GetName(),
 	)
 
-	dag := r.newDag()
-	implied, err := dag.Init(v1.ToNodes(lock.Packages...))
+	d := r.newDag()
+	_, err := d.Init(v1.ToNodes(lock.Packages...))
 	if err != nil {
 		return reconcile.Result{}, errors.Wrap(err, errBuildDAG)
 	}
 
 	// Make sure we don't have any cyclical imports. If we do, refuse to install
 	// additional packages.
-	_, err = dag.Sort()
-	if err != nil {
-		return reconcile.Result{}, errors.Wrap(err, errSortDAG)
-	}
-
-	if len(implied) == 0 {
-		return reconcile.Result{}, nil
-	}
-
-	// If we are missing a node, we want to create it. The resolver never
-	// modifies the Lock. We only create the first implied node as we will be
-	// requeued when it adds itself to the Lock, at which point we will check
-	// for missing nodes again.
-	dep, ok := implied[0].(*pkgmetav1.Dependency)
-	if !ok {
-		log.Debug(errInvalidDependency, "error", errors.Errorf(errMissingDependencyFmt, dep.Identifier()))
-		return reconcile.Result{}, nil
-	}
-	c, err := semver.NewConstraint(dep.Constraints)
-	if err != nil {
-		log.Debug(errInvalidConstraint, "error", err)
+	_, err = d.Sort()
+	if dag.IsCycle(err) {
+		log.Debug(errSortDAG, "error", err)
+		if err := r.reportCycle(ctx, lock, err); err != nil {
+			log.Debug(errUpdateStatus, "error", err)
+			return reconcile.Result{RequeueAfter: shortWait}, nil
+		}
+		// Nothing changes until a package in the cycle is removed or changes
+		// its dependencies, which updates the Lock.
 		return reconcile.Result{}, nil
 	}
-	ref, err := name.ParseReference(dep.Package)
 	if err != nil {
-		log.Debug(errInvalidDependency, "error", err)
-		return reconcile.Result{}, nil
+		return reconcile.Result{}, errors.Wrap(err, errSortDAG)
 	}
 
-	// NOTE: we will be unable to fetch tags for private
-	// dependencies because we do not attach any secrets. Consider copying
-	// secrets from parent dependencies.
-	tags, err := r.fetcher.Tags(ctx, ref)
+	// Remove dependency packages that were created by the resolver but that
+	// nothing depends on anymore.
+	requeue, err := r.collect(ctx, lock)
 	if err != nil {
-		log.Debug(errFetchTags, "error", err)
+		log.Debug(errCollectDependencies, "error", err)
 		return reconcile.Result{RequeueAfter: shortWait}, nil
 	}
 
-	vs := []*semver.Version{}
-	for _, r := range tags {
-		v, err := semver.NewVersion(r)
-		if err != nil {
-			// We skip any tags that are not valid semantic versions.
-			continue
+	// Pick versions for all packages in the graph at once, such that the
+	// constraints of every package that depends on a dependency are
+	// considered, then create missing dependencies and upgrade installed
+	// ones where needed.
+	if err := r.resolve(ctx, lock); err != nil {
+		log.Debug(errResolve, "error", err)
+		r.record.Event(lock, event.Warning(reasonResolve, err))
+		if _, err := r.setCondition(ctx, lock, v1.DependenciesUnresolved(err.Error())); err != nil {
+			log.Debug(errUpdateStatus, "error", err)
 		}
-		vs = append(vs, v)
-	}
-
-	sort.Sort(semver.Collection(vs))
-	var addVer string
-	for _, v := range vs {
-		if c.Check(v) {
-			addVer = v.Original()
+		if IsUnsatisfiable(err) {
+			// Nothing changes until a package is installed, upgraded or
+			// removed, which updates the Lock.
+			return reconcile.Result{RequeueAfter: requeue}, nil
 		}
+		return reconcile.Result{RequeueAfter: shortWait}, nil
 	}
 
-	// NOTE: consider creating event on package revision
-	// dictating constraints.
-	if addVer == "" {
-		log.Debug(errNoValidVersion, errors.Errorf(errNoValidVersionFmt, dep.Identifier(), dep.Constraints))
-		return reconcile.Result{}, nil
+	if _, err := r.setCondition(ctx, lock, v1.DependenciesResolved()); err != nil {
+		log.Debug(errUpdateStatus, "error", err)
+		return reconcile.Result{RequeueAfter: shortWait}, nil
 	}
+	return reconcile.Result{RequeueAfter: requeue}, nil
+}
 
-	var pack v1.Package
-	switch dep.Type {
-	case pkgmetav1.ProviderPackageType:
-		pack = &v1.Provider{}
-	default:
-		log.Debug(errInvalidPackageType)
-		return reconcile.Result{}, nil
+// reportCycle sets a condition on the Lock that names the supplied dependency
+// cycle. The first time the cycle is reported an event is also recorded on the
+// Lock and on the revision of every package in the cycle.
+func (r *Reconciler) reportCycle(ctx context.Context, lock *v1.Lock, err error) error {
+	changed, uerr := r.setCondition(ctx, lock, v1.DependencyCycle(err.Error()))
+	if !changed {
+		return uerr
 	}
-
-	// NOTE: packages are currently created with default
-	// settings. This means that a dependency must be publicly available as
-	// no packagePullSecrets are set. Settings can be modified manually
-	// after dependency creation to address this.
-	pack.SetName(nddpkg.ToDNSLabel(ref.Context().RepositoryStr()))
-	pack.SetSource(fmt.Sprintf(packageTagFmt, ref.String(), addVer))
-
-	// NOTE: consider making the lock the controller of packages
-	// it creates.
-	if err := r.client.Create(ctx, pack); err != nil {
-		log.Debug(errCreateDependency, "error", err)
-		return reconcile.Result{RequeueAfter: shortWait}, nil
+	r.record.Event(lock, event.Warning(reasonCycle, err))
+	path := dag.CyclePath(err)
+	for i := 0; i+1 < len(path); i++ {
+		r.recordRevision(ctx, lock, path[i], event.Warning(reasonCycle, errors.Errorf(errInCycleFmt, path[i], strings.Join(path, " -> "))))
 	}
+	return uerr
+}
 
-	return reconcile.Result{}, nil
+// setCondition sets the supplied condition on the Lock and reports whether
+// that changed the condition. The status of the Lock is only updated if it
+// did, so that a Lock that keeps failing in the same way is not updated on
+// every reconcile.
+func (r *Reconciler) setCondition(ctx context.Context, lock *v1.Lock, c nddv1.Condition) (bool, error) {
+	if lock.GetCondition(c.Kind).Equal(c) {
+		return false, nil
+	}
+	lock.SetConditions(c)
+	return true, errors.Wrap(r.client.Status().Update(ctx, lock), errUpdateStatus)
 }
@@ -0,0 +1,133 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
+	"github.com/yndd/ndd-runtime/pkg/event"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+	v1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-core/internal/dag"
+)
+
+// nameRecorder records the names of the objects events are recorded on.
+type nameRecorder struct {
+	names []string
+}
+
+func (r *nameRecorder) Event(obj runtime.Object, _ event.Event) {
+	r.names = append(r.names, obj.(client.Object).GetName())
+}
+
+func (r *nameRecorder) WithAnnotations(...string) event.Recorder {
+	return r
+}
+
+func TestReconcilerReportCycle(t *testing.T) {
+	packages := []v1.LockPackage{
+		{
+			Name:         "nddp-a-1234",
+			Type:         pkgmetav1.ProviderPackageType,
+			Source:       "registry.lab/yndd/nddp-a",
+			Dependencies: []pkgmetav1.Dependency{{Package: "registry.lab/yndd/nddp-b"}},
+		},
+		{
+			Name:         "nddp-b-1234",
+			Type:         pkgmetav1.ProviderPackageType,
+			Source:       "registry.lab/yndd/nddp-b",
+			Dependencies: []pkgmetav1.Dependency{{Package: "registry.lab/yndd/nddp-a"}},
+		},
+	}
+	d := dag.NewMapDag()
+	if _, err := d.Init(v1.ToNodes(packages...)); err != nil {
+		t.Fatal(err)
+	}
+	_, cycle := d.Sort()
+	if !dag.IsCycle(cycle) {
+		t.Fatalf("Sort(): got error %v, want a cycle", cycle)
+	}
+
+	cases := map[string]struct {
+		reason    string
+		condition *nddv1.Condition
+		want      []string
+	}{
+		"FirstReport": {
+			reason: "A new cycle should be reported on the Lock and on the revision of every package in it.",
+			want:   []string{"lock", "nddp-a-1234", "nddp-b-1234"},
+		},
+		"Resolved": {
+			reason:    "A cycle in a Lock that was resolved before should be reported.",
+			condition: func() *nddv1.Condition { c := v1.DependenciesResolved(); return &c }(),
+			want:      []string{"lock", "nddp-a-1234", "nddp-b-1234"},
+		},
+		"AlreadyReported": {
+			reason:    "A cycle that is already reported should not be reported again.",
+			condition: func() *nddv1.Condition { c := v1.DependencyCycle(cycle.Error()); return &c }(),
+		},
+	}
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			s := runtime.NewScheme()
+			if err := v1.AddToScheme(s); err != nil {
+				t.Fatal(err)
+			}
+			lock := &v1.Lock{ObjectMeta: metav1.ObjectMeta{Name: "lock"}, Packages: packages}
+			if tc.condition != nil {
+				lock.SetConditions(*tc.condition)
+			}
+			c := fake.NewClientBuilder().WithScheme(s).WithObjects(
+				lock,
+				&v1.ProviderRevision{ObjectMeta: metav1.ObjectMeta{Name: "nddp-a-1234"}},
+				&v1.ProviderRevision{ObjectMeta: metav1.ObjectMeta{Name: "nddp-b-1234"}},
+			).Build()
+			rec := &nameRecorder{}
+			r := &Reconciler{client: c, log: logging.NewNopLogger(), record: rec}
+
+			if err := r.reportCycle(context.Background(), lock, cycle); err != nil {
+				t.Fatalf("\n%s\nreportCycle(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, rec.names, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("\n%s\nreportCycle(...): events recorded on -want, +got:\n%s", tc.reason, diff)
+			}
+			if got := lock.GetCondition(v1.ConditionKindDependenciesResolved); got.Reason != v1.ConditionReasonDependencyCycle {
+				t.Errorf("\n%s\nreportCycle(...): got condition reason %q, want %q", tc.reason, got.Reason, v1.ConditionReasonDependencyCycle)
+			}
+
+			// Reporting the same cycle again, e.g. on the next reconcile,
+			// should not record any more events.
+			rec.names = nil
+			if err := r.reportCycle(context.Background(), lock, cycle); err != nil {
+				t.Fatalf("\n%s\nreportCycle(...): %v", tc.reason, err)
+			}
+			if len(rec.names) != 0 {
+				t.Errorf("\n%s\nreportCycle(...): reported the same cycle again on %v", tc.reason, rec.names)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+	v1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	errGetDependentRevision = "cannot get revision of dependent package"
+	errGetDependent         = "cannot get dependent package"
+	errUnknownPolicyFmt     = "unknown dependency settings policy %q"
+)
+
+// A SettingsPolicy determines how the settings of the packages that depend on
+// a package are merged into the dependency package the resolver creates.
+type SettingsPolicy string
+
+const (
+	// SettingsPolicyUnion uses the pull secrets of all dependents, the most
+	// eager pull policy and the largest revision history limit of any
+	// dependent.
+	SettingsPolicyUnion SettingsPolicy = "Union"
+
+	// SettingsPolicyFirst uses the settings of the first dependent in the
+	// Lock.
+	SettingsPolicyFirst SettingsPolicy = "First"
+
+	// SettingsPolicyNone creates dependency packages with default settings.
+	SettingsPolicyNone SettingsPolicy = "None"
+
+	// DefaultSettingsPolicy is the SettingsPolicy used if none is specified.
+	DefaultSettingsPolicy = SettingsPolicyUnion
+)
+
+// ParseSettingsPolicy parses the supplied string as a SettingsPolicy. An empty
+// string is the DefaultSettingsPolicy.
+func ParseSettingsPolicy(s string) (SettingsPolicy, error) {
+	if s == "" {
+		return DefaultSettingsPolicy, nil
+	}
+	switch p := SettingsPolicy(s); p {
+	case SettingsPolicyUnion, SettingsPolicyFirst, SettingsPolicyNone:
+		return p, nil
+	}
+	return "", errors.Errorf(errUnknownPolicyFmt, s)
+}
+
+// pullPolicyRank orders pull policies from least to most eager to fetch.
+var pullPolicyRank = map[corev1.PullPolicy]int{
+	corev1.PullNever:        0,
+	corev1.PullIfNotPresent: 1,
+	corev1.PullAlways:       2,
+}
+
+// dependents returns the packages in the Lock that depend on the supplied
+// package source, in the order they appear in the Lock.
+func (r *Reconciler) dependents(ctx context.Context, lock *v1.Lock, source string) ([]v1.Package, error) {
+	pkgs := []v1.Package{}
+	for _, lp := range lock.Packages {
+		if !dependsOn(lp, source) {
+			continue
+		}
+		var pr v1.PackageRevision
+		var p v1.Package
+		switch lp.Type {
+		case pkgmetav1.ProviderPackageType:
+			pr = &v1.ProviderRevision{}
+			p = &v1.Provider{}
+		case pkgmetav1.IntentPackageType:
+			pr = &v1.IntentRevision{}
+			p = &v1.Intent{}
+		default:
+			continue
+		}
+		if err := r.client.Get(ctx, types.NamespacedName{Name: lp.Name}, pr); err != nil {
+			return nil, errors.Wrap(err, errGetDependentRevision)
+		}
+		parent, ok := pr.GetLabels()[v1.ParentLabelKey]
+		if !ok {
+			continue
+		}
+		if err := r.client.Get(ctx, types.NamespacedName{Name: parent}, p); err != nil {
+			return nil, errors.Wrap(err, errGetDependent)
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+func dependsOn(lp v1.LockPackage, source string) bool {
+	for _, d := range lp.Dependencies {
+		if d.Package == source {
+			return true
+		}
+	}
+	return false
+}
+
+// inheritSettings sets the pull secrets, pull policy and revision history
+// limit of the supplied dependency package from its dependents according to
+// the supplied policy.
+func inheritSettings(policy SettingsPolicy, dependents []v1.Package, pack v1.Package) {
+	if len(dependents) == 0 {
+		return
+	}
+	switch policy {
+	case SettingsPolicyFirst:
+		d := dependents[0]
+		pack.SetPackagePullSecrets(d.GetPackagePullSecrets())
+		pack.SetPackagePullPolicy(d.GetPackagePullPolicy())
+		pack.SetRevisionHistoryLimit(d.GetRevisionHistoryLimit())
+	case SettingsPolicyUnion:
+		var secrets []corev1.LocalObjectReference
+		seen := map[string]bool{}
+		var pull *corev1.PullPolicy
+		var limit *int64
+		for _, d := range dependents {
+			for _, s := range d.GetPackagePullSecrets() {
+				if seen[s.Name] {
+					continue
+				}
+				seen[s.Name] = true
+				secrets = append(secrets, s)
+			}
+			if pp := d.GetPackagePullPolicy(); pp != nil && (pull == nil || pullPolicyRank[*pp] > pullPolicyRank[*pull]) {
+				pull = pp
+			}
+			if l := d.GetRevisionHistoryLimit(); l != nil && (limit == nil || *l > *limit) {
+				limit = l
+			}
+		}
+		pack.SetPackagePullSecrets(secrets)
+		pack.SetPackagePullPolicy(pull)
+		pack.SetRevisionHistoryLimit(limit)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"testing"
+)
+
+func TestParseSettingsPolicy(t *testing.T) {
+	cases := map[string]struct {
+		reason  string
+		s       string
+		want    SettingsPolicy
+		wantErr bool
+	}{
+		"Empty": {
+			reason: "An unspecified policy should be the default policy.",
+			want:   DefaultSettingsPolicy,
+		},
+		"Union": {
+			reason: "The Union policy should be parsed.",
+			s:      "Union",
+			want:   SettingsPolicyUnion,
+		},
+		"First": {
+			reason: "The First policy should be parsed.",
+			s:      "First",
+			want:   SettingsPolicyFirst,
+		},
+		"None": {
+			reason: "The None policy should be parsed.",
+			s:      "None",
+			want:   SettingsPolicyNone,
+		},
+		"Unknown": {
+			reason:  "An unknown policy should be rejected.",
+			s:       "union",
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseSettingsPolicy(tc.s)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("\n%s\nParseSettingsPolicy(%q): error %v, want error %t", tc.reason, tc.s, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("\n%s\nParseSettingsPolicy(%q): got %q, want %q", tc.reason, tc.s, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+	"github.com/yndd/ndd-core/internal/nddpkg"
+)
+
+const (
+	// maxSolveSteps bounds the number of versions the solver tries before
+	// giving up on a dependency graph.
+	maxSolveSteps = 1000
+
+	errUnsatisfiable  = "cannot find versions that satisfy all package constraints"
+	errNoVersionFmt   = "no version of %s satisfies %s"
+	errInstalledFmt   = "installed version %s of %s does not satisfy %s"
+	errRequirementFmt = "%s requires %s"
+	errTooManySteps   = "cannot resolve package versions: dependency graph is too complex"
+)
+
+// A requirement is a version constraint that a package places on one of its
+// dependencies.
+type requirement struct {
+	from       string
+	constraint string
+	c          *semver.Constraints
+}
+
+func (r requirement) String() string {
+	c := r.constraint
+	if c == "" {
+		c = "any version"
+	}
+	return fmt.Sprintf(errRequirementFmt, r.from, c)
+}
+
+// An unsatisfiableError is returned when no version of a package satisfies the
+// constraints of all packages that depend on it.
+type unsatisfiableError struct {
+	source       string
+	installed    *semver.Version
+	requirements []requirement
+}
+
+func (e *unsatisfiableError) Error() string {
+	rs := make([]string, len(e.requirements))
+	for i, r := range e.requirements {
+		rs[i] = r.String()
+	}
+	if e.installed != nil {
+		return fmt.Sprintf("%s: "+errInstalledFmt, errUnsatisfiable, e.installed.Original(), e.source, strings.Join(rs, ", "))
+	}
+	return fmt.Sprintf("%s: "+errNoVersionFmt, errUnsatisfiable, e.source, strings.Join(rs, ", "))
+}
+
+// IsUnsatisfiable returns true if the supplied error indicates that the
+// version constraints of the packages in the dependency graph cannot all be
+// satisfied.
+func IsUnsatisfiable(err error) bool {
+	var ue *unsatisfiableError
+	return errors.As(err, &ue)
+}
+
+// A solver picks a version for every package in the dependency graph such
+// that the version constraints of all packages that depend on it are
+// satisfied. It searches depth first, trying the installed version and then
+// the highest versions first, and backtracks when a choice leads to a
+// conflict further down the graph. Fixed packages, i.e. packages that were not
+// installed as a dependency, keep their installed version.
+type solver struct {
+	// versions returns the available versions of a package.
+	versions func(ctx context.Context, source string) ([]*semver.Version, error)
+
+	// dependencies returns the dependencies of a version of a package.
+	dependencies func(ctx context.Context, source string, v *semver.Version) ([]pkgmetav1.Dependency, error)
+
+	// installed versions of packages are preferred over other versions.
+	installed map[string]*semver.Version
+
+	// fixed packages must stay at their installed version.
+	fixed map[string]bool
+
+	steps int
+}
+
+// Solve returns a version for every package that is required by one of the
+// fixed packages, directly or transitively.
+func (s *solver) Solve(ctx context.Context, deps map[string][]pkgmetav1.Dependency) (map[string]*semver.Version, error) {
+	assigned := map[string]*semver.Version{}
+	reqs := map[string][]requirement{}
+	fixed := make([]string, 0, len(s.fixed))
+	for src := range s.fixed {
+		assigned[src] = s.installed[src]
+		fixed = append(fixed, src)
+	}
+	// Requirements are added in order so that errors do not depend on map
+	// iteration.
+	sort.Strings(fixed)
+	for _, src := range fixed {
+		if err := require(src, deps[src], assigned, reqs); err != nil {
+			return nil, err
+		}
+	}
+	return s.solve(ctx, assigned, reqs)
+}
+
+func (s *solver) solve(ctx context.Context, assigned map[string]*semver.Version, reqs map[string][]requirement) (map[string]*semver.Version, error) {
+	// Pick the next required package without a version. Packages are picked
+	// in order so that the result does not depend on map iteration.
+	next := ""
+	for src := range reqs {
+		if _, ok := assigned[src]; !ok && (next == "" || src < next) {
+			next = src
+		}
+	}
+	if next == "" {
+		return assigned, nil
+	}
+
+	// Prefer the installed version, such that installed dependencies are only
+	// upgraded when needed. Other versions are only listed if the installed
+	// version does not work out.
+	var conflict error = &unsatisfiableError{source: next, requirements: reqs[next]}
+	if v := s.installed[next]; v != nil && satisfies(v, reqs[next]) {
+		solved, err := s.try(ctx, next, v, assigned, reqs)
+		if !IsUnsatisfiable(err) {
+			return solved, err
+		}
+		conflict = err
+	}
+
+	vs, err := s.versions(ctx, next)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(semver.Collection(vs)))
+	for _, v := range vs {
+		if !satisfies(v, reqs[next]) || (s.installed[next] != nil && v.Equal(s.installed[next])) {
+			continue
+		}
+		solved, err := s.try(ctx, next, v, assigned, reqs)
+		if !IsUnsatisfiable(err) {
+			return solved, err
+		}
+		conflict = err
+	}
+	return nil, conflict
+}
+
+// try assigns the supplied version to a package and solves the remainder of
+// the graph.
+func (s *solver) try(ctx context.Context, source string, v *semver.Version, assigned map[string]*semver.Version, reqs map[string][]requirement) (map[string]*semver.Version, error) {
+	s.steps++
+	if s.steps > maxSolveSteps {
+		return nil, errors.New(errTooManySteps)
+	}
+	deps, err := s.dependencies(ctx, source, v)
+	if err != nil {
+		return nil, err
+	}
+	a := make(map[string]*semver.Version, len(assigned)+1)
+	for src, av := range assigned {
+		a[src] = av
+	}
+	a[source] = v
+	r := make(map[string][]requirement, len(reqs))
+	for src, rs := range reqs {
+		r[src] = append([]requirement{}, rs...)
+	}
+	if err := require(source, deps, a, r); err != nil {
+		return nil, err
+	}
+	return s.solve(ctx, a, r)
+}
+
+// require adds the requirements of the supplied package on its dependencies.
+// It returns an error if a dependency that already has a version does not
+// satisfy them.
+func require(from string, deps []pkgmetav1.Dependency, assigned map[string]*semver.Version, reqs map[string][]requirement) error {
+	for _, d := range deps {
+		c, err := nddpkg.ParseConstraint(d.Constraints)
+		if err != nil {
+			return errors.Wrapf(err, "%s: %s", errInvalidConstraint, fmt.Sprintf(errRequirementFmt, from, d.Constraints))
+		}
+		reqs[d.Package] = append(reqs[d.Package], requirement{from: from, constraint: d.Constraints, c: c})
+		// Installed packages whose version is not a semantic version cannot
+		// be checked against constraints.
+		if v, ok := assigned[d.Package]; ok && v != nil && !c.Check(v) {
+			return &unsatisfiableError{source: d.Package, installed: v, requirements: reqs[d.Package]}
+		}
+	}
+	return nil
+}
+
+func satisfies(v *semver.Version, reqs []requirement) bool {
+	for _, r := range reqs {
+		if !r.c.Check(v) {
+			return false
+		}
+	}
+	return true
+}
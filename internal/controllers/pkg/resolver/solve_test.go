@@ -0,0 +1,269 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/pkg/errors"
+
+	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+)
+
+// A graph holds the dependencies of every available version of every package.
+type graph map[string]map[string][]pkgmetav1.Dependency
+
+func (g graph) versions(_ context.Context, source string) ([]*semver.Version, error) {
+	vs := []*semver.Version{}
+	for v := range g[source] {
+		vs = append(vs, semver.MustParse(v))
+	}
+	return vs, nil
+}
+
+func (g graph) dependencies(_ context.Context, source string, v *semver.Version) ([]pkgmetav1.Dependency, error) {
+	deps, ok := g[source][v.Original()]
+	if !ok {
+		return nil, errors.Errorf("unknown version %s of %s", v.Original(), source)
+	}
+	return deps, nil
+}
+
+func dep(source, constraint string) pkgmetav1.Dependency {
+	return pkgmetav1.Dependency{Package: source, Type: pkgmetav1.ProviderPackageType, Constraints: constraint}
+}
+
+// versions returns a map of the supplied versions, which may be nil.
+func versions(vs map[string]string) map[string]*semver.Version {
+	m := make(map[string]*semver.Version, len(vs))
+	for src, v := range vs {
+		if v == "" {
+			m[src] = nil
+			continue
+		}
+		m[src] = semver.MustParse(v)
+	}
+	return m
+}
+
+func TestSolverSolve(t *testing.T) {
+	// manyVersions has more versions than the solver may try, none of which
+	// work out because every version of the package it depends on is
+	// excluded.
+	manyVersions := map[string][]pkgmetav1.Dependency{}
+	for i := 0; i <= maxSolveSteps; i++ {
+		manyVersions[fmt.Sprintf("v0.0.%d", i)] = []pkgmetav1.Dependency{dep("yndd/nddp-c", ">=2.0.0")}
+	}
+
+	type args struct {
+		graph graph
+		// installed and fixed packages are those in the Lock; fixed ones are
+		// not controlled by the Lock.
+		installed map[string]string
+		fixed     []string
+		deps      map[string][]pkgmetav1.Dependency
+	}
+	type want struct {
+		solved        map[string]string
+		err           string
+		unsatisfiable bool
+	}
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Highest": {
+			reason: "The highest version that satisfies the constraint should be picked for a new dependency.",
+			args: args{
+				graph:     graph{"yndd/nddp-c": {"v1.0.0": nil, "v1.1.0": nil, "v2.0.0": nil}},
+				installed: map[string]string{"yndd/nddp-a": "v1.0.0"},
+				fixed:     []string{"yndd/nddp-a"},
+				deps:      map[string][]pkgmetav1.Dependency{"yndd/nddp-a": {dep("yndd/nddp-c", "^1.0")}},
+			},
+			want: want{solved: map[string]string{"yndd/nddp-a": "v1.0.0", "yndd/nddp-c": "v1.1.0"}},
+		},
+		"PreferInstalled": {
+			reason: "An installed dependency that satisfies all constraints should keep its version, even if a newer version exists.",
+			args: args{
+				graph:     graph{"yndd/nddp-c": {"v1.0.0": nil, "v1.1.0": nil}},
+				installed: map[string]string{"yndd/nddp-a": "v1.0.0", "yndd/nddp-c": "v1.0.0"},
+				fixed:     []string{"yndd/nddp-a"},
+				deps:      map[string][]pkgmetav1.Dependency{"yndd/nddp-a": {dep("yndd/nddp-c", ">=1.0.0")}},
+			},
+			want: want{solved: map[string]string{"yndd/nddp-a": "v1.0.0", "yndd/nddp-c": "v1.0.0"}},
+		},
+		"UpgradeControlled": {
+			reason: "A dependency the Lock controls should be upgraded if its installed version no longer satisfies the packages that depend on it.",
+			args: args{
+				graph:     graph{"yndd/nddp-c": {"v1.0.0": nil, "v1.1.0": nil, "v1.2.0": nil}},
+				installed: map[string]string{"yndd/nddp-a": "v1.0.0", "yndd/nddp-c": "v1.0.0"},
+				fixed:     []string{"yndd/nddp-a"},
+				deps:      map[string][]pkgmetav1.Dependency{"yndd/nddp-a": {dep("yndd/nddp-c", ">=1.1.0")}},
+			},
+			want: want{solved: map[string]string{"yndd/nddp-a": "v1.0.0", "yndd/nddp-c": "v1.2.0"}},
+		},
+		"FixedNotUpgraded": {
+			reason: "A package the Lock does not control should keep its installed version and be reported if it does not satisfy a dependent.",
+			args: args{
+				graph:     graph{"yndd/nddp-c": {"v1.0.0": nil, "v1.1.0": nil}},
+				installed: map[string]string{"yndd/nddp-a": "v1.0.0", "yndd/nddp-c": "v1.0.0"},
+				fixed:     []string{"yndd/nddp-a", "yndd/nddp-c"},
+				deps:      map[string][]pkgmetav1.Dependency{"yndd/nddp-a": {dep("yndd/nddp-c", ">=1.1.0")}},
+			},
+			want: want{
+				err:           "cannot find versions that satisfy all package constraints: installed version v1.0.0 of yndd/nddp-c does not satisfy yndd/nddp-a requires >=1.1.0",
+				unsatisfiable: true,
+			},
+		},
+		"FixedUnversioned": {
+			reason: "A package the Lock does not control whose version is not a semantic version cannot be checked and should be left alone.",
+			args: args{
+				installed: map[string]string{"yndd/nddp-a": "v1.0.0", "yndd/nddp-c": ""},
+				fixed:     []string{"yndd/nddp-a", "yndd/nddp-c"},
+				deps:      map[string][]pkgmetav1.Dependency{"yndd/nddp-a": {dep("yndd/nddp-c", ">=1.1.0")}},
+			},
+			want: want{solved: map[string]string{"yndd/nddp-a": "v1.0.0", "yndd/nddp-c": ""}},
+		},
+		"Conflict": {
+			reason: "Two dependents with constraints no version satisfies should be reported together.",
+			args: args{
+				graph:     graph{"yndd/nddp-c": {"v1.0.0": nil, "v2.0.0": nil}},
+				installed: map[string]string{"yndd/nddp-a": "v1.0.0", "yndd/nddp-b": "v1.0.0"},
+				fixed:     []string{"yndd/nddp-a", "yndd/nddp-b"},
+				deps: map[string][]pkgmetav1.Dependency{
+					"yndd/nddp-a": {dep("yndd/nddp-c", "~1.0")},
+					"yndd/nddp-b": {dep("yndd/nddp-c", ">=2.0.0")},
+				},
+			},
+			want: want{
+				err:           "cannot find versions that satisfy all package constraints: no version of yndd/nddp-c satisfies yndd/nddp-a requires ~1.0, yndd/nddp-b requires >=2.0.0",
+				unsatisfiable: true,
+			},
+		},
+		"AnyVersion": {
+			reason: "A dependency without a constraint should be reported as requiring any version.",
+			args: args{
+				graph:     graph{"yndd/nddp-c": {}},
+				installed: map[string]string{"yndd/nddp-a": "v1.0.0"},
+				fixed:     []string{"yndd/nddp-a"},
+				deps:      map[string][]pkgmetav1.Dependency{"yndd/nddp-a": {dep("yndd/nddp-c", "")}},
+			},
+			want: want{
+				err:           "cannot find versions that satisfy all package constraints: no version of yndd/nddp-c satisfies yndd/nddp-a requires any version",
+				unsatisfiable: true,
+			},
+		},
+		"Transitive": {
+			reason: "Dependencies of dependencies should be solved.",
+			args: args{
+				graph: graph{
+					"yndd/nddp-b": {"v1.0.0": {dep("yndd/nddp-c", "~1.0")}},
+					"yndd/nddp-c": {"v1.0.0": nil, "v2.0.0": nil},
+				},
+				installed: map[string]string{"yndd/nddp-a": "v1.0.0"},
+				fixed:     []string{"yndd/nddp-a"},
+				deps:      map[string][]pkgmetav1.Dependency{"yndd/nddp-a": {dep("yndd/nddp-b", "")}},
+			},
+			want: want{solved: map[string]string{"yndd/nddp-a": "v1.0.0", "yndd/nddp-b": "v1.0.0", "yndd/nddp-c": "v1.0.0"}},
+		},
+		"Backtrack": {
+			reason: "A version that leads to a conflict further down the graph should be replaced by a lower version.",
+			args: args{
+				graph: graph{
+					"yndd/nddp-b": {
+						"v1.0.0": {dep("yndd/nddp-c", "~1.0")},
+						"v2.0.0": {dep("yndd/nddp-c", ">=2.0.0")},
+					},
+					"yndd/nddp-c": {"v1.0.0": nil, "v2.0.0": nil},
+				},
+				installed: map[string]string{"yndd/nddp-a": "v1.0.0"},
+				fixed:     []string{"yndd/nddp-a"},
+				deps: map[string][]pkgmetav1.Dependency{"yndd/nddp-a": {
+					dep("yndd/nddp-b", ""),
+					dep("yndd/nddp-c", "~1.0"),
+				}},
+			},
+			want: want{solved: map[string]string{"yndd/nddp-a": "v1.0.0", "yndd/nddp-b": "v1.0.0", "yndd/nddp-c": "v1.0.0"}},
+		},
+		"TooManySteps": {
+			reason: "The solver should give up on a dependency graph that takes too many steps to solve.",
+			args: args{
+				graph: graph{
+					"yndd/nddp-b": manyVersions,
+					"yndd/nddp-c": {"v1.0.0": nil},
+				},
+				installed: map[string]string{"yndd/nddp-a": "v1.0.0"},
+				fixed:     []string{"yndd/nddp-a"},
+				deps:      map[string][]pkgmetav1.Dependency{"yndd/nddp-a": {dep("yndd/nddp-b", "")}},
+			},
+			want: want{err: errTooManySteps},
+		},
+		"InvalidConstraint": {
+			reason: "A constraint that cannot be parsed should return an error.",
+			args: args{
+				installed: map[string]string{"yndd/nddp-a": "v1.0.0"},
+				fixed:     []string{"yndd/nddp-a"},
+				deps:      map[string][]pkgmetav1.Dependency{"yndd/nddp-a": {dep("yndd/nddp-c", "~~")}},
+			},
+			want: want{err: errInvalidConstraint + ": yndd/nddp-a requires ~~: improper constraint: ~~"},
+		},
+	}
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			fixed := map[string]bool{}
+			for _, src := range tc.args.fixed {
+				fixed[src] = true
+			}
+			s := &solver{
+				versions:     tc.args.graph.versions,
+				dependencies: tc.args.graph.dependencies,
+				installed:    versions(tc.args.installed),
+				fixed:        fixed,
+			}
+
+			got, err := s.Solve(context.Background(), tc.args.deps)
+			if tc.want.err != "" {
+				if err == nil || err.Error() != tc.want.err {
+					t.Fatalf("\n%s\nSolve(...): got error %v, want %q", tc.reason, err, tc.want.err)
+				}
+				if IsUnsatisfiable(err) != tc.want.unsatisfiable {
+					t.Errorf("\n%s\nIsUnsatisfiable(...): got %t, want %t", tc.reason, IsUnsatisfiable(err), tc.want.unsatisfiable)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("\n%s\nSolve(...): %v", tc.reason, err)
+			}
+			solved := make(map[string]string, len(got))
+			for src, v := range got {
+				solved[src] = ""
+				if v != nil {
+					solved[src] = v.Original()
+				}
+			}
+			if diff := cmp.Diff(tc.want.solved, solved, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("\n%s\nSolve(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -40,7 +40,7 @@ func renderCertificate(p *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpec, c *pkg
 			Labels: map[string]string{
 				getLabelKey(extra.Name): serviceName,
 			},
-			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.ProviderRevisionGroupVersionKind))},
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.RevisionGroupVersionKind(pr)))},
 		},
 		Spec: certv1.CertificateSpec{
 			DNSNames: []string{
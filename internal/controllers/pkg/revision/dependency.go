@@ -42,6 +42,9 @@ const (
 	errMissingDependenciesFmt    = "missing dependencies: %+v"
 	errDependencyNotInGraph      = "dependency is not present in graph"
 	errDependencyNotLockPackage  = "dependency in graph is not a lock package"
+
+	reasonDependencyMissing     = "dependency is not installed yet"
+	reasonDependencyUnsatisfied = "installed version does not satisfy constraint"
 )
 
 // DependencyManager is a lock on packages.
@@ -68,7 +71,7 @@ func NewPackageDependencyManager(c client.Client, nd dag.NewDAGFn, t pkgmetav1.P
 
 // Resolve resolves package dependencies.
 func (m *PackageDependencyManager) Resolve(ctx context.Context, pkg runtime.Object, pr v1.PackageRevision) (found, installed, invalid int, err error) { // nolint:gocyclo
-	pack, ok := nddpkg.TryConvertToPkg(pkg, &pkgmetav1.Provider{})
+	pack, ok := nddpkg.TryConvertToPkg(pkg, &pkgmetav1.Provider{}, &pkgmetav1.Intent{})
 	if !ok {
 		return found, installed, invalid, errors.New(errNotMeta)
 	}
@@ -76,9 +79,15 @@ func (m *PackageDependencyManager) Resolve(ctx context.Context, pkg runtime.Obje
 	// Copy package dependencies into Lock Dependencies.
 	sources := make([]pkgmetav1.Dependency, len(pack.GetDependencies()))
 	for i, dep := range pack.GetDependencies() {
+		// Dependencies are providers unless they declare otherwise.
+		t := dep.Type
+		if t == "" {
+			t = pkgmetav1.ProviderPackageType
+		}
 		pdep := pkgmetav1.Dependency{
-			Package: dep.Package,
-			Type:    pkgmetav1.ProviderPackageType,
+			Package:     dep.Package,
+			Type:        t,
+			Constraints: dep.Constraints,
 		}
 		sources[i] = pdep
 	}
@@ -101,12 +110,10 @@ func (m *PackageDependencyManager) Resolve(ctx context.Context, pkg runtime.Obje
 		return found, installed, invalid, errors.Wrap(err, errGetOrCreateLock)
 	}
 
-	prRef, err := name.ParseReference(pr.GetSource(), name.WithDefaultRegistry(""))
+	lockRef, node, version, err := lockIdentity(pr)
 	if err != nil {
 		return found, installed, invalid, err
 	}
-
-	lockRef := nddpkg.ParsePackageSourceFromReference(prRef)
 	selfIndex := intPointer(-1)
 	d := m.newDag()
 	implied, err := d.Init(v1.ToNodes(lock.Packages...), dag.FindIndex(lockRef, selfIndex))
@@ -129,10 +136,12 @@ func (m *PackageDependencyManager) Resolve(ctx context.Context, pkg runtime.Obje
 		Name:         pr.GetName(),
 		Type:         m.packageType,
 		Source:       lockRef,
-		Version:      prRef.Identifier(),
+		Version:      version,
 		Dependencies: sources,
 	}
 
+	pr.SetDependencies(dependencyStatuses(d, self.Dependencies))
+
 	// If we don't exist in lock then we should add self.
 	if *selfIndex == -1 {
 		lock.Packages = append(lock.Packages, self)
@@ -158,7 +167,7 @@ func (m *PackageDependencyManager) Resolve(ctx context.Context, pkg runtime.Obje
 		}
 	}
 
-	tree, err := d.TraceNode(prRef.Context().String())
+	tree, err := d.TraceNode(node)
 	if err != nil {
 		return found, installed, invalid, err
 	}
@@ -198,7 +207,7 @@ func (m *PackageDependencyManager) Resolve(ctx context.Context, pkg runtime.Obje
 			if !ok {
 				return found, installed, invalid, errors.New(errDependencyNotLockPackage)
 			}
-			c, err := semver.NewConstraint(dep.Constraints)
+			c, err := nddpkg.ParseConstraint(dep.Constraints)
 			if err != nil {
 				return found, installed, invalid, err
 			}
@@ -218,9 +227,50 @@ func (m *PackageDependencyManager) Resolve(ctx context.Context, pkg runtime.Obje
 	return found, installed, invalid, nil
 }
 
+// dependencyStatuses returns the state of each of the supplied dependencies in
+// the dependency graph.
+func dependencyStatuses(d dag.DAG, deps []pkgmetav1.Dependency) []v1.DependencyStatus {
+	statuses := make([]v1.DependencyStatus, len(deps))
+	for i, dep := range deps {
+		ds := v1.DependencyStatus{
+			Package:     dep.Package,
+			Constraints: dep.Constraints,
+			State:       v1.DependencyMissing,
+			Reason:      reasonDependencyMissing,
+		}
+		// A dependency that is only implied by other packages is not a
+		// lock package.
+		n, err := d.GetNode(dep.Package)
+		lp, ok := n.(*v1.LockPackage)
+		if err != nil || !ok {
+			statuses[i] = ds
+			continue
+		}
+		ds.Version = lp.Version
+		ds.State, ds.Reason = v1.DependencySatisfied, ""
+		c, err := nddpkg.ParseConstraint(dep.Constraints)
+		if err != nil {
+			ds.State, ds.Reason = v1.DependencyInvalid, err.Error()
+			statuses[i] = ds
+			continue
+		}
+		v, err := semver.NewVersion(lp.Version)
+		if err != nil {
+			ds.State, ds.Reason = v1.DependencyInvalid, err.Error()
+			statuses[i] = ds
+			continue
+		}
+		if !c.Check(v) {
+			ds.State, ds.Reason = v1.DependencyUnsatisfied, reasonDependencyUnsatisfied
+		}
+		statuses[i] = ds
+	}
+	return statuses
+}
+
 // RemoveSelf removes a package from the lock.
 func (m *PackageDependencyManager) RemoveSelf(ctx context.Context, pr v1.PackageRevision) error {
-	prRef, err := name.ParseReference(pr.GetSource(), name.WithDefaultRegistry(""))
+	_, node, _, err := lockIdentity(pr)
 	if err != nil {
 		return err
 	}
@@ -233,7 +283,7 @@ func (m *PackageDependencyManager) RemoveSelf(ctx context.Context, pr v1.Package
 
 	// Find self and remove. If we don't exist, its a no-op.
 	for i, lp := range lock.Packages {
-		if lp.Source == prRef.Context().String() {
+		if lp.Source == node {
 			lock.Packages = append(lock.Packages[:i], lock.Packages[i+1:]...)
 			return m.client.Update(ctx, lock)
 		}
@@ -241,6 +291,22 @@ func (m *PackageDependencyManager) RemoveSelf(ctx context.Context, pr v1.Package
 	return nil
 }
 
+// lockIdentity returns the source a package revision is recorded with in the
+// lock, the node it is traced as in the dependency graph and its version.
+// Packages that do not come from a registry are identified by their source
+// URL without checksum.
+func lockIdentity(pr v1.PackageRevision) (string, string, string, error) {
+	if u, ok := nddpkg.ParseSourceURL(pr.GetSource()); ok {
+		source := nddpkg.SourceIdentity(u)
+		return source, source, u.Fragment, nil
+	}
+	prRef, err := name.ParseReference(pr.GetSource(), name.WithDefaultRegistry(""))
+	if err != nil {
+		return "", "", "", err
+	}
+	return nddpkg.ParsePackageSourceFromReference(prRef), prRef.Context().String(), prRef.Identifier(), nil
+}
+
 func intPointer(i int) *int {
 	return &i
 }
@@ -24,7 +24,6 @@ import (
 	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
 	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
 	"github.com/yndd/ndd-runtime/pkg/meta"
-	"github.com/yndd/ndd-runtime/pkg/utils"
 )
 
 func renderProviderDeployment(pm *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpec, pr pkgv1.PackageRevision, o *Options) *appsv1.Deployment {
@@ -32,10 +31,10 @@ func renderProviderDeployment(pm *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpec
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            pr.GetName(),
 			Namespace:       pm.Namespace,
-			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.ProviderRevisionGroupVersionKind))},
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.RevisionGroupVersionKind(pr)))},
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: utils.Int32Ptr(1),
+			Replicas: getReplicas(pr),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: getLabels(podSpec, pr),
 			},
@@ -92,7 +91,7 @@ func buildProviderDeployment(provider *pkgmetav1.Provider, revision v1.PackageRe
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            revision.GetName(),
 			Namespace:       namespace,
-			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(revision, v1.ProviderRevisionGroupVersionKind))},
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(revision, v1.RevisionGroupVersionKind(revision)))},
 		},
 	}
 
@@ -102,7 +101,7 @@ func buildProviderDeployment(provider *pkgmetav1.Provider, revision v1.PackageRe
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            revision.GetName(),
 			Namespace:       namespace,
-			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(revision, v1.ProviderRevisionGroupVersionKind))},
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(revision, v1.RevisionGroupVersionKind(revision)))},
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: utils.Int32Ptr(1),
@@ -0,0 +1,212 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-runtime/pkg/parser"
+	rbacv1 "k8s.io/api/rbac/v1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	extv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	errListPackageRevisions = "cannot list package revisions"
+	errInitPreviousBackend  = "cannot initialize parser backend for previous package revision"
+	errParsePrevious        = "cannot parse previous package revision contents"
+)
+
+// diff records the changes pr introduces with respect to the revision of the
+// same package it follows. The diff is computed whatever the desired state of
+// pr, such that it is also recorded for revisions that are activated
+// automatically. Revision contents never change, so the diff is only computed
+// once for every previous revision, and an active revision keeps the diff it
+// was activated with.
+func (r *Reconciler) diff(ctx context.Context, pr pkgv1.PackageRevision, pkg *parser.Package) error {
+	if pr.GetDiff() != nil && pr.GetDesiredState() == pkgv1.PackageRevisionActive {
+		return nil
+	}
+	prev, err := r.previousRevision(ctx, pr)
+	if err != nil || prev == nil {
+		return err
+	}
+	if d := pr.GetDiff(); d != nil && d.PreviousRevision == prev.GetName() {
+		return nil
+	}
+	reader, err := r.backend.Init(ctx, PackageRevision(prev))
+	if err != nil {
+		return errors.Wrap(err, errInitPreviousBackend)
+	}
+	prevPkg, err := r.parser.Parse(ctx, reader)
+	if err != nil {
+		return errors.Wrap(err, errParsePrevious)
+	}
+	pr.SetDiff(diffPackages(prev.GetName(), prevPkg, pkg))
+	return nil
+}
+
+// previousRevision returns the revision pr follows, or nil if there is none.
+// That is the active revision that precedes pr, or, once pr replaced it, the
+// highest numbered revision that precedes pr.
+func (r *Reconciler) previousRevision(ctx context.Context, pr pkgv1.PackageRevision) (pkgv1.PackageRevision, error) {
+	parent, ok := pr.GetLabels()[pkgv1.ParentLabelKey]
+	if !ok {
+		return nil, nil
+	}
+	prs := r.newPackageRevisionList()
+	if err := r.client.List(ctx, prs, client.MatchingLabels(map[string]string{pkgv1.ParentLabelKey: parent})); err != nil {
+		return nil, errors.Wrap(err, errListPackageRevisions)
+	}
+	var active, latest pkgv1.PackageRevision
+	for _, rev := range prs.GetRevisions() {
+		if rev.GetName() == pr.GetName() || rev.GetRevision() >= pr.GetRevision() {
+			continue
+		}
+		if latest == nil || rev.GetRevision() > latest.GetRevision() {
+			latest = rev
+		}
+		if rev.GetDesiredState() == pkgv1.PackageRevisionActive && (active == nil || rev.GetRevision() > active.GetRevision()) {
+			active = rev
+		}
+	}
+	if active != nil {
+		return active, nil
+	}
+	return latest, nil
+}
+
+// diffPackages summarizes the changes between the contents of two revisions
+// of a package.
+func diffPackages(prevName string, prev, cur *parser.Package) *pkgv1.RevisionDiff {
+	d := &pkgv1.RevisionDiff{PreviousRevision: prevName}
+
+	prevCRDs, curCRDs := crdSpecs(prev.GetObjects()), crdSpecs(cur.GetObjects())
+	for n, spec := range curCRDs {
+		prevSpec, ok := prevCRDs[n]
+		switch {
+		case !ok:
+			d.AddedCRDs = append(d.AddedCRDs, n)
+		case !equality.Semantic.DeepEqual(prevSpec, spec):
+			d.ChangedCRDs = append(d.ChangedCRDs, n)
+		}
+	}
+	for n := range prevCRDs {
+		if _, ok := curCRDs[n]; !ok {
+			d.RemovedCRDs = append(d.RemovedCRDs, n)
+		}
+	}
+	sort.Strings(d.AddedCRDs)
+	sort.Strings(d.RemovedCRDs)
+	sort.Strings(d.ChangedCRDs)
+
+	prevPod, curPod := providerPod(prev), providerPod(cur)
+	d.AddedPermissionRequests = subtractRules(curPod.PermissionRequests, prevPod.PermissionRequests)
+	d.RemovedPermissionRequests = subtractRules(prevPod.PermissionRequests, curPod.PermissionRequests)
+	d.Containers = diffContainers(prevPod.Containers, curPod.Containers)
+	return d
+}
+
+// crdSpecs returns the specs of the CRDs in objs keyed by CRD name.
+func crdSpecs(objs []runtime.Object) map[string]interface{} {
+	specs := map[string]interface{}{}
+	for _, o := range objs {
+		switch crd := o.(type) {
+		case *extv1.CustomResourceDefinition:
+			specs[crd.GetName()] = crd.Spec
+		case *extv1beta1.CustomResourceDefinition:
+			specs[crd.GetName()] = crd.Spec
+		}
+	}
+	return specs
+}
+
+// providerPod returns the controller pod of a provider or intent package, or
+// an empty pod if the package does not have one.
+func providerPod(pkg *parser.Package) *pkgmetav1.PodSpec {
+	if len(pkg.GetMeta()) != 1 {
+		return &pkgmetav1.PodSpec{}
+	}
+	pmp, ok := providerMeta(pkg.GetMeta()[0])
+	if !ok || pmp.Spec.Pod == nil {
+		return &pkgmetav1.PodSpec{}
+	}
+	return pmp.Spec.Pod
+}
+
+// subtractRules returns the rules in a that are not in b.
+func subtractRules(a, b []rbacv1.PolicyRule) []rbacv1.PolicyRule {
+	var rules []rbacv1.PolicyRule
+	for _, ra := range a {
+		found := false
+		for _, rb := range b {
+			if equality.Semantic.DeepEqual(ra, rb) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			rules = append(rules, ra)
+		}
+	}
+	return rules
+}
+
+// diffContainers returns the containers whose image or args changed, or that
+// were added or removed.
+func diffContainers(prev, cur []*pkgmetav1.ContainerSpec) []pkgv1.ContainerDiff {
+	diffs := map[string]*pkgv1.ContainerDiff{}
+	get := func(name string) *pkgv1.ContainerDiff {
+		if _, ok := diffs[name]; !ok {
+			diffs[name] = &pkgv1.ContainerDiff{Name: name}
+		}
+		return diffs[name]
+	}
+	for _, c := range prev {
+		if c == nil || c.Container == nil {
+			continue
+		}
+		cd := get(c.Container.Name)
+		cd.PreviousImage = c.Container.Image
+		cd.PreviousArgs = c.Container.Args
+	}
+	for _, c := range cur {
+		if c == nil || c.Container == nil {
+			continue
+		}
+		cd := get(c.Container.Name)
+		cd.Image = c.Container.Image
+		cd.Args = c.Container.Args
+	}
+
+	var result []pkgv1.ContainerDiff
+	for _, cd := range diffs {
+		if cd.PreviousImage == cd.Image && equality.Semantic.DeepEqual(cd.PreviousArgs, cd.Args) {
+			continue
+		}
+		result = append(result, *cd)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-core/internal/nddpkg"
+	"github.com/yndd/ndd-runtime/pkg/parser"
+)
+
+type backendFn func(ctx context.Context, o ...parser.BackendOption) (io.ReadCloser, error)
+
+func (fn backendFn) Init(ctx context.Context, o ...parser.BackendOption) (io.ReadCloser, error) {
+	return fn(ctx, o...)
+}
+
+// crdStream returns a package stream with a CRD of each of the supplied names.
+func crdStream(names ...string) string {
+	docs := make([]string, len(names))
+	for i, n := range names {
+		docs[i] = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: ` + n
+	}
+	return strings.Join(docs, "\n---\n")
+}
+
+func packageParser(t *testing.T) parser.Parser {
+	t.Helper()
+	meta, err := nddpkg.BuildMetaScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := nddpkg.BuildObjectScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parser.New(meta, obj)
+}
+
+func TestReconcilerDiff(t *testing.T) {
+	rev := func(name string, num int64, state pkgv1.PackageRevisionDesiredState) *pkgv1.ProviderRevision {
+		pr := &pkgv1.ProviderRevision{ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{pkgv1.ParentLabelKey: "pkg"},
+		}}
+		pr.SetRevision(num)
+		pr.SetDesiredState(state)
+		return pr
+	}
+
+	cases := map[string]struct {
+		reason    string
+		revisions []client.Object
+		pr        *pkgv1.ProviderRevision
+		want      *pkgv1.RevisionDiff
+	}{
+		"Inactive": {
+			reason:    "An inactive revision should be diffed against the active revision it would replace.",
+			revisions: []client.Object{rev("pkg-1", 1, pkgv1.PackageRevisionActive), rev("pkg-2", 2, pkgv1.PackageRevisionInactive)},
+			pr:        rev("pkg-3", 3, pkgv1.PackageRevisionInactive),
+			want:      &pkgv1.RevisionDiff{PreviousRevision: "pkg-1", AddedCRDs: []string{"new.example.org"}},
+		},
+		"ActivatedAutomatically": {
+			reason:    "A revision that was active from the start should be diffed against the revision it replaced.",
+			revisions: []client.Object{rev("pkg-1", 1, pkgv1.PackageRevisionInactive), rev("pkg-2", 2, pkgv1.PackageRevisionInactive)},
+			pr:        rev("pkg-3", 3, pkgv1.PackageRevisionActive),
+			want:      &pkgv1.RevisionDiff{PreviousRevision: "pkg-2", AddedCRDs: []string{"new.example.org"}},
+		},
+		"ActivatedBeforeReplacing": {
+			reason:    "A revision that was active from the start should be diffed against the active revision it is about to replace.",
+			revisions: []client.Object{rev("pkg-1", 1, pkgv1.PackageRevisionActive)},
+			pr:        rev("pkg-2", 2, pkgv1.PackageRevisionActive),
+			want:      &pkgv1.RevisionDiff{PreviousRevision: "pkg-1", AddedCRDs: []string{"new.example.org"}},
+		},
+		"ActiveKeepsDiff": {
+			reason:    "An active revision should keep the diff it was activated with.",
+			revisions: []client.Object{rev("pkg-1", 1, pkgv1.PackageRevisionInactive), rev("pkg-2", 2, pkgv1.PackageRevisionInactive)},
+			pr: func() *pkgv1.ProviderRevision {
+				pr := rev("pkg-3", 3, pkgv1.PackageRevisionActive)
+				pr.SetDiff(&pkgv1.RevisionDiff{PreviousRevision: "pkg-1"})
+				return pr
+			}(),
+			want: &pkgv1.RevisionDiff{PreviousRevision: "pkg-1"},
+		},
+		"First": {
+			reason: "The first revision of a package has nothing to be diffed against.",
+			pr:     rev("pkg-1", 1, pkgv1.PackageRevisionActive),
+		},
+	}
+	p := packageParser(t)
+	pkg, err := p.Parse(context.Background(), ioutil.NopCloser(strings.NewReader(crdStream("old.example.org", "new.example.org"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			s := runtime.NewScheme()
+			if err := pkgv1.AddToScheme(s); err != nil {
+				t.Fatal(err)
+			}
+			r := &Reconciler{
+				client: fake.NewClientBuilder().WithScheme(s).WithObjects(append(tc.revisions, tc.pr)...).Build(),
+				backend: backendFn(func(_ context.Context, _ ...parser.BackendOption) (io.ReadCloser, error) {
+					return ioutil.NopCloser(strings.NewReader(crdStream("old.example.org"))), nil
+				}),
+				parser:                 p,
+				newPackageRevisionList: func() pkgv1.PackageRevisionList { return &pkgv1.ProviderRevisionList{} },
+			}
+
+			if err := r.diff(context.Background(), tc.pr, pkg); err != nil {
+				t.Fatalf("\n%s\ndiff(...): %v", tc.reason, err)
+			}
+			if d := cmp.Diff(tc.want, tc.pr.GetDiff(), cmpopts.EquateEmpty()); d != "" {
+				t.Errorf("\n%s\ndiff(...): -want, +got:\n%s", tc.reason, d)
+			}
+		})
+	}
+}
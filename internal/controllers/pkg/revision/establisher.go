@@ -66,10 +66,14 @@ type currentDesired struct {
 }
 
 // Establish checks that control or ownership of resources can be established by
-// parent, then establishes it.
+// parent, then establishes it. Unless parent allows breaking changes, nothing is
+// established if parent is to control an installed CRD that would lose a served
+// or stored version or a required property. A parent that only owns objects
+// does not change them, so an inactive revision is never refused.
 func (e *APIEstablisher) Establish(ctx context.Context, objs []runtime.Object, parent resource.Object, control bool) ([]nddv1.TypedReference, error) { // nolint:gocyclo
 	allObjs := []currentDesired{}
 	resourceRefs := []nddv1.TypedReference{}
+	breaking := []string{}
 	for _, res := range objs {
 		// Assert desired object to resource.Object so that we can access its
 		// metadata.
@@ -113,10 +117,20 @@ func (e *APIEstablisher) Establish(ctx context.Context, objs []runtime.Object, p
 			Exists:  true,
 		})
 
+		if control && !allowBreakingChanges(parent) {
+			if changes := breakingChanges(c, d); len(changes) > 0 {
+				breaking = append(breaking, changes...)
+				continue
+			}
+		}
+
 		if err := e.update(ctx, c, d, parent, control, client.DryRunAll); err != nil {
 			return nil, err
 		}
 	}
+	if len(breaking) > 0 {
+		return nil, &breakingChangeError{changes: breaking}
+	}
 	for _, cd := range allObjs {
 		if !cd.Exists {
 			if err := e.create(ctx, cd.Desired, parent, control); err != nil {
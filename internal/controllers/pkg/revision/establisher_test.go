@@ -0,0 +1,86 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+)
+
+func crd(versions ...string) *extv1.CustomResourceDefinition {
+	c := &extv1.CustomResourceDefinition{
+		TypeMeta:   metav1.TypeMeta{APIVersion: extv1.SchemeGroupVersion.String(), Kind: "CustomResourceDefinition"},
+		ObjectMeta: metav1.ObjectMeta{Name: "things.example.org"},
+	}
+	for _, v := range versions {
+		c.Spec.Versions = append(c.Spec.Versions, extv1.CustomResourceDefinitionVersion{Name: v, Served: true, Storage: v == versions[0]})
+	}
+	return c
+}
+
+func TestAPIEstablisherEstablish(t *testing.T) {
+	cases := map[string]struct {
+		reason       string
+		control      bool
+		annotations  map[string]string
+		wantBreaking bool
+	}{
+		"ActiveBreakingChange": {
+			reason:       "A revision that controls a CRD should not remove a version that is served.",
+			control:      true,
+			wantBreaking: true,
+		},
+		"AllowedBreakingChange": {
+			reason:      "A revision annotated to allow breaking changes should be allowed to remove a version that is served.",
+			control:     true,
+			annotations: map[string]string{pkgv1.AllowBreakingChangesAnnotation: "true"},
+		},
+		"InactiveBreakingChange": {
+			reason: "A revision that only owns a CRD does not change it, so it should not be refused for breaking it, e.g. when it is an older rollback target.",
+		},
+	}
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			s := runtime.NewScheme()
+			if err := extv1.AddToScheme(s); err != nil {
+				t.Fatal(err)
+			}
+			c := fake.NewClientBuilder().WithScheme(s).WithObjects(crd("v1", "v2")).Build()
+			parent := &pkgv1.ProviderRevision{
+				TypeMeta:   metav1.TypeMeta{APIVersion: pkgv1.GroupVersion.String(), Kind: pkgv1.ProviderRevisionKind},
+				ObjectMeta: metav1.ObjectMeta{Name: "pkg-1234", UID: "uid", Annotations: tc.annotations},
+			}
+
+			_, err := NewAPIEstablisher(c).Establish(context.Background(), []runtime.Object{crd("v1")}, parent, tc.control)
+			var berr *breakingChangeError
+			if got := errors.As(err, &berr); got != tc.wantBreaking {
+				t.Errorf("\n%s\nEstablish(...): error %v, want breaking change %t", tc.reason, err, tc.wantBreaking)
+			}
+			if !tc.wantBreaking && err != nil {
+				t.Errorf("\n%s\nEstablish(...): %v", tc.reason, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-core/internal/nddpkg"
+)
+
+const (
+	errListRevisions = "cannot list provider revisions"
+	errPruneCache    = "cannot prune package image cache"
+)
+
+// A CacheCollector periodically removes package images from the cache that
+// are no longer referenced by any ProviderRevision.
+type CacheCollector struct {
+	client   client.Reader
+	cache    nddpkg.Cache
+	interval time.Duration
+	log      logging.Logger
+}
+
+// NewCacheCollector creates a new CacheCollector.
+func NewCacheCollector(c client.Reader, cache nddpkg.Cache, interval time.Duration, l logging.Logger) *CacheCollector {
+	return &CacheCollector{
+		client:   c,
+		cache:    cache,
+		interval: interval,
+		log:      l,
+	}
+}
+
+// SetupCacheCollector adds a CacheCollector to the manager. A non-positive
+// interval disables garbage collection.
+func SetupCacheCollector(mgr ctrl.Manager, l logging.Logger, cache nddpkg.Cache, interval time.Duration) error {
+	if interval <= 0 {
+		return nil
+	}
+	return mgr.Add(NewCacheCollector(mgr.GetClient(), cache, interval, l.WithValues("controller", "packages/cache-gc")))
+}
+
+// Start collects garbage every interval until the supplied context is done.
+func (c *CacheCollector) Start(ctx context.Context) error {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if err := c.Collect(ctx); err != nil {
+				c.log.Info("cannot collect package image cache garbage", "error", err)
+			}
+		}
+	}
+}
+
+// Collect removes all cache entries that are not named after an existing
+// ProviderRevision or IntentRevision, nor are the source of one with a pull
+// policy of Never, such as an imported package.
+func (c *CacheCollector) Collect(ctx context.Context) error {
+	names := map[string]bool{}
+	for _, l := range []pkgv1.PackageRevisionList{&pkgv1.ProviderRevisionList{}, &pkgv1.IntentRevisionList{}} {
+		if err := c.client.List(ctx, l); err != nil {
+			return errors.Wrap(err, errListRevisions)
+		}
+		for _, pr := range l.GetRevisions() {
+			names[pr.GetName()] = true
+			if pp := pr.GetPackagePullPolicy(); pp != nil && *pp == corev1.PullNever {
+				names[pr.GetSource()] = true
+			}
+		}
+	}
+	return errors.Wrap(c.cache.Prune(func(id string) bool { return names[id] }), errPruneCache)
+}
@@ -19,6 +19,7 @@ package revision
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
@@ -31,11 +32,11 @@ import (
 	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
-	errNotProvider                   = "not a provider package"
-	errNotProviderRevision           = "not a provider revision"
+	errNotProvider                   = "not a provider or intent package"
 	errCompositeProvider             = "cannot get referenced composite provider"
 	errGetCrd                        = "cannot get crd"
 	errDeleteProviderDeployment      = "cannot delete provider package deployment"
@@ -52,7 +53,10 @@ const (
 	errApplyProviderMutateWebhook    = "cannot apply provider package mutate webhook"
 	errApplyProviderValidateWebhook  = "cannot apply provider package validate webhook"
 
-	errUnavailableProviderDeployment = "provider package deployment is unavailable"
+	errUnavailableProviderDeployment  = "provider package deployment is unavailable"
+	errUnavailableProviderStatefulset = "provider package statefulset is unavailable"
+	errListCanaryEvents               = "cannot list provider package canary events"
+	errCanaryWarningEvent             = "provider package canary reported a warning event"
 )
 
 // A Hooks performs operations before and after a revision establishes objects.
@@ -68,40 +72,60 @@ type Hooks interface {
 // controller before and after the revision establishes objects.
 type ProviderHooks struct {
 	client    resource.ClientApplicator
+	events    client.Reader
 	namespace string
 	log       logging.Logger
+	rewriter  *nddpkg.Rewriter
+}
+
+// A ProviderHooksOption configures ProviderHooks.
+type ProviderHooksOption func(*ProviderHooks)
+
+// WithImageRewriter specifies how the images of packaged controllers should be
+// rewritten, e.g. to pull them from a registry mirror.
+func WithImageRewriter(rw *nddpkg.Rewriter) ProviderHooksOption {
+	return func(h *ProviderHooks) {
+		h.rewriter = rw
+	}
+}
+
+// WithEventReader specifies how the events of canary controllers should be
+// read. Events are best read without a cache, since caching them would cache
+// all events of the cluster.
+func WithEventReader(r client.Reader) ProviderHooksOption {
+	return func(h *ProviderHooks) {
+		h.events = r
+	}
 }
 
 // NewProviderHooks creates a new ProviderHooks.
-func NewProviderHooks(client resource.ClientApplicator, namespace string, l logging.Logger) *ProviderHooks {
-	return &ProviderHooks{
+func NewProviderHooks(client resource.ClientApplicator, namespace string, l logging.Logger, o ...ProviderHooksOption) *ProviderHooks {
+	h := &ProviderHooks{
 		client:    client,
+		events:    client,
 		namespace: namespace,
 		log:       l,
 	}
+	for _, fn := range o {
+		fn(h)
+	}
+	return h
 }
 
 // Pre cleans up a packaged controller and service account if the revision is
 // inactive.
 func (h *ProviderHooks) Pre(ctx context.Context, pkg runtime.Object, pr pkgv1.PackageRevision, crdNames []string) error {
 	log := h.log.WithValues("package", pkg.GetObjectKind(), "pr", pr.GetName())
-	po, _ := nddpkg.TryConvert(pkg, &pkgmetav1.Provider{})
-	pmp, ok := po.(*pkgmetav1.Provider)
+	pmp, ok := providerMeta(pkg)
 	if !ok {
 		return errors.New(errNotProvider)
 	}
 
-	// TBD updates
-	provRev, ok := pr.(*pkgv1.ProviderRevision)
-	if !ok {
-		return errors.New(errNotProviderRevision)
-	}
+	log.Debug("permission requests", "meta spec", pmp.Spec, "revision permission requests", pr.GetPermissionsRequests())
+	pr.SetPermissionsRequests(pmp.Spec.Pod.PermissionRequests)
 
-	log.Debug("permission requests", "meta spec", pmp.Spec, "revision status", provRev.Status)
-	provRev.Status.PermissionRequests = pmp.Spec.Pod.PermissionRequests
-
-	// Do not clean up if revision is active.
-	if pr.GetDesiredState() == pkgv1.PackageRevisionActive {
+	// Do not clean up if revision is active or a canary.
+	if pr.GetDesiredState() == pkgv1.PackageRevisionActive || pr.GetDesiredState() == pkgv1.PackageRevisionCanary {
 		return nil
 	}
 	log.Debug("desired state", "state", pr.GetDesiredState())
@@ -138,17 +162,21 @@ func (h *ProviderHooks) Pre(ctx context.Context, pkg runtime.Object, pr pkgv1.Pa
 }
 
 // Post creates a packaged provider controller and service account if the
-// revision is active.
+// revision is active or a canary. Services and webhooks are only created for
+// active revisions, since they are shared by all revisions of a package; they
+// keep routing to the active revision until its canary is promoted. A canary
+// is healthy once its controller is available and no warning events were
+// reported for it or its pods since it became a canary.
 func (h *ProviderHooks) Post(ctx context.Context, pkg runtime.Object, pr pkgv1.PackageRevision, crdNames []string) error {
 	log := h.log.WithValues("package", pkg.GetObjectKind(), "pr", pr.GetName())
-	po, _ := nddpkg.TryConvert(pkg, &pkgmetav1.Provider{})
-	pmp, ok := po.(*pkgmetav1.Provider)
+	pmp, ok := providerMeta(pkg)
 	if !ok {
-		return errors.New("not a provider package")
+		return errors.New(errNotProvider)
 	}
 
-	// return if the desired status is not active
-	if pr.GetDesiredState() != pkgv1.PackageRevisionActive {
+	// return if the desired status is not active or canary
+	canary := pr.GetDesiredState() == pkgv1.PackageRevisionCanary
+	if pr.GetDesiredState() != pkgv1.PackageRevisionActive && !canary {
 		return nil
 	}
 
@@ -176,15 +204,17 @@ func (h *ProviderHooks) Post(ctx context.Context, pkg runtime.Object, pr pkgv1.P
 			if extra.Service {
 				// deploy a service
 				s := renderService(pmp, pmp.Spec.Pod, c, extra, pr)
-				if err := h.client.Apply(ctx, s); err != nil {
-					return errors.Wrap(err, errApplyProviderService)
+				if !canary {
+					if err := h.client.Apply(ctx, s); err != nil {
+						return errors.Wrap(err, errApplyProviderService)
+					}
 				}
 				log.Debug("extra service info", "target Port", extra.TargetPort)
 				if extra.Name == "grpc" {
 					grpcServiceName = s.Name
 				}
 			}
-			if extra.Webhook {
+			if extra.Webhook && !canary {
 				if len(crds) == 0 {
 					return errors.New("cannot apply webhook if no crds are found")
 				}
@@ -223,6 +253,7 @@ func (h *ProviderHooks) Post(ctx context.Context, pkg runtime.Object, pr pkgv1.P
 			grpcServiceName:       grpcServiceName,
 			grpcCertSecretName:    grpcCertSecretName,
 			compositeProviderName: compositeProviderName,
+			rewriter:              h.rewriter,
 		})
 		if err := h.client.Apply(ctx, d); err != nil {
 			return errors.Wrap(err, errApplyProviderDeployment)
@@ -231,14 +262,22 @@ func (h *ProviderHooks) Post(ctx context.Context, pkg runtime.Object, pr pkgv1.P
 		if err := h.client.Apply(ctx, sa); err != nil {
 			return errors.Wrap(err, errApplyProviderServiceAccount)
 		}
+		available := false
 		for _, c := range d.Status.Conditions {
 			if c.Type == appsv1.DeploymentAvailable {
-				if c.Status == corev1.ConditionTrue {
-					return nil
+				if c.Status != corev1.ConditionTrue {
+					return errors.Errorf("%s: %s", errUnavailableProviderDeployment, c.Message)
 				}
-				return errors.Errorf("%s: %s", errUnavailableProviderDeployment, c.Message)
+				available = true
 			}
 		}
+		// A canary is only healthy once its deployment reports available.
+		if canary && !available {
+			return errors.New(errUnavailableProviderDeployment)
+		}
+		if canary {
+			return h.canaryEvents(ctx, pr, d.GetNamespace())
+		}
 	case pkgmetav1.DeploymentTypeStatefulset:
 		cp, err := h.getCompositeProvider(ctx, pr)
 		serviceDiscoveryInfo := []*pkgv1.ServiceInfo{}
@@ -256,6 +295,7 @@ func (h *ProviderHooks) Post(ctx context.Context, pkg runtime.Object, pr pkgv1.P
 			grpcServiceName:       grpcServiceName,
 			grpcCertSecretName:    grpcCertSecretName,
 			compositeProviderName: compositeProviderName,
+			rewriter:              h.rewriter,
 		})
 		if err := h.client.Apply(ctx, s); err != nil {
 			return errors.Wrap(err, errApplyProviderStatefulset)
@@ -264,11 +304,55 @@ func (h *ProviderHooks) Post(ctx context.Context, pkg runtime.Object, pr pkgv1.P
 		if err := h.client.Apply(ctx, sa); err != nil {
 			return errors.Wrap(err, errApplyProviderServiceAccount)
 		}
+		// A canary is only healthy once all of its pods are ready.
+		if canary && s.Status.ReadyReplicas < *s.Spec.Replicas {
+			return errors.Errorf("%s: %d/%d replicas ready", errUnavailableProviderStatefulset, s.Status.ReadyReplicas, *s.Spec.Replicas)
+		}
+		if canary {
+			return h.canaryEvents(ctx, pr, s.GetNamespace())
+		}
 	}
 
 	return nil
 }
 
+// canaryEvents returns an error if a warning event was reported for the
+// controller of the canary revision pr or one of its pods since it became a
+// canary. The controller is named after the revision, and so are its pods.
+func (h *ProviderHooks) canaryEvents(ctx context.Context, pr pkgv1.PackageRevision, namespace string) error {
+	since, err := time.Parse(time.RFC3339, pr.GetAnnotations()[pkgv1.CanarySinceAnnotation])
+	if err != nil {
+		since = pr.GetCreationTimestamp().Time
+	}
+	l := &corev1.EventList{}
+	if err := h.events.List(ctx, l, client.InNamespace(namespace)); err != nil {
+		return errors.Wrap(err, errListCanaryEvents)
+	}
+	for _, e := range l.Items {
+		if e.Type != corev1.EventTypeWarning || eventTime(e).Before(since) {
+			continue
+		}
+		if n := e.InvolvedObject.Name; n != pr.GetName() && !strings.HasPrefix(n, pr.GetName()+"-") {
+			continue
+		}
+		return errors.Errorf("%s: %s %s: %s: %s", errCanaryWarningEvent, e.InvolvedObject.Kind, e.InvolvedObject.Name, e.Reason, e.Message)
+	}
+	return nil
+}
+
+// eventTime returns when an event was last observed.
+func eventTime(e corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
 func (h *ProviderHooks) getCompositeProvider(ctx context.Context, pr pkgv1.PackageRevision) (*pkgv1.CompositeProvider, error) {
 	var cc *pkgv1.CompositeProvider
 	h.log.Debug("getCompositeProvider", "pr", pr)
@@ -302,6 +386,27 @@ func (h *ProviderHooks) getCrds(ctx context.Context, crdNames []string) ([]*extv
 	return crds, nil
 }
 
+// providerMeta returns the supplied package meta as a Provider. Intents run a
+// controller pod just like providers do, so an Intent is returned as a
+// Provider with the same metadata and pod.
+func providerMeta(pkg runtime.Object) (*pkgmetav1.Provider, bool) {
+	po, _ := nddpkg.TryConvert(pkg, &pkgmetav1.Provider{}, &pkgmetav1.Intent{})
+	switch m := po.(type) {
+	case *pkgmetav1.Provider:
+		return m, true
+	case *pkgmetav1.Intent:
+		return &pkgmetav1.Provider{
+			TypeMeta:   m.TypeMeta,
+			ObjectMeta: m.ObjectMeta,
+			Spec: pkgmetav1.ProviderSpec{
+				Pod:      m.Spec.Pod,
+				MetaSpec: m.Spec.MetaSpec,
+			},
+		}, true
+	}
+	return nil, false
+}
+
 // NopHooks performs no operations.
 type NopHooks struct{}
 
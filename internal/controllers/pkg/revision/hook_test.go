@@ -0,0 +1,144 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/ndd-runtime/pkg/resource"
+)
+
+func TestProviderHooksCanaryEvents(t *testing.T) {
+	since := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	event := func(name, kind, typ string, at time.Time) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name + "." + typ, Namespace: "ndd-system"},
+			InvolvedObject: corev1.ObjectReference{Kind: kind, Name: name, Namespace: "ndd-system"},
+			Type:           typ,
+			Reason:         "BackOff",
+			LastTimestamp:  metav1.NewTime(at),
+		}
+	}
+
+	cases := map[string]struct {
+		reason  string
+		events  []client.Object
+		wantErr bool
+	}{
+		"NoEvents": {
+			reason: "A canary without events should be healthy.",
+		},
+		"PodWarning": {
+			reason:  "A warning event of a pod of the canary should fail its health gates.",
+			events:  []client.Object{event("pkg-1234-5d8f7-x2x9z", "Pod", corev1.EventTypeWarning, since.Add(time.Second))},
+			wantErr: true,
+		},
+		"DeploymentWarning": {
+			reason:  "A warning event of the controller of the canary should fail its health gates.",
+			events:  []client.Object{event("pkg-1234", "Deployment", corev1.EventTypeWarning, since.Add(time.Second))},
+			wantErr: true,
+		},
+		"NormalEvent": {
+			reason: "Normal events should not fail the health gates of a canary.",
+			events: []client.Object{event("pkg-1234-5d8f7-x2x9z", "Pod", corev1.EventTypeNormal, since.Add(time.Second))},
+		},
+		"BeforeCanary": {
+			reason: "Warning events reported before the revision became a canary should not count.",
+			events: []client.Object{event("pkg-1234-5d8f7-x2x9z", "Pod", corev1.EventTypeWarning, since.Add(-time.Second))},
+		},
+		"OtherRevision": {
+			reason: "Warning events of other revisions should not count.",
+			events: []client.Object{event("pkg-12345-5d8f7-x2x9z", "Pod", corev1.EventTypeWarning, since.Add(time.Second))},
+		},
+	}
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithObjects(tc.events...).Build()
+			h := NewProviderHooks(resource.ClientApplicator{Client: c}, "ndd-system", logging.NewNopLogger(), WithEventReader(c))
+			pr := &pkgv1.ProviderRevision{ObjectMeta: metav1.ObjectMeta{
+				Name:        "pkg-1234",
+				Annotations: map[string]string{pkgv1.CanarySinceAnnotation: since.Format(time.RFC3339)},
+			}}
+			err := h.canaryEvents(context.Background(), pr, "ndd-system")
+			if (err != nil) != tc.wantErr {
+				t.Errorf("\n%s\ncanaryEvents(...): error %v, want error %t", tc.reason, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestProviderHooksPostSharedService(t *testing.T) {
+	pkg := &pkgmetav1.Provider{
+		ObjectMeta: metav1.ObjectMeta{Name: "pkg", Namespace: "ndd-system"},
+		Spec: pkgmetav1.ProviderSpec{Pod: &pkgmetav1.PodSpec{
+			Type: pkgmetav1.DeploymentTypeDeployment,
+			Containers: []*pkgmetav1.ContainerSpec{{
+				Container: &corev1.Container{Name: "controller", Image: "ghcr.io/yndd/pkg:v1"},
+				Extras:    []*pkgmetav1.Extras{{Name: "grpc", Service: true}},
+			}},
+		}},
+	}
+
+	cases := map[string]struct {
+		reason      string
+		state       pkgv1.PackageRevisionDesiredState
+		wantService bool
+	}{
+		"Active": {
+			reason:      "An active revision should apply the service shared by all revisions of its package.",
+			state:       pkgv1.PackageRevisionActive,
+			wantService: true,
+		},
+		"Canary": {
+			reason: "A canary revision should leave the service shared by all revisions with the active revision.",
+			state:  pkgv1.PackageRevisionCanary,
+		},
+	}
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			applied := false
+			ca := resource.ClientApplicator{
+				Client: fake.NewClientBuilder().Build(),
+				Applicator: resource.ApplyFn(func(_ context.Context, o client.Object, _ ...resource.ApplyOption) error {
+					if _, ok := o.(*corev1.Service); ok {
+						applied = true
+					}
+					return nil
+				}),
+			}
+			pr := &pkgv1.ProviderRevision{ObjectMeta: metav1.ObjectMeta{Name: "pkg-1234"}}
+			pr.SetDesiredState(tc.state)
+			pp := corev1.PullIfNotPresent
+			pr.SetPackagePullPolicy(&pp)
+
+			_ = NewProviderHooks(ca, "ndd-system", logging.NewNopLogger()).Post(context.Background(), pkg, pr, nil)
+			if applied != tc.wantService {
+				t.Errorf("\n%s\nPost(...): applied service %t, want %t", tc.reason, applied, tc.wantService)
+			}
+		})
+	}
+}
@@ -17,17 +17,15 @@ limitations under the License.
 package revision
 
 import (
-	"archive/tar"
 	"context"
 	"io"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	regv1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/pkg/errors"
-	"github.com/spf13/afero/tarfs"
 	v1 "github.com/yndd/ndd-core/apis/pkg/v1"
 	"github.com/yndd/ndd-core/internal/nddpkg"
+	"github.com/yndd/ndd-runtime/pkg/event"
 	"github.com/yndd/ndd-runtime/pkg/parser"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -38,25 +36,51 @@ const (
 	errFetchPackage      = "failed to fetch package from remote"
 	errCachePackage      = "failed to store package in cache"
 	errOpenPackageStream = "failed to open package stream file"
+	errCorruptPackage    = "cached package was corrupt and is fetched again"
+	errVerifiedDigestFmt = "package digest %s is not the verified digest %s"
+
+	reasonCache event.Reason = "CachePackage"
 )
 
 // ImageBackend is a backend for parser.
 type ImageBackend struct {
 	pr      v1.PackageRevision
+	digest  *regv1.Hash
 	cache   nddpkg.Cache
 	fetcher nddpkg.Fetcher
+	sources nddpkg.Sources
+	record  event.Recorder
+}
+
+// An ImageBackendOption configures an ImageBackend.
+type ImageBackendOption func(*ImageBackend)
+
+// WithBackendRecorder specifies how the ImageBackend should record events,
+// such as finding a corrupt package in the cache.
+func WithBackendRecorder(er event.Recorder) ImageBackendOption {
+	return func(i *ImageBackend) {
+		i.record = er
+	}
 }
 
-// NewImageBackend creates a new image backend.
-func NewImageBackend(cache nddpkg.Cache, fetcher nddpkg.Fetcher) *ImageBackend {
-	return &ImageBackend{
+// NewImageBackend creates a new image backend. Packages whose source is not an
+// OCI image reference are fetched from the supplied sources.
+func NewImageBackend(cache nddpkg.Cache, fetcher nddpkg.Fetcher, sources nddpkg.Sources, o ...ImageBackendOption) *ImageBackend {
+	i := &ImageBackend{
 		cache:   cache,
 		fetcher: fetcher,
+		sources: sources,
+		record:  event.NewNopRecorder(),
 	}
+	for _, fn := range o {
+		fn(i)
+	}
+	return i
 }
 
 // Init initializes an ImageBackend.
 func (i *ImageBackend) Init(ctx context.Context, bo ...parser.BackendOption) (io.ReadCloser, error) {
+	i.digest = nil
 	for _, o := range bo {
 		o(i)
 	}
@@ -71,15 +95,39 @@ func (i *ImageBackend) Init(ctx context.Context, bo ...parser.BackendOption) (io
 		if err != nil {
 			return nil, errors.Wrap(err, errPullPolicyNever)
 		}
+	} else if _, ok := nddpkg.ParseSourceURL(i.pr.GetSource()); ok {
+		// Packages that do not come from a registry are cached without a
+		// tag.
+		img, err = i.cache.Get("", i.pr.GetName())
+		if err != nil {
+			i.recordCorrupt(err)
+			img, err = i.sources.Fetch(ctx, i.pr.GetSource())
+			if err != nil {
+				return nil, errors.Wrap(err, errFetchPackage)
+			}
+			if err := i.cache.Store("", i.pr.GetName(), img); err != nil {
+				return nil, errors.Wrap(err, errCachePackage)
+			}
+		}
 	} else {
 		// Ensure source is a valid image reference.
 		ref, err := name.ParseReference(i.pr.GetSource())
 		if err != nil {
 			return nil, errors.Wrap(err, errBadReference)
 		}
-		// Attempt to fetch image from cache.
+		// A verified package is fetched by its digest, such that a tag that
+		// moved since it was verified is not followed.
+		if i.digest != nil {
+			ref = ref.Context().Digest(i.digest.String())
+		}
+		// Attempt to fetch image from cache. A cached image that is not the
+		// verified package is replaced.
 		img, err = i.cache.Get(i.pr.GetSource(), i.pr.GetName())
+		if err == nil {
+			err = i.verifyDigest(img)
+		}
 		if err != nil {
+			i.recordCorrupt(err)
 			img, err = i.fetcher.Fetch(ctx, ref, v1.RefNames(i.pr.GetPackagePullSecrets())...)
 			if err != nil {
 				return nil, errors.Wrap(err, errFetchPackage)
@@ -91,16 +139,56 @@ func (i *ImageBackend) Init(ctx context.Context, bo ...parser.BackendOption) (io
 		}
 	}
 
+	if err := i.verifyDigest(img); err != nil {
+		return nil, err
+	}
+
 	// Extract package contents from image.
-	r := mutate.Extract(img)
-	fs := tarfs.New(tar.NewReader(r))
-	f, err := fs.Open(nddpkg.StreamFile)
+	f, err := nddpkg.OpenStream(img)
 	if err != nil {
 		return nil, errors.Wrap(err, errOpenPackageStream)
 	}
 	return f, nil
 }
 
+// verifyDigest returns an error if a package was verified and the supplied
+// image is not the verified package.
+func (i *ImageBackend) verifyDigest(img regv1.Image) error {
+	if i.digest == nil {
+		return nil
+	}
+	d, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	if d != *i.digest {
+		return errors.Errorf(errVerifiedDigestFmt, d, i.digest)
+	}
+	return nil
+}
+
+// recordCorrupt records an event on the package revision if the supplied cache
+// error indicates that its cached package was corrupt. The cache has already
+// evicted the package, so it is fetched again.
+func (i *ImageBackend) recordCorrupt(err error) {
+	if nddpkg.IsCorrupt(err) {
+		i.record.Event(i.pr, event.Warning(reasonCache, errors.Wrap(err, errCorruptPackage)))
+	}
+}
+
+// VerifiedDigest sets the digest of the package whose signature was verified.
+// An ImageBackend only returns the package with that digest. A nil digest does
+// not restrict the package.
+func VerifiedDigest(h *regv1.Hash) parser.BackendOption {
+	return func(p parser.Backend) {
+		i, ok := p.(*ImageBackend)
+		if !ok {
+			return
+		}
+		i.digest = h
+	}
+}
+
 // PackageRevision sets the package revision for ImageBackend.
 func PackageRevision(pr v1.PackageRevision) parser.BackendOption {
 	return func(p parser.Backend) {
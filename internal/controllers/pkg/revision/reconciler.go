@@ -36,7 +36,6 @@ import (
 	"github.com/pkg/errors"
 	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
 	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
-	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -67,11 +66,18 @@ const (
 
 	errEstablishControl = "cannot establish control of object"
 
+	errDiffRevision = "cannot compute package revision diff"
+
+	errVerifySignature = "cannot verify package signature"
+
 	// Event reasons
 	reasonParse        event.Reason = "ParsePackage"
 	reasonLint         event.Reason = "LintPackage"
+	reasonCompatible   event.Reason = "CheckCompatibility"
 	reasonDependencies event.Reason = "ResolveDependencies"
 	reasonSync         event.Reason = "SyncPackage"
+	reasonDiff         event.Reason = "DiffPackage"
+	reasonVerify       event.Reason = "VerifyPackage"
 )
 
 // ReconcilerOption is used to configure the Reconciler.
@@ -99,6 +105,14 @@ func WithNewPackageRevisionFn(f func() pkgv1.PackageRevision) ReconcilerOption {
 	}
 }
 
+// WithNewPackageRevisionListFn determines the type of package revision list
+// used to find the previously active revision.
+func WithNewPackageRevisionListFn(f func() pkgv1.PackageRevisionList) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.newPackageRevisionList = f
+	}
+}
+
 // WithLogger specifies how the Reconciler should log messages.
 func WithLogger(log logging.Logger) ReconcilerOption {
 	return func(r *Reconciler) {
@@ -156,6 +170,13 @@ func WithParserBackend(p parser.Backend) ReconcilerOption {
 	}
 }
 
+// WithVerifier specifies how the Reconciler should verify package signatures.
+func WithVerifier(v Verifier) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.verifier = v
+	}
+}
+
 // WithLinter specifies how the Reconciler should lint a package.
 func WithLinter(l parser.Linter) ReconcilerOption {
 	return func(r *Reconciler) {
@@ -183,22 +204,65 @@ type Reconciler struct {
 	linter    parser.Linter
 	versioner version.Operations
 	backend   parser.Backend
+	verifier  Verifier
 	log       logging.Logger
 	record    event.Recorder
 
-	newPackageRevision func() pkgv1.PackageRevision
+	newPackageRevision     func() pkgv1.PackageRevision
+	newPackageRevisionList func() pkgv1.PackageRevisionList
 }
 
 // SetupProviderRevision adds a controller that reconciles ProviderRevisions.
-func SetupProviderRevision(mgr ctrl.Manager, l logging.Logger, cache nddpkg.Cache, namespace string) error {
+// Package images are fetched using the supplied Fetcher, or the supplied
+// Sources if they are not in a registry, and the images of the controllers it
+// deploys are rewritten using the supplied Rewriter.
+func SetupProviderRevision(mgr ctrl.Manager, l logging.Logger, cache nddpkg.Cache, fetcher nddpkg.Fetcher, sources nddpkg.Sources, rw *nddpkg.Rewriter, namespace string) error {
 	name := "packages/" + strings.ToLower(pkgv1.ProviderRevisionGroupKind)
 	nr := func() pkgv1.PackageRevision { return &pkgv1.ProviderRevision{} }
+	nrl := func() pkgv1.PackageRevisionList { return &pkgv1.ProviderRevisionList{} }
 
-	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	metaScheme, err := nddpkg.BuildMetaScheme()
+	if err != nil {
+		return errors.New("cannot build meta scheme for package parser")
+	}
+	objScheme, err := nddpkg.BuildObjectScheme()
 	if err != nil {
-		return errors.Wrap(err, "failed to initialize host clientset with in cluster config")
+		return errors.New("cannot build object scheme for package parser")
 	}
 
+	versioner := version.New()
+	recorder := event.NewAPIRecorder(mgr.GetEventRecorderFor(name))
+	r := NewReconciler(mgr,
+		WithCache(cache),
+		WithDependencyManager(NewPackageDependencyManager(mgr.GetClient(), dag.NewMapDag, pkgmetav1.ProviderPackageType)),
+		WithHooks(NewProviderHooks(resource.ClientApplicator{
+			Client:     mgr.GetClient(),
+			Applicator: resource.NewAPIPatchingApplicator(mgr.GetClient()),
+		}, namespace, l, WithImageRewriter(rw), WithEventReader(mgr.GetAPIReader()))),
+		WithNewPackageRevisionFn(nr),
+		WithNewPackageRevisionListFn(nrl),
+		WithParser(parser.New(metaScheme, objScheme)),
+		WithParserBackend(NewImageBackend(cache, fetcher, sources, WithBackendRecorder(recorder))),
+		WithVerifier(NewPolicyVerifier(mgr.GetClient(), fetcher)),
+		WithLinter(nddpkg.NewProviderLinter(versioner)),
+		WithVersioner(versioner),
+		WithLogger(l.WithValues("controller", name)),
+		WithRecorder(recorder),
+	)
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(&pkgv1.ProviderRevision{}).
+		Complete(r)
+}
+
+// SetupIntentRevision adds a controller that reconciles IntentRevisions. Intents
+// are deployed the same way providers are, so the provider hooks are used.
+func SetupIntentRevision(mgr ctrl.Manager, l logging.Logger, cache nddpkg.Cache, fetcher nddpkg.Fetcher, sources nddpkg.Sources, rw *nddpkg.Rewriter, namespace string) error {
+	name := "packages/" + strings.ToLower(pkgv1.IntentRevisionGroupKind)
+	nr := func() pkgv1.PackageRevision { return &pkgv1.IntentRevision{} }
+	nrl := func() pkgv1.PackageRevisionList { return &pkgv1.IntentRevisionList{} }
+
 	metaScheme, err := nddpkg.BuildMetaScheme()
 	if err != nil {
 		return errors.New("cannot build meta scheme for package parser")
@@ -208,24 +272,29 @@ func SetupProviderRevision(mgr ctrl.Manager, l logging.Logger, cache nddpkg.Cach
 		return errors.New("cannot build object scheme for package parser")
 	}
 
+	versioner := version.New()
+	recorder := event.NewAPIRecorder(mgr.GetEventRecorderFor(name))
 	r := NewReconciler(mgr,
 		WithCache(cache),
-		WithDependencyManager(NewPackageDependencyManager(mgr.GetClient(), dag.NewMapDag, pkgmetav1.ProviderPackageType)),
+		WithDependencyManager(NewPackageDependencyManager(mgr.GetClient(), dag.NewMapDag, pkgmetav1.IntentPackageType)),
 		WithHooks(NewProviderHooks(resource.ClientApplicator{
 			Client:     mgr.GetClient(),
 			Applicator: resource.NewAPIPatchingApplicator(mgr.GetClient()),
-		}, namespace, l)),
+		}, namespace, l, WithImageRewriter(rw), WithEventReader(mgr.GetAPIReader()))),
 		WithNewPackageRevisionFn(nr),
+		WithNewPackageRevisionListFn(nrl),
 		WithParser(parser.New(metaScheme, objScheme)),
-		WithParserBackend(NewImageBackend(cache, nddpkg.NewK8sFetcher(clientset, namespace))),
-		WithLinter(nddpkg.NewProviderLinter()),
+		WithParserBackend(NewImageBackend(cache, fetcher, sources, WithBackendRecorder(recorder))),
+		WithVerifier(NewPolicyVerifier(mgr.GetClient(), fetcher)),
+		WithLinter(nddpkg.NewIntentLinter(versioner)),
+		WithVersioner(versioner),
 		WithLogger(l.WithValues("controller", name)),
-		WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
+		WithRecorder(recorder),
 	)
 
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(name).
-		For(&pkgv1.ProviderRevision{}).
+		For(&pkgv1.IntentRevision{}).
 		Complete(r)
 }
 
@@ -241,6 +310,7 @@ func NewReconciler(mgr manager.Manager, opts ...ReconcilerOption) *Reconciler {
 		parser:    parser.New(nil, nil),
 		linter:    parser.NewPackageLinter(nil, nil, nil),
 		versioner: version.New(),
+		verifier:  NewNopVerifier(),
 		log:       logging.NewNopLogger(),
 		record:    event.NewNopRecorder(),
 	}
@@ -255,10 +325,12 @@ func NewReconciler(mgr manager.Manager, opts ...ReconcilerOption) *Reconciler {
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="apiextensions.k8s.io",resources=customresourcedefinitions,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=locks,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=pkg.ndd.yndd.io,resources=verificationpolicies,verbs=get;list;watch
 // +kubebuilder:rbac:groups=meta.pkg.ndd.yndd.io,resources=*,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations;mutatingwebhookconfigurations,verbs=get;list;watch;create;update;patch;delete
@@ -282,10 +354,9 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 
 	if meta.WasDeleted(pr) {
 		// NOTE: In the event that a pre-cached package was used for this revision,
-		// delete will not remove the pre-cached package image from the cache
-		// unless it has the same name as the provider revision. Delete will not
-		// return an error so we will remove finalizer and leave the image in
-		// the cache.
+		// delete will not remove the pre-cached package image from the cache.
+		// Images stored for this revision are only removed once no other
+		// revision refers to them.
 		if err := r.cache.Delete(pr.GetName()); err != nil {
 			log.Debug(errDeleteCache, "error", err)
 			r.record.Event(pr, event.Warning(reasonSync, errors.Wrap(err, errDeleteCache)))
@@ -319,8 +390,31 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		"name", pr.GetName(),
 	)
 
-	// Initialize parser backend to obtain package contents.
-	reader, err := r.backend.Init(ctx, PackageRevision(pr))
+	// Verify who built the package before any of its contents are used.
+	// Only a package that is known not to be signed by a trusted key is
+	// unhealthy; failing to obtain its signature, e.g. because the registry
+	// is unavailable, is retried without changing its conditions.
+	verified, err := r.verifier.Verify(ctx, pr)
+	if err != nil && !nddpkg.IsUnverified(err) {
+		log.Debug(errVerifySignature, "error", err)
+		r.record.Event(pr, event.Warning(reasonVerify, errors.Wrap(err, errVerifySignature)))
+		return reconcile.Result{RequeueAfter: shortWait}, nil
+	}
+	if err != nil {
+		log.Debug(errVerifySignature, "error", err)
+		r.record.Event(pr, event.Warning(reasonVerify, errors.Wrap(err, errVerifySignature)))
+		pr.SetConditions(pkgv1.SignatureUnverified(err.Error()), pkgv1.Unhealthy())
+		return reconcile.Result{RequeueAfter: longWait}, errors.Wrap(r.client.Status().Update(ctx, pr), errUpdateStatus)
+	}
+	if verified != nil {
+		pr.SetConditions(pkgv1.SignatureVerified())
+	} else {
+		pr.SetConditions(pkgv1.SignatureNotRequired())
+	}
+
+	// Initialize parser backend to obtain package contents. A verified
+	// package is only obtained by the digest whose signature was verified.
+	reader, err := r.backend.Init(ctx, PackageRevision(pr), VerifiedDigest(verified))
 	if err != nil {
 		log.Debug(errInitParserBackend, "error", err)
 		r.record.Event(pr, event.Warning(reasonParse, errors.Wrap(err, errInitParserBackend)))
@@ -341,6 +435,14 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 
 	// Lint package using package-specific linter.
 	if err := r.linter.Lint(pkg); err != nil {
+		if nddpkg.IsIncompatible(err) {
+			// NOTE: an incompatible package can only be installed once Ndd
+			// is upgraded, which restarts the controller, so we requeue
+			// after long wait.
+			r.record.Event(pr, event.Warning(reasonCompatible, err))
+			pr.SetConditions(pkgv1.Incompatible(err.Error()), pkgv1.Unhealthy())
+			return reconcile.Result{RequeueAfter: longWait}, errors.Wrap(r.client.Status().Update(ctx, pr), errUpdateStatus)
+		}
 		r.record.Event(pr, event.Warning(reasonLint, err))
 		// NOTE: a failed lint typically will require manual
 		// intervention, but on the off chance that we read pod logs early,
@@ -349,6 +451,8 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		return reconcile.Result{RequeueAfter: longWait}, errors.Wrap(r.client.Status().Update(ctx, pr), errUpdateStatus)
 	}
 
+	pr.SetConditions(pkgv1.Compatible())
+
 	// NOTE: the linter should check this property already, but if a
 	// consumer forgets to pass an option to guarantee one meta object, we check
 	// here to avoid a potential panic on 0 index below.
@@ -358,9 +462,18 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		return reconcile.Result{RequeueAfter: longWait}, errors.Wrap(r.client.Status().Update(ctx, pr), errUpdateStatus)
 	}
 
-	pkgMeta, _ := nddpkg.TryConvert(pkg.GetMeta()[0], &pkgmetav1.Provider{})
+	pkgMeta, _ := nddpkg.TryConvert(pkg.GetMeta()[0], &pkgmetav1.Provider{}, &pkgmetav1.Intent{})
 	log.Debug("package meta", "pkgMeta", pkgMeta)
 
+	// Record what changed with respect to the previous revision so that an
+	// upgrade can be reviewed, before this revision is activated or after it
+	// was activated automatically. Failing to compute the diff does not
+	// prevent the revision from being installed.
+	if err := r.diff(ctx, pr, pkg); err != nil {
+		log.Debug(errDiffRevision, "error", err)
+		r.record.Event(pr, event.Warning(reasonDiff, errors.Wrap(err, errDiffRevision)))
+	}
+
 	// Check status of package dependencies unless package specifies to skip
 	// resolution.
 	if pr.GetSkipDependencyResolution() != nil && !*pr.GetSkipDependencyResolution() {
@@ -385,6 +498,13 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	if err != nil {
 		log.Debug(errEstablishControl, "error", err)
 		r.record.Event(pr, event.Warning(reasonSync, errors.Wrap(err, errEstablishControl)))
+		if IsBreakingChange(err) {
+			// NOTE: a breaking change requires the package to be changed or
+			// the revision to be annotated to allow it, so we requeue after
+			// long wait.
+			pr.SetConditions(pkgv1.BreakingSchemaChange(err.Error()))
+			return reconcile.Result{RequeueAfter: longWait}, errors.Wrap(r.client.Status().Update(ctx, pr), errUpdateStatus)
+		}
 		pr.SetConditions(pkgv1.Unhealthy())
 		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.client.Status().Update(ctx, pr), errUpdateStatus)
 	}
@@ -0,0 +1,138 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-runtime/pkg/resource"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+const (
+	errBreakingChange = "package revision would break installed CRDs"
+)
+
+// A breakingChangeError is returned when establishing the objects of a package
+// revision would break the schema of CRDs that are already installed.
+type breakingChangeError struct {
+	changes []string
+}
+
+func (e *breakingChangeError) Error() string {
+	return fmt.Sprintf("%s: %s", errBreakingChange, strings.Join(e.changes, "; "))
+}
+
+// IsBreakingChange returns true if the supplied error indicates that a package
+// revision would break the schema of installed CRDs.
+func IsBreakingChange(err error) bool {
+	var bce *breakingChangeError
+	return errors.As(err, &bce)
+}
+
+// allowBreakingChanges returns true if the parent explicitly allows breaking
+// changes to installed CRDs.
+func allowBreakingChanges(parent resource.Object) bool {
+	return parent.GetAnnotations()[pkgv1.AllowBreakingChangesAnnotation] == "true"
+}
+
+// breakingChanges returns the destructive changes replacing the current CRD
+// with the desired CRD would make: removed served versions, removed stored
+// versions and removed required properties. Objects that are not v1 CRDs
+// never have breaking changes.
+func breakingChanges(current, desired resource.Object) []string {
+	cur, ok := current.(*extv1.CustomResourceDefinition)
+	if !ok {
+		return nil
+	}
+	des, ok := desired.(*extv1.CustomResourceDefinition)
+	if !ok {
+		return nil
+	}
+
+	desVersions := map[string]extv1.CustomResourceDefinitionVersion{}
+	for _, v := range des.Spec.Versions {
+		desVersions[v.Name] = v
+	}
+
+	changes := []string{}
+	for _, v := range cur.Spec.Versions {
+		dv, ok := desVersions[v.Name]
+		if v.Served && (!ok || !dv.Served) {
+			changes = append(changes, fmt.Sprintf("%s: served version %s is removed", cur.GetName(), v.Name))
+		}
+		if !ok || v.Schema == nil || v.Schema.OpenAPIV3Schema == nil {
+			continue
+		}
+		var desSchema *extv1.JSONSchemaProps
+		if dv.Schema != nil {
+			desSchema = dv.Schema.OpenAPIV3Schema
+		}
+		for _, p := range removedRequired(v.Schema.OpenAPIV3Schema, desSchema, "") {
+			changes = append(changes, fmt.Sprintf("%s: required property %s of version %s is removed", cur.GetName(), p, v.Name))
+		}
+	}
+	for _, sv := range cur.Status.StoredVersions {
+		if _, ok := desVersions[sv]; !ok {
+			changes = append(changes, fmt.Sprintf("%s: stored version %s is removed", cur.GetName(), sv))
+		}
+	}
+	return changes
+}
+
+// removedRequired returns the paths of the properties that are required in the
+// current schema but do not exist in the desired schema.
+func removedRequired(cur, des *extv1.JSONSchemaProps, path string) []string {
+	if cur == nil {
+		return nil
+	}
+	removed := []string{}
+	for _, r := range cur.Required {
+		if des == nil {
+			removed = append(removed, path+"."+r)
+			continue
+		}
+		if _, ok := des.Properties[r]; !ok {
+			removed = append(removed, path+"."+r)
+		}
+	}
+	if des == nil {
+		return removed
+	}
+
+	names := make([]string, 0, len(cur.Properties))
+	for n := range cur.Properties {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		dp, ok := des.Properties[n]
+		if !ok {
+			continue
+		}
+		cp := cur.Properties[n]
+		removed = append(removed, removedRequired(&cp, &dp, path+"."+n)...)
+	}
+	if cur.Items != nil && cur.Items.Schema != nil && des.Items != nil {
+		removed = append(removed, removedRequired(cur.Items.Schema, des.Items.Schema, path+"[]")...)
+	}
+	return removed
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/yndd/ndd-runtime/pkg/resource"
+	corev1 "k8s.io/api/core/v1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// withSchema sets the schema of every version of the supplied CRD.
+func withSchema(c *extv1.CustomResourceDefinition, s *extv1.JSONSchemaProps) *extv1.CustomResourceDefinition {
+	for i := range c.Spec.Versions {
+		c.Spec.Versions[i].Schema = &extv1.CustomResourceValidation{OpenAPIV3Schema: s.DeepCopy()}
+	}
+	return c
+}
+
+// withStoredVersions sets the versions the supplied CRD was stored as.
+func withStoredVersions(c *extv1.CustomResourceDefinition, versions ...string) *extv1.CustomResourceDefinition {
+	c.Status.StoredVersions = versions
+	return c
+}
+
+// object returns a schema of an object with the supplied required properties
+// and properties.
+func object(required []string, props map[string]extv1.JSONSchemaProps) *extv1.JSONSchemaProps {
+	return &extv1.JSONSchemaProps{Type: "object", Required: required, Properties: props}
+}
+
+func TestBreakingChanges(t *testing.T) {
+	str := extv1.JSONSchemaProps{Type: "string"}
+	spec := func(required ...string) extv1.JSONSchemaProps {
+		props := map[string]extv1.JSONSchemaProps{"size": str}
+		for _, r := range required {
+			props[r] = str
+		}
+		return *object(append([]string{"size"}, required...), props)
+	}
+
+	cases := map[string]struct {
+		reason  string
+		current resource.Object
+		desired resource.Object
+		want    []string
+	}{
+		"Unchanged": {
+			reason:  "A CRD that does not change has no breaking changes.",
+			current: withSchema(crd("v1"), object([]string{"spec"}, map[string]extv1.JSONSchemaProps{"spec": spec()})),
+			desired: withSchema(crd("v1"), object([]string{"spec"}, map[string]extv1.JSONSchemaProps{"spec": spec()})),
+		},
+		"AddedVersion": {
+			reason:  "Adding a version does not break the CRD.",
+			current: crd("v1"),
+			desired: crd("v1", "v2"),
+		},
+		"RemovedServedVersion": {
+			reason:  "Removing a served version breaks clients that use it.",
+			current: crd("v1", "v2"),
+			desired: crd("v2"),
+			want:    []string{"things.example.org: served version v1 is removed"},
+		},
+		"RemovedStoredVersion": {
+			reason:  "Removing a version that objects are still stored as leaves them unreadable.",
+			current: withStoredVersions(crd("v2"), "v1", "v2"),
+			desired: crd("v2"),
+			want:    []string{"things.example.org: stored version v1 is removed"},
+		},
+		"RemovedRequired": {
+			reason:  "Removing a required property breaks objects that set it.",
+			current: withSchema(crd("v1"), object([]string{"spec"}, map[string]extv1.JSONSchemaProps{"spec": spec()})),
+			desired: withSchema(crd("v1"), object(nil, nil)),
+			want:    []string{"things.example.org: required property .spec of version v1 is removed"},
+		},
+		"RemovedNestedRequired": {
+			reason:  "Removing a required property of a nested object breaks objects that set it.",
+			current: withSchema(crd("v1"), object([]string{"spec"}, map[string]extv1.JSONSchemaProps{"spec": spec("color")})),
+			desired: withSchema(crd("v1"), object([]string{"spec"}, map[string]extv1.JSONSchemaProps{"spec": *object(nil, map[string]extv1.JSONSchemaProps{"size": str})})),
+			want:    []string{"things.example.org: required property .spec.color of version v1 is removed"},
+		},
+		"RemovedRequiredOfItems": {
+			reason: "Removing a required property of the items of an array breaks objects that set it.",
+			current: withSchema(crd("v1"), object(nil, map[string]extv1.JSONSchemaProps{
+				"list": {Type: "array", Items: &extv1.JSONSchemaPropsOrArray{Schema: object([]string{"name"}, map[string]extv1.JSONSchemaProps{"name": str})}},
+			})),
+			desired: withSchema(crd("v1"), object(nil, map[string]extv1.JSONSchemaProps{
+				"list": {Type: "array", Items: &extv1.JSONSchemaPropsOrArray{Schema: object(nil, nil)}},
+			})),
+			want: []string{"things.example.org: required property .list[].name of version v1 is removed"},
+		},
+		"RemovedSchema": {
+			reason:  "Removing the schema of a version removes all of its required properties.",
+			current: withSchema(crd("v1"), object([]string{"spec"}, map[string]extv1.JSONSchemaProps{"spec": spec()})),
+			desired: crd("v1"),
+			want:    []string{"things.example.org: required property .spec of version v1 is removed"},
+		},
+		"OptionalRemoved": {
+			reason:  "Removing a property that is not required does not break the CRD.",
+			current: withSchema(crd("v1"), object(nil, map[string]extv1.JSONSchemaProps{"spec": spec()})),
+			desired: withSchema(crd("v1"), object(nil, nil)),
+		},
+		"NotCRD": {
+			reason:  "Objects that are not CRDs never have breaking changes.",
+			current: &corev1.ConfigMap{},
+			desired: &corev1.ConfigMap{},
+		},
+	}
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			got := breakingChanges(tc.current, tc.desired)
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("\n%s\nbreakingChanges(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
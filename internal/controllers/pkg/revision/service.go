@@ -70,7 +70,7 @@ func renderService(cc *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpec, c *pkgmet
 			Labels: map[string]string{
 				getLabelKey(extra.Name): servicePrName,
 			},
-			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.ProviderRevisionGroupVersionKind))},
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.RevisionGroupVersionKind(pr)))},
 		},
 		Spec: spec,
 	}
@@ -93,7 +93,7 @@ func buildProviderMetricServiceHTTPS(provider *pkgmetav1.Provider, revision v1.P
 			Labels: map[string]string{
 				strings.Join([]string{pkgv1.PackageNamespace, metricsKey}, "/"): metricHTTPSServiceName,
 			},
-			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(revision, v1.ProviderRevisionGroupVersionKind))},
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(revision, v1.RevisionGroupVersionKind(revision)))},
 		},
 		Spec: corev1.ServiceSpec{
 			Selector: map[string]string{
@@ -120,7 +120,7 @@ func buildProviderProfileService(provider *pkgmetav1.Provider, revision v1.Packa
 			Labels: map[string]string{
 				strings.Join([]string{pkgv1.PackageNamespace, profilerKey}, "/"): profileServiceName,
 			},
-			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(revision, v1.ProviderRevisionGroupVersionKind))},
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(revision, v1.RevisionGroupVersionKind(revision)))},
 		},
 		Spec: corev1.ServiceSpec{
 			Selector: map[string]string{
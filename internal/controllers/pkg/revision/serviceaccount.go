@@ -29,7 +29,7 @@ func renderServiceAccount(pm *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpec, pr
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            pr.GetName(),
 			Namespace:       pm.Namespace,
-			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.ProviderRevisionGroupVersionKind))},
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.RevisionGroupVersionKind(pr)))},
 		},
 	}
 }
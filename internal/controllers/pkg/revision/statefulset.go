@@ -23,6 +23,7 @@ import (
 
 	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
 	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-core/internal/nddpkg"
 	"github.com/yndd/ndd-runtime/pkg/meta"
 	"github.com/yndd/ndd-runtime/pkg/utils"
 	appsv1 "k8s.io/api/apps/v1"
@@ -35,6 +36,7 @@ type Options struct {
 	grpcServiceName       string
 	grpcCertSecretName    string
 	compositeProviderName string
+	rewriter              *nddpkg.Rewriter
 }
 
 func renderProviderStatefulSet(pm *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpec, pr pkgv1.PackageRevision, o *Options) *appsv1.StatefulSet {
@@ -42,10 +44,10 @@ func renderProviderStatefulSet(pm *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpe
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            pr.GetName(),
 			Namespace:       pm.Namespace,
-			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.ProviderRevisionGroupVersionKind))},
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.RevisionGroupVersionKind(pr)))},
 		},
 		Spec: appsv1.StatefulSetSpec{
-			Replicas: utils.Int32Ptr(1),
+			Replicas: getReplicas(pr),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: getLabels(podSpec, pr),
 			},
@@ -70,6 +72,16 @@ func renderProviderStatefulSet(pm *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpe
 	return s
 }
 
+// getReplicas returns the number of controller replicas for the revision.
+// A canary revision runs with its canary replicas, all other revisions with
+// a single replica.
+func getReplicas(pr pkgv1.PackageRevision) *int32 {
+	if pr.GetDesiredState() == pkgv1.PackageRevisionCanary && pr.GetCanaryReplicas() != nil {
+		return pr.GetCanaryReplicas()
+	}
+	return utils.Int32Ptr(1)
+}
+
 func getPodSecurityContext() *corev1.PodSecurityContext {
 	return &corev1.PodSecurityContext{
 		RunAsUser:    utils.Int64Ptr(userGroup),
@@ -203,7 +215,7 @@ func getContainers(p *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpec, pullPolicy
 
 	for _, c := range podSpec.Containers {
 		if c.Container.Name == "kube-rbac-proxy" {
-			containers = append(containers, getKubeProxyContainer(c))
+			containers = append(containers, getKubeProxyContainer(c, o))
 		} else {
 			containers = append(containers, getContainer(p, c, pullPolicy, o))
 		}
@@ -212,10 +224,10 @@ func getContainers(p *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpec, pullPolicy
 	return containers
 }
 
-func getKubeProxyContainer(c *pkgmetav1.ContainerSpec) corev1.Container {
+func getKubeProxyContainer(c *pkgmetav1.ContainerSpec, o *Options) corev1.Container {
 	return corev1.Container{
 		Name:  c.Container.Name,
-		Image: c.Container.Image,
+		Image: o.rewriter.RewriteImage(c.Container.Image),
 		Args:  getProxyArgs(),
 		Ports: []corev1.ContainerPort{
 			{
@@ -298,7 +310,7 @@ func getVolumes(podSpec *pkgmetav1.PodSpec, pr pkgv1.PackageRevision) []corev1.V
 func getContainer(p *pkgmetav1.Provider, c *pkgmetav1.ContainerSpec, pullPolicy *corev1.PullPolicy, o *Options) corev1.Container {
 	return corev1.Container{
 		Name:            c.Container.Name,
-		Image:           c.Container.Image,
+		Image:           o.rewriter.RewriteImage(c.Container.Image),
 		ImagePullPolicy: *pullPolicy,
 		SecurityContext: getSecurityContext(),
 		Args:            getArgs(p),
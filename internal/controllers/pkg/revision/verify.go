@@ -0,0 +1,175 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"crypto"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/pkg/errors"
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-core/internal/nddpkg"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	errListVerificationPolicies = "cannot list verification policies"
+	errTrustedKey               = "cannot parse trusted public key"
+	errHeadPackage              = "cannot fetch package digest"
+	errFetchSignature           = "cannot fetch package signature"
+	errNotSigned                = "package is not signed"
+	errUnsignableSource         = "package source does not support signatures"
+)
+
+// A Verifier verifies that the package of a package revision is signed by a
+// trusted key.
+type Verifier interface {
+	// Verify returns the digest of the package whose signature was
+	// verified, or nil if no verification policy applies to the package of
+	// the revision. It returns an nddpkg.UnverifiedError if the package must
+	// be signed but does not carry a signature made by a trusted key, and
+	// any other error if its signature could not be checked. Only the image
+	// with the returned digest may be used, since the tag the revision
+	// refers to may since have moved.
+	Verify(ctx context.Context, pr pkgv1.PackageRevision) (*regv1.Hash, error)
+}
+
+// PolicyVerifier verifies package signatures against the public keys listed in
+// VerificationPolicies.
+type PolicyVerifier struct {
+	client  client.Client
+	fetcher nddpkg.Fetcher
+}
+
+// NewPolicyVerifier creates a new PolicyVerifier.
+func NewPolicyVerifier(client client.Client, fetcher nddpkg.Fetcher) *PolicyVerifier {
+	return &PolicyVerifier{
+		client:  client,
+		fetcher: fetcher,
+	}
+}
+
+// Verify verifies the signature of the package of the revision if a
+// verification policy applies to it.
+func (v *PolicyVerifier) Verify(ctx context.Context, pr pkgv1.PackageRevision) (*regv1.Hash, error) {
+	var ref name.Reference
+	repo := ""
+	if u, ok := nddpkg.ParseSourceURL(pr.GetSource()); ok {
+		repo = nddpkg.SourceIdentity(u)
+	} else {
+		r, err := name.ParseReference(pr.GetSource())
+		if err != nil {
+			return nil, errors.Wrap(err, errBadReference)
+		}
+		ref = r
+		repo = nddpkg.ParsePackageSourceFromReference(r)
+	}
+
+	keys, err := v.trustedKeys(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if ref == nil {
+		return nil, nddpkg.Unverified(errUnsignableSource + ": " + pr.GetSource())
+	}
+
+	secrets := pkgv1.RefNames(pr.GetPackagePullSecrets())
+	d, err := v.fetcher.Head(ctx, ref, secrets...)
+	if err != nil {
+		return nil, errors.Wrap(err, errHeadPackage)
+	}
+	if d == nil {
+		return nil, errors.New(errHeadPackage)
+	}
+	sig, err := v.fetcher.Fetch(ctx, nddpkg.SignatureTag(ref.Context(), d.Digest), secrets...)
+	if isNotFound(err) {
+		return nil, nddpkg.Unverified(errNotSigned)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, errFetchSignature)
+	}
+	if err := nddpkg.VerifySignature(sig, d.Digest, keys); err != nil {
+		return nil, err
+	}
+	return &d.Digest, nil
+}
+
+// isNotFound returns true if the supplied registry error reports that an
+// image does not exist.
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
+
+// trustedKeys returns the public keys of all rules that apply to the supplied
+// repository.
+func (v *PolicyVerifier) trustedKeys(ctx context.Context, repo string) ([]crypto.PublicKey, error) {
+	l := &pkgv1.VerificationPolicyList{}
+	if err := v.client.List(ctx, l); err != nil {
+		return nil, errors.Wrap(err, errListVerificationPolicies)
+	}
+	keys := []crypto.PublicKey{}
+	for _, p := range l.Items {
+		for _, rule := range p.Spec.Rules {
+			if !matchRepository(rule.Repository, repo) {
+				continue
+			}
+			for _, k := range rule.PublicKeys {
+				pub, err := nddpkg.ParsePublicKey(k)
+				if err != nil {
+					return nil, errors.Wrapf(err, "%s in verification policy %s", errTrustedKey, p.GetName())
+				}
+				keys = append(keys, pub)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// matchRepository returns true if a verification rule for the supplied
+// repository pattern applies to repo.
+func matchRepository(pattern, repo string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasSuffix(pattern, "/*"):
+		return strings.HasPrefix(repo, strings.TrimSuffix(pattern, "*"))
+	default:
+		return pattern == repo
+	}
+}
+
+// NopVerifier never requires package signatures.
+type NopVerifier struct{}
+
+// NewNopVerifier creates a new NopVerifier.
+func NewNopVerifier() *NopVerifier {
+	return &NopVerifier{}
+}
+
+// Verify does not verify anything and never returns an error.
+func (n *NopVerifier) Verify(ctx context.Context, pr pkgv1.PackageRevision) (*regv1.Hash, error) {
+	return nil, nil
+}
@@ -0,0 +1,342 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kfake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	pkgv1 "github.com/yndd/ndd-core/apis/pkg/v1"
+	"github.com/yndd/ndd-core/internal/nddpkg"
+)
+
+// testRegistry serves an in-memory registry for the duration of a test and
+// returns the repository packages are pushed to.
+func testRegistry(t *testing.T) name.Repository {
+	t.Helper()
+	s := httptest.NewServer(registry.New(registry.Logger(log.New(ioutil.Discard, "", 0))))
+	t.Cleanup(s.Close)
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := name.NewRepository(u.Host + "/yndd/pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// packageImage returns a package image whose stream file has the supplied
+// contents.
+func packageImage(t *testing.T, contents string) regv1.Image {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Name: nddpkg.StreamFile, Mode: int64(nddpkg.StreamFileMode), Size: int64(len(contents))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(contents)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(empty.Image, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// push pushes the supplied image to the supplied reference.
+func push(t *testing.T, ref name.Reference, img regv1.Image) regv1.Hash {
+	t.Helper()
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func generateKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// sign pushes a signature of the image with the supplied digest made by the
+// supplied key.
+func sign(t *testing.T, repo name.Repository, d regv1.Hash, k *ecdsa.PrivateKey) {
+	t.Helper()
+	payload := map[string]interface{}{
+		"critical": map[string]interface{}{
+			"image": map[string]string{"docker-manifest-digest": d.String()},
+		},
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256(b)
+	sig, err := ecdsa.SignASN1(rand.Reader, k, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(b, types.MediaType(nddpkg.SimpleSigningMediaType)),
+		Annotations: map[string]string{nddpkg.SignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	push(t, nddpkg.SignatureTag(repo, d), img)
+}
+
+func verifier(t *testing.T, repo name.Repository, keys ...string) *PolicyVerifier {
+	t.Helper()
+	return verifierWithFetcher(t, fetcher(), repo, keys...)
+}
+
+func verifierWithFetcher(t *testing.T, f nddpkg.Fetcher, repo name.Repository, keys ...string) *PolicyVerifier {
+	t.Helper()
+	s := runtime.NewScheme()
+	if err := pkgv1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	vp := &pkgv1.VerificationPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy"},
+		Spec: pkgv1.VerificationPolicySpec{
+			Rules: []pkgv1.VerificationRule{{Repository: repo.String(), PublicKeys: keys}},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(vp).Build()
+	return NewPolicyVerifier(c, f)
+}
+
+// headFetcher returns the supplied descriptor and error from Head.
+type headFetcher struct {
+	nddpkg.Fetcher
+	desc *regv1.Descriptor
+	err  error
+}
+
+func (f headFetcher) Head(_ context.Context, _ name.Reference, _ ...string) (*regv1.Descriptor, error) {
+	return f.desc, f.err
+}
+
+func fetcher() nddpkg.Fetcher {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "ndd-system"}}
+	return nddpkg.NewK8sFetcher(kfake.NewSimpleClientset(sa), "ndd-system")
+}
+
+func revision(source string) *pkgv1.ProviderRevision {
+	pr := &pkgv1.ProviderRevision{ObjectMeta: metav1.ObjectMeta{Name: "pkg-1234"}}
+	pr.SetSource(source)
+	return pr
+}
+
+func TestPolicyVerifierVerify(t *testing.T) {
+	trusted, trustedPEM := generateKey(t)
+	untrusted, _ := generateKey(t)
+
+	cases := map[string]struct {
+		reason string
+		sign   *ecdsa.PrivateKey
+		keys   []string
+		// head overrides what the registry returns for the package.
+		head           *headFetcher
+		want           bool
+		wantErr        bool
+		wantUnverified bool
+	}{
+		"NoPolicy": {
+			reason: "A package no policy applies to should not require a signature.",
+		},
+		"Signed": {
+			reason: "A package signed by a trusted key should be verified and return its digest.",
+			sign:   trusted,
+			keys:   []string{trustedPEM},
+			want:   true,
+		},
+		"Unsigned": {
+			reason:         "A package without a signature should not be verified.",
+			keys:           []string{trustedPEM},
+			wantErr:        true,
+			wantUnverified: true,
+		},
+		"UntrustedKey": {
+			reason:         "A package signed by a key that is not trusted should not be verified.",
+			sign:           untrusted,
+			keys:           []string{trustedPEM},
+			wantErr:        true,
+			wantUnverified: true,
+		},
+		"HeadFailed": {
+			reason:  "A registry error should be returned without reporting the package as unverified.",
+			keys:    []string{trustedPEM},
+			head:    &headFetcher{err: errors.New("boom")},
+			wantErr: true,
+		},
+		"NoDescriptor": {
+			reason:  "A registry that returns no descriptor for the package should not let it pass unverified.",
+			keys:    []string{trustedPEM},
+			head:    &headFetcher{},
+			wantErr: true,
+		},
+	}
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			repo := testRegistry(t)
+			d := push(t, repo.Tag("v1"), packageImage(t, "v1"))
+			if tc.sign != nil {
+				sign(t, repo, d, tc.sign)
+			}
+			f := fetcher()
+			if tc.head != nil {
+				tc.head.Fetcher = f
+				f = tc.head
+			}
+			v := verifierWithFetcher(t, f, repo)
+			if tc.keys != nil {
+				v = verifierWithFetcher(t, f, repo, tc.keys...)
+			}
+
+			got, err := v.Verify(context.Background(), revision(repo.Tag("v1").String()))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("\n%s\nVerify(...): error %v, want error %t", tc.reason, err, tc.wantErr)
+			}
+			if nddpkg.IsUnverified(err) != tc.wantUnverified {
+				t.Errorf("\n%s\nVerify(...): error %v, want unverified %t", tc.reason, err, tc.wantUnverified)
+			}
+			if tc.want && (got == nil || *got != d) {
+				t.Errorf("\n%s\nVerify(...): got digest %v, want %s", tc.reason, got, d)
+			}
+			if !tc.want && got != nil {
+				t.Errorf("\n%s\nVerify(...): got digest %s, want none", tc.reason, got)
+			}
+		})
+	}
+}
+
+func TestImageBackendVerifiedDigest(t *testing.T) {
+	k, pub := generateKey(t)
+
+	cases := map[string]struct {
+		reason string
+		// prepare runs after the signed package was verified, and may move
+		// its tag or poison the cache.
+		prepare func(t *testing.T, repo name.Repository, c nddpkg.Cache)
+	}{
+		"Unchanged": {
+			reason:  "The verified package should be returned.",
+			prepare: func(t *testing.T, repo name.Repository, c nddpkg.Cache) {},
+		},
+		"TagMoved": {
+			reason: "The verified package rather than the package its tag moved to should be returned.",
+			prepare: func(t *testing.T, repo name.Repository, c nddpkg.Cache) {
+				push(t, repo.Tag("v1"), packageImage(t, "unsigned"))
+			},
+		},
+		"CachedUnverified": {
+			reason: "An unverified package cached for the revision should be replaced by the verified package.",
+			prepare: func(t *testing.T, repo name.Repository, c nddpkg.Cache) {
+				if err := c.Store(repo.Tag("v1").String(), "pkg-1234", packageImage(t, "unsigned")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			repo := testRegistry(t)
+			d := push(t, repo.Tag("v1"), packageImage(t, "signed"))
+			sign(t, repo, d, k)
+			pr := revision(repo.Tag("v1").String())
+
+			verified, err := verifier(t, repo, pub).Verify(context.Background(), pr)
+			if err != nil {
+				t.Fatalf("\n%s\nVerify(...): %v", tc.reason, err)
+			}
+
+			c := nddpkg.NewImageCache("/cache", afero.NewMemMapFs())
+			tc.prepare(t, repo, c)
+
+			rc, err := NewImageBackend(c, fetcher(), nil).Init(context.Background(), PackageRevision(pr), VerifiedDigest(verified))
+			if err != nil {
+				t.Fatalf("\n%s\nInit(...): %v", tc.reason, err)
+			}
+			defer func() { _ = rc.Close() }()
+			got, err := ioutil.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "signed" {
+				t.Errorf("\n%s\nInit(...): got package %q, want %q", tc.reason, got, "signed")
+			}
+		})
+	}
+}
@@ -48,7 +48,7 @@ func renderWebhookMutate(p *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpec, c *p
 			Annotations: map[string]string{
 				"cert-manager.io/inject-ca-from": strings.Join([]string{p.Namespace, certificateName}, "/"),
 			},
-			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.ProviderRevisionGroupVersionKind))},
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.RevisionGroupVersionKind(pr)))},
 		},
 		Webhooks: []admissionv1.MutatingWebhook{
 			{
@@ -98,7 +98,7 @@ func renderWebhookValidate(p *pkgmetav1.Provider, podSpec *pkgmetav1.PodSpec, c
 			Annotations: map[string]string{
 				"cert-manager.io/inject-ca-from": strings.Join([]string{p.Namespace, certificateName}, "/"),
 			},
-			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.ProviderRevisionGroupVersionKind))},
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(meta.TypedReferenceTo(pr, pkgv1.RevisionGroupVersionKind(pr)))},
 		},
 		Webhooks: []admissionv1.ValidatingWebhook{
 			{
@@ -83,6 +83,29 @@ func SetupProvider(mgr ctrl.Manager, log logging.Logger) error {
 			WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name)))))
 }
 
+// SetupIntent adds a controller that reconciles an IntentRevision by creating
+// a ClusterRoleBinding that binds an intent's service account to its system
+// ClusterRole.
+func SetupIntent(mgr ctrl.Manager, log logging.Logger) error {
+	name := "rbac/" + strings.ToLower(v1.IntentRevisionGroupKind)
+	np := func() v1.Package { return &v1.Intent{} }
+	nr := func() v1.PackageRevision { return &v1.IntentRevision{} }
+	nrl := func() v1.PackageRevisionList { return &v1.IntentRevisionList{} }
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(&v1.IntentRevision{}).
+		Owns(&rbacv1.ClusterRoleBinding{}).
+		Watches(&source.Kind{Type: &corev1.ServiceAccount{}}, &handler.EnqueueRequestForOwner{OwnerType: &v1.IntentRevision{}}).
+		WithOptions(kcontroller.Options{MaxConcurrentReconciles: maxConcurrency}).
+		Complete(NewReconciler(mgr,
+			WithNewPackageFn(np),
+			WithNewPackageRevisionFn(nr),
+			WithNewPackageRevisionListFn(nrl),
+			WithLogger(log.WithValues("controller", name)),
+			WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name)))))
+}
+
 // ReconcilerOption is used to configure the Reconciler.
 type ReconcilerOption func(*Reconciler)
 
@@ -213,14 +236,16 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 
 	var cbrName string
 	var cbrMetricName string
-	var ref metav1.OwnerReference
-	switch pr.GetKind() {
+	switch pr.(type) {
+	case *v1.IntentRevision:
+		cbrName = roles.SystemClusterIntentRoleName(pr.GetName())
+		cbrMetricName = roles.SystemClusterIntentMetricRoleName(pr.GetName())
 	default:
 		// Provider Revision
 		cbrName = roles.SystemClusterProviderRoleName(pr.GetName())
 		cbrMetricName = roles.SystemClusterProviderMetricRoleName(pr.GetName())
-		ref = meta.AsController(meta.TypedReferenceTo(pr, v1.ProviderRevisionGroupVersionKind))
 	}
+	ref := meta.AsController(meta.TypedReferenceTo(pr, v1.RevisionGroupVersionKind(pr)))
 
 	// cluster role for CRD access
 	rb := &rbacv1.ClusterRoleBinding{
@@ -44,6 +44,7 @@ func Setup(mgr ctrl.Manager, l logging.Logger, mp ManagementPolicy, allowCluster
 	fns := []func(ctrl.Manager, logging.Logger) error{
 		//definition.Setup,
 		binding.SetupProvider,
+		binding.SetupIntent,
 	}
 
 	//if mp == ManagementPolicyAll {
@@ -60,5 +61,9 @@ func Setup(mgr ctrl.Manager, l logging.Logger, mp ManagementPolicy, allowCluster
 		return err
 	}
 
+	if err := roles.SetupIntent(mgr, l, allowClusterRole); err != nil {
+		return err
+	}
+
 	return nil
 }
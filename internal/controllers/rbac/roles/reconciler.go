@@ -90,24 +90,41 @@ func (fn ClusterRoleRenderFn) RenderClusterRoles(pr *v1.PackageRevision, crds []
 	return fn(pr, crds)
 }
 
-// Setup adds a controller that reconciles a ProviderRevision by creating a
-// series of opinionated ClusterRoles that may be bound to allow access to the
-// resources it defines.
+// SetupProvider adds a controller that reconciles a ProviderRevision by
+// creating a series of opinionated ClusterRoles that may be bound to allow
+// access to the resources it defines.
 func SetupProvider(mgr ctrl.Manager, log logging.Logger, allowClusterRole string) error {
 	name := "rbac/" + strings.ToLower(v1.ProviderRevisionGroupKind)
 	np := func() v1.Package { return &v1.Provider{} }
 	nr := func() v1.PackageRevision { return &v1.ProviderRevision{} }
 	nrl := func() v1.PackageRevisionList { return &v1.ProviderRevisionList{} }
 
+	return setup(mgr, log, allowClusterRole, name, np, nr, nrl)
+}
+
+// SetupIntent adds a controller that reconciles an IntentRevision by creating
+// a series of opinionated ClusterRoles that may be bound to allow access to
+// the resources it defines.
+func SetupIntent(mgr ctrl.Manager, log logging.Logger, allowClusterRole string) error {
+	name := "rbac/" + strings.ToLower(v1.IntentRevisionGroupKind)
+	np := func() v1.Package { return &v1.Intent{} }
+	nr := func() v1.PackageRevision { return &v1.IntentRevision{} }
+	nrl := func() v1.PackageRevisionList { return &v1.IntentRevisionList{} }
+
+	return setup(mgr, log, allowClusterRole, name, np, nr, nrl)
+}
+
+func setup(mgr ctrl.Manager, log logging.Logger, allowClusterRole, name string, np func() v1.Package, nr func() v1.PackageRevision, nrl func() v1.PackageRevisionList) error {
 	if allowClusterRole != "" {
 
 		h := &EnqueueRequestForAllRevisionsWithRequests{
-			client:          mgr.GetClient(),
-			clusterRoleName: allowClusterRole}
+			client:                 mgr.GetClient(),
+			clusterRoleName:        allowClusterRole,
+			newPackageRevisionList: nrl}
 
 		return ctrl.NewControllerManagedBy(mgr).
 			Named(name).
-			For(&v1.ProviderRevision{}).
+			For(nr()).
 			Owns(&rbacv1.ClusterRole{}).
 			Watches(&source.Kind{Type: &rbacv1.ClusterRole{}}, h).
 			WithOptions(kcontroller.Options{MaxConcurrentReconciles: maxConcurrency}).
@@ -123,7 +140,7 @@ func SetupProvider(mgr ctrl.Manager, log logging.Logger, allowClusterRole string
 
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(name).
-		For(&v1.ProviderRevision{}).
+		For(nr()).
 		Owns(&rbacv1.ClusterRole{}).
 		WithOptions(kcontroller.Options{MaxConcurrentReconciles: maxConcurrency}).
 		Complete(NewReconciler(mgr,
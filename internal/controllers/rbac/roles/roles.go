@@ -93,12 +93,12 @@ var rulesSystemExtraNew = []rbacv1.PolicyRule{
 	},
 	{
 		APIGroups: []string{"meta.pkg.ndd.yndd.io"},
-		Resources: []string{"providers", "controllerconfigs"},
+		Resources: []string{"providers", "intents", "controllerconfigs"},
 		Verbs:     verbsEdit,
 	},
 	{
 		APIGroups: []string{"pkg.ndd.yndd.io"},
-		Resources: []string{"providerrevisions", "providers"},
+		Resources: []string{"providerrevisions", "providers", "intentrevisions", "intents"},
 		Verbs:     verbsView,
 	},
 	{
@@ -302,7 +302,12 @@ func RenderClusterRoles(pr *v1.PackageRevision, crds []extv1.CustomResourceDefin
 	// The 'system' RBAC role does not aggregate; it is intended to be bound
 	// directly to the service account that the provider/intent runs as.
 	var system *rbacv1.ClusterRole
-	switch (*pr).GetKind() {
+	switch (*pr).(type) {
+	case *v1.IntentRevision:
+		system = &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: SystemClusterIntentRoleName((*pr).GetRevName())},
+			Rules:      append(append(withVerbs(rules, verbsSystem), rulesSystemExtraNew...), (*pr).GetPermissionsRequests()...),
+		}
 	default:
 		// Provider revision
 		/*
@@ -324,13 +329,7 @@ func RenderClusterRoles(pr *v1.PackageRevision, crds []extv1.CustomResourceDefin
 
 	roles := []rbacv1.ClusterRole{*system}
 	for i := range roles {
-		var ref metav1.OwnerReference
-
-		switch (*pr).GetKind() {
-		default:
-			// Provider revision
-			ref = meta.AsController(meta.TypedReferenceTo(*pr, v1.ProviderRevisionGroupVersionKind))
-		}
+		ref := meta.AsController(meta.TypedReferenceTo(*pr, v1.RevisionGroupVersionKind(*pr)))
 		roles[i].SetOwnerReferences([]metav1.OwnerReference{ref})
 	}
 	return roles
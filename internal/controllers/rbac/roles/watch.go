@@ -37,8 +37,9 @@ type adder interface {
 // revisions with permission requests when the ClusterRole that enumerates
 // allowed permissions changes.
 type EnqueueRequestForAllRevisionsWithRequests struct {
-	client          client.Client
-	clusterRoleName string
+	client                 client.Client
+	clusterRoleName        string
+	newPackageRevisionList func() v1.PackageRevisionList
 }
 
 // Create enqueues a request for all provider revisions with permission requests
@@ -76,14 +77,14 @@ func (e *EnqueueRequestForAllRevisionsWithRequests) add(obj runtime.Object, queu
 		return
 	}
 
-	l := &v1.ProviderRevisionList{}
+	l := e.newPackageRevisionList()
 	if err := e.client.List(context.TODO(), l); err != nil {
 		// TODO: Handle this error?
 		return
 	}
 
-	for _, pr := range l.Items {
-		if len(pr.Status.PermissionRequests) == 0 {
+	for _, pr := range l.GetRevisions() {
+		if len(pr.GetPermissionsRequests()) == 0 {
 			// We only need to requeue so that revisions with permission
 			// requests that were denied may now be approved.
 			continue
@@ -16,6 +16,9 @@ limitations under the License.
 package dag
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/pkg/errors"
 )
 
@@ -208,14 +211,22 @@ func (d *MapDag) AddEdge(from string, to Node) (bool, error) {
 	return implied, d.nodes[from].AddNeighbors(to)
 }
 
-// Sort performs topological sort on the graph.
+// Sort performs topological sort on the graph. If the graph contains a cycle
+// the returned error reports its path, which can be retrieved with CyclePath.
+// Nodes are visited in order of their identifiers, such that the same cycle
+// is always reported with the same path.
 func (d *MapDag) Sort() ([]string, error) {
+	names := make([]string, 0, len(d.nodes))
+	for n := range d.nodes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
 	visited := map[string]bool{}
 	results := make([]string, len(d.nodes))
-	for n, node := range d.nodes {
+	for _, n := range names {
 		if !visited[n] {
-			stack := map[string]bool{}
-			if err := d.visit(n, node.Neighbors(), stack, visited, results); err != nil {
+			stack := []string{}
+			if err := d.visit(n, d.nodes[n].Neighbors(), stack, visited, results); err != nil {
 				return nil, err
 			}
 		}
@@ -223,16 +234,21 @@ func (d *MapDag) Sort() ([]string, error) {
 	return results, nil
 }
 
-func (d *MapDag) visit(name string, neighbors []Node, stack map[string]bool, visited map[string]bool, results []string) error {
+func (d *MapDag) visit(name string, neighbors []Node, stack []string, visited map[string]bool, results []string) error {
 	visited[name] = true
-	stack[name] = true
+	stack = append(stack, name)
 	for _, n := range neighbors {
 		if !visited[n.Identifier()] {
 			if err := d.visit(n.Identifier(), d.nodes[n.Identifier()].Neighbors(), stack, visited, results); err != nil {
 				return err
 			}
-		} else if stack[n.Identifier()] {
-			return errors.Errorf("detected cycle on: %s", n.Identifier())
+			continue
+		}
+		for i, s := range stack {
+			if s == n.Identifier() {
+				path := append([]string{}, stack[i:]...)
+				return cycleError{path: append(path, s)}
+			}
 		}
 	}
 	for i, r := range results {
@@ -241,6 +257,30 @@ func (d *MapDag) visit(name string, neighbors []Node, stack map[string]bool, vis
 			break
 		}
 	}
-	stack[name] = false
 	return nil
 }
+
+type cycleError struct {
+	path []string
+}
+
+func (e cycleError) Error() string {
+	return "detected cycle: " + strings.Join(e.path, " -> ")
+}
+
+// IsCycle returns true if the supplied error indicates that a graph contains a
+// cycle.
+func IsCycle(err error) bool {
+	return errors.As(err, &cycleError{})
+}
+
+// CyclePath returns the nodes of the cycle reported by the supplied error,
+// starting and ending with the same node, or nil if the error does not
+// indicate a cycle.
+func CyclePath(err error) []string {
+	ce := cycleError{}
+	if !errors.As(err, &ce) {
+		return nil
+	}
+	return ce.path
+}
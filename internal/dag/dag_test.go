@@ -0,0 +1,165 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dag
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+// A simpleNode depends on the nodes with the identifiers of its neighbors.
+type simpleNode struct {
+	id        string
+	neighbors []string
+}
+
+func (n *simpleNode) Identifier() string {
+	return n.id
+}
+
+func (n *simpleNode) Neighbors() []Node {
+	nodes := make([]Node, len(n.neighbors))
+	for i, id := range n.neighbors {
+		nodes[i] = &simpleNode{id: id}
+	}
+	return nodes
+}
+
+func (n *simpleNode) AddNeighbors(...Node) error {
+	return nil
+}
+
+func TestMapDagSort(t *testing.T) {
+	cases := map[string]struct {
+		reason    string
+		nodes     []Node
+		wantCycle []string
+	}{
+		"Acyclic": {
+			reason: "A graph without a cycle should be sorted with every node after its neighbors.",
+			nodes: []Node{
+				&simpleNode{id: "a", neighbors: []string{"b", "c"}},
+				&simpleNode{id: "b", neighbors: []string{"c"}},
+				&simpleNode{id: "c"},
+			},
+		},
+		"Cycle": {
+			reason: "The path of a cycle should be reported starting and ending with the same node.",
+			nodes: []Node{
+				&simpleNode{id: "a", neighbors: []string{"b"}},
+				&simpleNode{id: "b", neighbors: []string{"c"}},
+				&simpleNode{id: "c", neighbors: []string{"a"}},
+			},
+			wantCycle: []string{"a", "b", "c", "a"},
+		},
+		"CycleBelowRoot": {
+			reason: "The path of a cycle should only include the nodes that are part of it.",
+			nodes: []Node{
+				&simpleNode{id: "a", neighbors: []string{"b"}},
+				&simpleNode{id: "b", neighbors: []string{"c"}},
+				&simpleNode{id: "c", neighbors: []string{"d"}},
+				&simpleNode{id: "d", neighbors: []string{"b"}},
+			},
+			wantCycle: []string{"b", "c", "d", "b"},
+		},
+		"SelfCycle": {
+			reason: "A node that depends on itself should be reported as a cycle of one node.",
+			nodes: []Node{
+				&simpleNode{id: "a", neighbors: []string{"a"}},
+			},
+			wantCycle: []string{"a", "a"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			d := NewMapDag()
+			if _, err := d.Init(tc.nodes); err != nil {
+				t.Fatal(err)
+			}
+			// The same cycle must be reported the same way every time.
+			for i := 0; i < 10; i++ {
+				got, err := d.Sort()
+				if tc.wantCycle == nil {
+					if err != nil {
+						t.Fatalf("\n%s\nSort(): %v", tc.reason, err)
+					}
+					pos := map[string]int{}
+					for j, n := range got {
+						pos[n] = j
+					}
+					for _, n := range tc.nodes {
+						for _, nb := range n.Neighbors() {
+							if pos[nb.Identifier()] > pos[n.Identifier()] {
+								t.Errorf("\n%s\nSort(): got %v, want %s after %s", tc.reason, got, n.Identifier(), nb.Identifier())
+							}
+						}
+					}
+					return
+				}
+				if !IsCycle(err) {
+					t.Fatalf("\n%s\nSort(): got error %v, want a cycle", tc.reason, err)
+				}
+				if diff := cmp.Diff(tc.wantCycle, CyclePath(err)); diff != "" {
+					t.Fatalf("\n%s\nCyclePath(...): -want, +got:\n%s", tc.reason, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestCyclePath(t *testing.T) {
+	cycle := cycleError{path: []string{"a", "b", "a"}}
+
+	cases := map[string]struct {
+		reason    string
+		err       error
+		wantCycle bool
+		wantPath  []string
+	}{
+		"Cycle": {
+			reason:    "The path of a cycle error should be returned.",
+			err:       cycle,
+			wantCycle: true,
+			wantPath:  []string{"a", "b", "a"},
+		},
+		"Wrapped": {
+			reason:    "The path of a wrapped cycle error should be returned.",
+			err:       errors.Wrap(cycle, "cannot sort DAG"),
+			wantCycle: true,
+			wantPath:  []string{"a", "b", "a"},
+		},
+		"OtherError": {
+			reason: "An error that does not indicate a cycle has no path.",
+			err:    errors.New("node does not exist"),
+		},
+		"NoError": {
+			reason: "No error has no path.",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := IsCycle(tc.err); got != tc.wantCycle {
+				t.Errorf("\n%s\nIsCycle(...): got %t, want %t", tc.reason, got, tc.wantCycle)
+			}
+			if diff := cmp.Diff(tc.wantPath, CyclePath(tc.err)); diff != "" {
+				t.Errorf("\n%s\nCyclePath(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -18,15 +18,24 @@ package nddpkg
 
 import (
 	"archive/tar"
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/pkg/errors"
+	"github.com/spf13/afero/tarfs"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
 
 	"github.com/yndd/ndd-runtime/pkg/parser"
 )
@@ -37,8 +46,47 @@ const (
 	errInitBackend   = "failed to initialize package parsing backend"
 	errTarFromStream = "failed to build tarball from package stream"
 	errLayerFromTar  = "failed to convert tarball to image layer"
+	errOpenStream    = "failed to open package stream file"
+	errNormalize     = "failed to normalize package stream"
+	errSetCreated    = "failed to set package creation time"
+	errSourceDateFmt = "invalid %s %q"
 )
 
+// SourceDateEpochEnv is the environment variable that pins the timestamps
+// recorded in a package image. See
+// https://reproducible-builds.org/specs/source-date-epoch/
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// BuildTimestamp returns the timestamp a package image should record: the
+// time set by SOURCE_DATE_EPOCH if it is set, and the Unix epoch otherwise.
+func BuildTimestamp() (time.Time, error) {
+	e, ok := os.LookupEnv(SourceDateEpochEnv)
+	if !ok || e == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	sec, err := strconv.ParseInt(e, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, errSourceDateFmt, SourceDateEpochEnv, e)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// BuildOption configures how a package image is built.
+type BuildOption func(*buildOptions)
+
+type buildOptions struct {
+	timestamp time.Time
+}
+
+// WithTimestamp sets the modification time of the package stream file and the
+// creation time recorded in the image config. The Unix epoch is used by
+// default.
+func WithTimestamp(t time.Time) BuildOption {
+	return func(o *buildOptions) {
+		o.timestamp = t
+	}
+}
+
 // annotatedTeeReadCloser is a copy of io.TeeReader that implements
 // parser.AnnotatedReadCloser. It returns a Reader that writes to w what it
 // reads from r. All reads from r performed through it are matched with
@@ -78,8 +126,10 @@ func (t *teeReader) Annotate() interface{} {
 	return anno.Annotate()
 }
 
-// Build compiles a Ndd package from an on-disk package.
-func Build(ctx context.Context, b parser.Backend, p parser.Parser, l parser.Linter) (v1.Image, error) {
+// Build compiles a Ndd package from an on-disk package. The package stream is
+// normalized and all timestamps are pinned, such that building the same
+// package twice produces the same image digest.
+func Build(ctx context.Context, b parser.Backend, p parser.Parser, l parser.Linter, o ...BuildOption) (v1.Image, error) {
 	// Get YAML stream.
 	r, err := b.Init(ctx)
 	if err != nil {
@@ -96,20 +146,99 @@ func Build(ctx context.Context, b parser.Backend, p parser.Parser, l parser.Lint
 	if err := l.Lint(pkg); err != nil {
 		return nil, errors.Wrap(err, errLintPackage)
 	}
+	stream, err := normalizeStream(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, errNormalize)
+	}
+	return ImageFromStream(bytes.NewBuffer(stream), o...)
+}
+
+// normalizeStream re-serializes every document of a package YAML stream with
+// sorted keys and sorts the documents by apiVersion, kind and name, such that
+// the stream does not depend on file layout, key order, comments or
+// formatting. Empty documents are dropped.
+func normalizeStream(stream []byte) ([]byte, error) {
+	type document struct {
+		key  [3]string
+		data []byte
+	}
+	docs := []document{}
+	r := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(stream)))
+	for {
+		b, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		j, err := sigsyaml.YAMLToJSON(b)
+		if err != nil {
+			return nil, err
+		}
+		if t := bytes.TrimSpace(j); len(t) == 0 || bytes.Equal(t, []byte("null")) {
+			continue
+		}
+		k := struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}{}
+		if err := json.Unmarshal(j, &k); err != nil {
+			return nil, err
+		}
+		y, err := sigsyaml.JSONToYAML(j)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, document{key: [3]string{k.APIVersion, k.Kind, k.Metadata.Name}, data: y})
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for n := range docs[i].key {
+			if docs[i].key[n] != docs[j].key[n] {
+				return docs[i].key[n] < docs[j].key[n]
+			}
+		}
+		return bytes.Compare(docs[i].data, docs[j].data) < 0
+	})
+
+	out := new(bytes.Buffer)
+	for i, d := range docs {
+		if i > 0 {
+			out.WriteString("---\n")
+		}
+		out.Write(d.data)
+	}
+	return out.Bytes(), nil
+}
 
-	// Write on-disk package contents to tarball.
+// ImageFromStream builds a package image from a package YAML stream. The
+// stream is written as is; all timestamps are pinned such that the same stream
+// always produces the same image digest.
+func ImageFromStream(buf *bytes.Buffer, o ...BuildOption) (v1.Image, error) {
+	opts := &buildOptions{timestamp: time.Unix(0, 0).UTC()}
+	for _, fn := range o {
+		fn(opts)
+	}
+
+	// Write package contents to tarball.
 	tarBuf := new(bytes.Buffer)
 	tw := tar.NewWriter(tarBuf)
 
 	hdr := &tar.Header{
-		Name: StreamFile,
-		Mode: int64(StreamFileMode),
-		Size: int64(buf.Len()),
+		Typeflag: tar.TypeReg,
+		Name:     StreamFile,
+		Mode:     int64(StreamFileMode),
+		Size:     int64(buf.Len()),
+		ModTime:  opts.timestamp,
+		Format:   tar.FormatPAX,
 	}
 	if err := tw.WriteHeader(hdr); err != nil {
 		return nil, errors.Wrap(err, errTarFromStream)
 	}
-	if _, err = io.Copy(tw, buf); err != nil {
+	if _, err := io.Copy(tw, buf); err != nil {
 		return nil, errors.Wrap(err, errTarFromStream)
 	}
 	if err := tw.Close(); err != nil {
@@ -123,5 +252,23 @@ func Build(ctx context.Context, b parser.Backend, p parser.Parser, l parser.Lint
 	}
 
 	// Append layer to to scratch image.
-	return mutate.AppendLayers(empty.Image, layer)
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:   layer,
+		History: v1.History{Created: v1.Time{Time: opts.timestamp}},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, errLayerFromTar)
+	}
+	img, err = mutate.CreatedAt(img, v1.Time{Time: opts.timestamp})
+	return img, errors.Wrap(err, errSetCreated)
+}
+
+// OpenStream opens the package YAML stream of a package image.
+func OpenStream(img v1.Image) (io.ReadCloser, error) {
+	fs := tarfs.New(tar.NewReader(mutate.Extract(img)))
+	f, err := fs.Open(StreamFile)
+	if err != nil {
+		return nil, errors.Wrap(err, errOpenStream)
+	}
+	return f, nil
 }
@@ -17,19 +17,53 @@ limitations under the License.
 package nddpkg
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 )
 
 const (
 	errGetNopCache = "cannot get an image from a NopCache"
+	errImageDigest = "cannot get digest of image"
+	errReadRef     = "cannot read cache entry"
+	errCorrupt     = "cached image is corrupt"
+	errDigestFmt   = "image digest %s does not match digest %s of its cache entry"
+	errLayerCount  = "image has a different number of layers than its manifest"
+
+	// blobsDir holds the cached images, named by digest.
+	blobsDir = "blobs"
+
+	// refsDir holds one file per cache entry id, containing the digest of
+	// the image it refers to.
+	refsDir = "refs"
+
+	// tempExtension is appended to images while they are being written.
+	tempExtension = ".tmp"
+
+	// pruneGrace is how long an entry is kept after it was written even if
+	// it is not kept when pruning, such that an imported package can be
+	// installed before a revision uses it.
+	pruneGrace = 10 * time.Minute
+
+	// manifestExtension is appended to the path of an image for the manifest
+	// it was stored with. An image tarball does not retain its manifest, so
+	// an image read back from it may otherwise have a different digest, e.g.
+	// if it was an OCI image.
+	manifestExtension = ".manifest"
 )
 
 // A Cache caches OCI images.
@@ -37,28 +71,164 @@ type Cache interface {
 	Get(tag string, id string) (v1.Image, error)
 	Store(tag string, id string, img v1.Image) error
 	Delete(id string) error
+
+	// Prune deletes all entries whose id is not kept, and all images that are
+	// no longer referred to by an entry.
+	Prune(keep func(id string) bool) error
+}
+
+// A corruptImageError is returned when an image read from the cache does not
+// match the digests it was stored with.
+type corruptImageError struct {
+	id  string
+	err error
+}
+
+func (e *corruptImageError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", errCorrupt, e.id, e.err)
+}
+
+func (e *corruptImageError) Unwrap() error {
+	return e.err
+}
+
+// IsCorrupt returns true if the supplied error indicates that a cached image
+// was corrupt.
+func IsCorrupt(err error) bool {
+	var cie *corruptImageError
+	return errors.As(err, &cie)
+}
+
+// ImageCacheOption configures an ImageCache.
+type ImageCacheOption func(*ImageCache)
+
+// WithMaxSize bounds the total size of the images in the ImageCache. The
+// least recently used images are evicted when the bound is exceeded. A
+// non-positive size does not bound the cache.
+func WithMaxSize(bytes int64) ImageCacheOption {
+	return func(c *ImageCache) {
+		c.maxSize = bytes
+	}
 }
 
 // ImageCache stores and retrieves OCI images in a filesystem-backed cache in a
-// thread-safe manner.
+// thread-safe manner. Images are stored once per digest, such that entries
+// that refer to the same image share it.
 type ImageCache struct {
-	dir string
-	fs  afero.Fs
-	mu  sync.RWMutex
+	dir     string
+	fs      afero.Fs
+	mu      sync.RWMutex
+	maxSize int64
 }
 
 // NewImageCache creates a new ImageCache.
-func NewImageCache(dir string, fs afero.Fs) *ImageCache {
-	return &ImageCache{
+func NewImageCache(dir string, fs afero.Fs, o ...ImageCacheOption) *ImageCache {
+	c := &ImageCache{
 		dir: dir,
 		fs:  fs,
 	}
+	for _, fn := range o {
+		fn(c)
+	}
+	return c
 }
 
-// Get retrieves an image from the ImageCache.
+// Get retrieves an image from the ImageCache. Images that were placed in the
+// cache directory under their id rather than stored, such as pre-cached
+// packages, are retrieved as well. The digests of the image are verified on
+// every read, and a stored image must have the digest its entry refers to; an
+// image that does not match them is evicted and an error for which IsCorrupt
+// returns true is returned, such that the caller may fetch it again.
 func (c *ImageCache) Get(tag, id string) (v1.Image, error) {
 	c.mu.RLock()
-	defer c.mu.RUnlock()
+	img, err := c.get(tag, id)
+	c.mu.RUnlock()
+	recordLookup(err == nil)
+	if err == nil {
+		return img, nil
+	}
+	if IsCorrupt(err) {
+		corruptImages.Inc()
+		if eerr := c.evictImage(id); eerr != nil {
+			return nil, errors.Wrap(eerr, err.Error())
+		}
+	}
+	return nil, err
+}
+
+// evictImage removes the image the entry with the supplied id refers to, and
+// every entry that refers to it. Pre-cached images cannot be fetched again, so
+// they are left in place for an operator to replace.
+func (c *ImageCache) evictImage(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, err := afero.ReadFile(c.fs, c.refPath(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, errReadRef)
+	}
+	digest := strings.TrimSpace(string(d))
+	if err := c.removeBlob(digest); err != nil {
+		return err
+	}
+	refs, err := c.refs()
+	if err != nil {
+		return err
+	}
+	for id, d := range refs {
+		if d != digest {
+			continue
+		}
+		if err := c.fs.Remove(c.refPath(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return c.updateSize()
+}
+
+func (c *ImageCache) get(tag, id string) (v1.Image, error) {
+	d, err := afero.ReadFile(c.fs, c.refPath(id))
+	if os.IsNotExist(err) {
+		return c.getPreCached(tag, id)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, errReadRef)
+	}
+	digest := strings.TrimSpace(string(d))
+	path := c.blobPath(digest)
+	if _, err := c.fs.Stat(path); err != nil {
+		return nil, err
+	}
+	// The modification time of an image records when it was last used.
+	now := time.Now()
+	_ = c.fs.Chtimes(path, now, now)
+	img, err := tarball.Image(fsOpener(path, c.fs), nil)
+	if err != nil {
+		return nil, &corruptImageError{id: id, err: err}
+	}
+	// Images stored without their manifest are read back as written.
+	if raw, err := afero.ReadFile(c.fs, path+manifestExtension); err == nil {
+		if img, err = withManifest(img, raw); err != nil {
+			return nil, &corruptImageError{id: id, err: err}
+		}
+	}
+	// The image must be the one its entry refers to, not merely a valid one.
+	h, err := img.Digest()
+	if err != nil {
+		return nil, &corruptImageError{id: id, err: err}
+	}
+	if h.Hex != digest {
+		return nil, &corruptImageError{id: id, err: errors.Errorf(errDigestFmt, h.Hex, digest)}
+	}
+	if err := validate.Image(img); err != nil {
+		return nil, &corruptImageError{id: id, err: err}
+	}
+	return img, nil
+}
+
+func (c *ImageCache) getPreCached(tag, id string) (v1.Image, error) {
 	var t *name.Tag
 	if tag != "" {
 		nt, err := name.NewTag(tag)
@@ -67,36 +237,298 @@ func (c *ImageCache) Get(tag, id string) (v1.Image, error) {
 		}
 		t = &nt
 	}
-	return tarball.Image(fsOpener(BuildPath(c.dir, id), c.fs), t)
+	path := BuildPath(c.dir, id)
+	if _, err := c.fs.Stat(path); err != nil {
+		return nil, err
+	}
+	return verifiedImage(id, fsOpener(path, c.fs), t)
 }
 
-// Store saves an image to the ImageCache.
+// verifiedImage opens an image and checks that its config and layers match the
+// digests recorded in its manifest and config.
+func verifiedImage(id string, o tarball.Opener, t *name.Tag) (v1.Image, error) {
+	img, err := tarball.Image(o, t)
+	if err != nil {
+		return nil, &corruptImageError{id: id, err: err}
+	}
+	if err := validate.Image(img); err != nil {
+		return nil, &corruptImageError{id: id, err: err}
+	}
+	return img, nil
+}
+
+// Store saves an image to the ImageCache. The image is only written if no
+// other entry refers to an image with the same digest.
 func (c *ImageCache) Store(tag, id string, img v1.Image) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	ref, err := name.ParseReference(tag)
+	d, err := img.Digest()
 	if err != nil {
+		return errors.Wrap(err, errImageDigest)
+	}
+	path := c.blobPath(d.Hex)
+	if _, err := c.fs.Stat(path); os.IsNotExist(err) {
+		raw, err := img.RawManifest()
+		if err != nil {
+			return err
+		}
+		// The manifest is written first, such that an image is never read
+		// without it.
+		if err := c.fs.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := afero.WriteFile(c.fs, path+manifestExtension, raw, 0o644); err != nil {
+			return err
+		}
+		if err := c.writeBlob(path, img); err != nil {
+			return err
+		}
+	}
+	if err := c.fs.MkdirAll(filepath.Join(c.dir, refsDir), 0o755); err != nil {
+		return err
+	}
+	if err := afero.WriteFile(c.fs, c.refPath(id), []byte(d.Hex), 0o644); err != nil {
+		return err
+	}
+	return c.evict(d.Hex)
+}
+
+// Import places an image in the ImageCache under the supplied id, such that a
+// package whose source is the id and whose PackagePullPolicy is Never is read
+// from it. Unlike pre-cached packages, imported images count towards the size
+// of the cache and are pruned once no entry that is kept refers to them.
+func (c *ImageCache) Import(id string, img v1.Image) error {
+	return c.Store("", id, img)
+}
+
+func (c *ImageCache) writeBlob(path string, img v1.Image) error {
+	if err := c.fs.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
-	cf, err := c.fs.Create(BuildPath(c.dir, id))
+	// Write to a temporary file first so that a partially written image is
+	// never read.
+	tmp := path + tempExtension
+	cf, err := c.fs.Create(tmp)
 	if err != nil {
 		return err
 	}
-	if err := tarball.Write(ref, img, cf); err != nil {
+	if err := tarball.Write(nil, img, cf); err != nil {
+		_ = cf.Close()
+		_ = c.fs.Remove(tmp)
+		return err
+	}
+	if err := cf.Close(); err != nil {
 		return err
 	}
-	return cf.Close()
+	return c.fs.Rename(tmp, path)
 }
 
-// Delete removes an image from the ImageCache.
+// Delete removes an image from the ImageCache. The image itself is only
+// removed once no other entry refers to it.
 func (c *ImageCache) Delete(id string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	err := c.fs.Remove(BuildPath(c.dir, id))
+	err := c.fs.Remove(c.refPath(id))
 	if os.IsNotExist(err) {
 		return nil
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	return c.prune(func(string) bool { return true })
+}
+
+// Prune deletes all entries whose id is not kept and that were written more
+// than a grace period ago, and all images that are no longer referred to by an
+// entry. Pre-cached images are never pruned.
+func (c *ImageCache) Prune(keep func(id string) bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.prune(keep)
+}
+
+func (c *ImageCache) prune(keep func(id string) bool) error {
+	refs, err := c.refs()
+	if err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for id, d := range refs {
+		if keep(id) || c.recent(id) {
+			used[d] = true
+			continue
+		}
+		if err := c.fs.Remove(c.refPath(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	blobs, err := c.blobs()
+	if err != nil {
+		return err
+	}
+	for _, b := range blobs {
+		if used[b.digest] {
+			continue
+		}
+		if err := c.removeBlob(b.digest); err != nil {
+			return err
+		}
+	}
+	if err := c.removeTemp(); err != nil {
+		return err
+	}
+	return c.updateSize()
+}
+
+// recent returns true if the entry with the supplied id was written less than
+// pruneGrace ago.
+func (c *ImageCache) recent(id string) bool {
+	fi, err := c.fs.Stat(c.refPath(id))
+	return err == nil && time.Since(fi.ModTime()) < pruneGrace
+}
+
+// removeTemp removes images that were never completely written, e.g. because
+// the process was killed while storing them.
+func (c *ImageCache) removeTemp() error {
+	infos, err := afero.ReadDir(c.fs, filepath.Join(c.dir, blobsDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != tempExtension {
+			continue
+		}
+		if err := c.fs.Remove(filepath.Join(c.dir, blobsDir, fi.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// evict removes the least recently used images until the cache fits its
+// maximum size, never evicting the image with the supplied digest. Entries
+// that referred to an evicted image are removed as well.
+func (c *ImageCache) evict(current string) error {
+	blobs, err := c.blobs()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, b := range blobs {
+		total += b.size
+	}
+	if c.maxSize > 0 && total > c.maxSize {
+		sort.Slice(blobs, func(i, j int) bool { return blobs[i].used.Before(blobs[j].used) })
+		evicted := map[string]bool{}
+		for _, b := range blobs {
+			if total <= c.maxSize {
+				break
+			}
+			if b.digest == current {
+				continue
+			}
+			if err := c.removeBlob(b.digest); err != nil {
+				return err
+			}
+			evicted[b.digest] = true
+			total -= b.size
+		}
+		refs, err := c.refs()
+		if err != nil {
+			return err
+		}
+		for id, d := range refs {
+			if evicted[d] {
+				_ = c.fs.Remove(c.refPath(id))
+			}
+		}
+	}
+	cacheSize.Set(float64(total))
+	return nil
+}
+
+func (c *ImageCache) updateSize() error {
+	blobs, err := c.blobs()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, b := range blobs {
+		total += b.size
+	}
+	cacheSize.Set(float64(total))
+	return nil
+}
+
+type blob struct {
+	digest string
+	size   int64
+	used   time.Time
+}
+
+func (c *ImageCache) blobs() ([]blob, error) {
+	infos, err := afero.ReadDir(c.fs, filepath.Join(c.dir, blobsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	blobs := make([]blob, 0, len(infos))
+	for _, fi := range infos {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != NddpkgExtension {
+			continue
+		}
+		blobs = append(blobs, blob{
+			digest: strings.TrimSuffix(fi.Name(), NddpkgExtension),
+			size:   fi.Size(),
+			used:   fi.ModTime(),
+		})
+	}
+	return blobs, nil
+}
+
+func (c *ImageCache) refs() (map[string]string, error) {
+	infos, err := afero.ReadDir(c.fs, filepath.Join(c.dir, refsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]string, len(infos))
+	for _, fi := range infos {
+		if fi.IsDir() {
+			continue
+		}
+		d, err := afero.ReadFile(c.fs, filepath.Join(c.dir, refsDir, fi.Name()))
+		if err != nil {
+			return nil, errors.Wrap(err, errReadRef)
+		}
+		refs[fi.Name()] = strings.TrimSpace(string(d))
+	}
+	return refs, nil
+}
+
+// removeBlob removes the image with the supplied digest and its manifest.
+func (c *ImageCache) removeBlob(digest string) error {
+	for _, path := range []string{c.blobPath(digest), c.blobPath(digest) + manifestExtension} {
+		if err := c.fs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ImageCache) blobPath(digest string) string {
+	return BuildPath(filepath.Join(c.dir, blobsDir), digest)
+}
+
+func (c *ImageCache) refPath(id string) string {
+	return filepath.Join(c.dir, refsDir, id)
 }
 
 func fsOpener(path string, fs afero.Fs) tarball.Opener {
@@ -105,6 +537,91 @@ func fsOpener(path string, fs afero.Fs) tarball.Opener {
 	}
 }
 
+// A manifestImage is an image read from a tarball with the manifest it was
+// stored with, such that it has the digest and media types it had before it
+// was stored.
+type manifestImage struct {
+	v1.Image
+	raw      []byte
+	manifest *v1.Manifest
+}
+
+func withManifest(img v1.Image, raw []byte) (v1.Image, error) {
+	m, err := v1.ParseManifest(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	return &manifestImage{Image: img, raw: raw, manifest: m}, nil
+}
+
+// MediaType of the stored manifest.
+func (i *manifestImage) MediaType() (types.MediaType, error) {
+	return i.manifest.MediaType, nil
+}
+
+// Size of the stored manifest.
+func (i *manifestImage) Size() (int64, error) {
+	return int64(len(i.raw)), nil
+}
+
+// Digest of the stored manifest.
+func (i *manifestImage) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(i.raw))
+	return h, err
+}
+
+// Manifest returns the stored manifest.
+func (i *manifestImage) Manifest() (*v1.Manifest, error) {
+	return i.manifest.DeepCopy(), nil
+}
+
+// RawManifest returns the stored manifest.
+func (i *manifestImage) RawManifest() ([]byte, error) {
+	return i.raw, nil
+}
+
+// Layers returns the layers of the image with the media types of the stored
+// manifest.
+func (i *manifestImage) Layers() ([]v1.Layer, error) {
+	ls, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	if len(ls) != len(i.manifest.Layers) {
+		return nil, errors.New(errLayerCount)
+	}
+	out := make([]v1.Layer, len(ls))
+	for n, l := range ls {
+		out[n] = &mediaTypeLayer{Layer: l, mediaType: i.manifest.Layers[n].MediaType}
+	}
+	return out, nil
+}
+
+// LayerByDigest returns the layer with the supplied digest with the media type
+// of the stored manifest.
+func (i *manifestImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	l, err := i.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range i.manifest.Layers {
+		if d.Digest == h {
+			return &mediaTypeLayer{Layer: l, mediaType: d.MediaType}, nil
+		}
+	}
+	return l, nil
+}
+
+type mediaTypeLayer struct {
+	v1.Layer
+	mediaType types.MediaType
+}
+
+// MediaType of the layer in the stored manifest.
+func (l *mediaTypeLayer) MediaType() (types.MediaType, error) {
+	return l.mediaType, nil
+}
+
 // NopCache is a cache implementation that does not store anything and always
 // returns an error on get.
 type NopCache struct{}
@@ -128,3 +645,8 @@ func (c *NopCache) Store(tag, id string, img v1.Image) error {
 func (c *NopCache) Delete(id string) error {
 	return nil
 }
+
+// Prune does nothing on a NopCache.
+func (c *NopCache) Prune(keep func(id string) bool) error {
+	return nil
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/spf13/afero"
+)
+
+func ociImage(t *testing.T) v1.Image {
+	t.Helper()
+	img := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+	l, err := random.Layer(64, types.OCILayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err = mutate.AppendLayers(img, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func dockerImage(t *testing.T) v1.Image {
+	t.Helper()
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func digest(t *testing.T, img v1.Image) v1.Hash {
+	t.Helper()
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestImageCacheGet(t *testing.T) {
+	cases := map[string]struct {
+		reason  string
+		img     func(t *testing.T) v1.Image
+		prepare func(t *testing.T, c *ImageCache, fs afero.Fs, img v1.Image)
+		corrupt bool
+	}{
+		"Docker": {
+			reason: "A stored Docker image should be read back with its digest.",
+			img:    dockerImage,
+		},
+		"OCI": {
+			reason: "A stored OCI image should be read back with the digest it had before it was stored.",
+			img:    ociImage,
+		},
+		"WrongBlob": {
+			reason: "An entry that refers to a valid image with a different digest should be corrupt.",
+			img:    ociImage,
+			prepare: func(t *testing.T, c *ImageCache, fs afero.Fs, img v1.Image) {
+				other := dockerImage(t)
+				if err := c.Store("", "other", other); err != nil {
+					t.Fatal(err)
+				}
+				h := digest(t, img)
+				o := digest(t, other)
+				for _, ext := range []string{"", manifestExtension} {
+					b, err := afero.ReadFile(fs, c.blobPath(o.Hex)+ext)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := afero.WriteFile(fs, c.blobPath(h.Hex)+ext, b, 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			corrupt: true,
+		},
+		"MissingManifest": {
+			reason: "An OCI image stored without its manifest does not have the digest of its entry and should be corrupt.",
+			img:    ociImage,
+			prepare: func(t *testing.T, c *ImageCache, fs afero.Fs, img v1.Image) {
+				if err := fs.Remove(c.blobPath(digest(t, img).Hex) + manifestExtension); err != nil {
+					t.Fatal(err)
+				}
+			},
+			corrupt: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			c := NewImageCache("/cache", fs)
+			img := tc.img(t)
+			if err := c.Store("", "id", img); err != nil {
+				t.Fatal(err)
+			}
+			if tc.prepare != nil {
+				tc.prepare(t, c, fs, img)
+			}
+
+			got, err := c.Get("", "id")
+			if tc.corrupt {
+				if !IsCorrupt(err) {
+					t.Errorf("\n%s\nGet(...): want corrupt error, got %v", tc.reason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("\n%s\nGet(...): %v", tc.reason, err)
+			}
+			if want, got := digest(t, img), digest(t, got); want != got {
+				t.Errorf("\n%s\nGet(...): want digest %s, got %s", tc.reason, want, got)
+			}
+		})
+	}
+}
+
+func TestImageCacheImport(t *testing.T) {
+	old := time.Now().Add(-2 * pruneGrace)
+
+	cases := map[string]struct {
+		reason  string
+		prepare func(t *testing.T, c *ImageCache, fs afero.Fs)
+		keep    bool
+		want    bool
+	}{
+		"Recent": {
+			reason: "A recently imported image should not be pruned, such that it can be installed.",
+			want:   true,
+		},
+		"InUse": {
+			reason: "An imported image that is kept should not be pruned.",
+			prepare: func(t *testing.T, c *ImageCache, fs afero.Fs) {
+				if err := fs.Chtimes(c.refPath("imported"), old, old); err != nil {
+					t.Fatal(err)
+				}
+			},
+			keep: true,
+			want: true,
+		},
+		"Unused": {
+			reason: "An imported image that is not kept should be pruned once its grace period passed.",
+			prepare: func(t *testing.T, c *ImageCache, fs afero.Fs) {
+				if err := fs.Chtimes(c.refPath("imported"), old, old); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			c := NewImageCache("/cache", fs)
+			if err := c.Import("imported", dockerImage(t)); err != nil {
+				t.Fatal(err)
+			}
+			if tc.prepare != nil {
+				tc.prepare(t, c, fs)
+			}
+			if err := c.Prune(func(string) bool { return tc.keep }); err != nil {
+				t.Fatal(err)
+			}
+			_, err := c.Get("", "imported")
+			if got := err == nil; got != tc.want {
+				t.Errorf("\n%s\nGet(...): error %v, want image %t", tc.reason, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestImageCacheImportSize(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	c := NewImageCache("/cache", fs)
+	if err := c.Import("imported", dockerImage(t)); err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := c.blobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 1 {
+		t.Fatalf("Import(...): imported images should count towards the size of the cache: got %d images, want 1", len(blobs))
+	}
+
+	// Bound the cache to the imported image, such that storing another image
+	// evicts it.
+	c.maxSize = blobs[0].size
+	if err := c.Store("", "stored", dockerImage(t)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("", "imported"); err == nil {
+		t.Errorf("Store(...): an imported image should be evicted like any other image when the cache exceeds its size")
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// ParseSourceConstraint splits a package source whose identifier is a semantic
+// version constraint rather than a tag or digest, e.g.
+// registry/provider:~1.4, into its repository and constraint. The returned
+// bool is false if the source does not carry a version constraint.
+func ParseSourceConstraint(source string) (string, *semver.Constraints, bool) {
+	if strings.Contains(source, "@") {
+		return "", nil, false
+	}
+	i := strings.LastIndex(source, ":")
+	if i < 0 || strings.Contains(source[i:], "/") {
+		return "", nil, false
+	}
+	// A valid tag is always used as is, even if it could also be read as a
+	// version constraint.
+	if _, err := name.NewTag(source); err == nil {
+		return "", nil, false
+	}
+	c, err := semver.NewConstraint(source[i+1:])
+	if err != nil {
+		return "", nil, false
+	}
+	return source[:i], c, true
+}
+
+// ParseConstraint parses a semantic version constraint of a package
+// dependency. An empty constraint is satisfied by every version.
+func ParseConstraint(s string) (*semver.Constraints, error) {
+	if s == "" {
+		s = "*"
+	}
+	return semver.NewConstraint(s)
+}
+
+// LatestVersion returns the highest tag that is a valid semantic version and
+// satisfies the supplied constraint, or an empty string if there is none.
+func LatestVersion(tags []string, c *semver.Constraints) string {
+	vs := []*semver.Version{}
+	for _, t := range tags {
+		v, err := semver.NewVersion(t)
+		if err != nil {
+			// We skip any tags that are not valid semantic versions.
+			continue
+		}
+		vs = append(vs, v)
+	}
+
+	sort.Sort(semver.Collection(vs))
+	var latest string
+	for _, v := range vs {
+		if c.Check(v) {
+			latest = v.Original()
+		}
+	}
+	return latest
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver"
+)
+
+func TestParseSourceConstraint(t *testing.T) {
+	cases := map[string]struct {
+		reason   string
+		source   string
+		wantRepo string
+		// matches and rejects are versions the constraint should and
+		// should not be satisfied by.
+		matches string
+		rejects string
+		wantOK  bool
+	}{
+		"Tilde": {
+			reason:   "A tilde constraint should be split from its repository.",
+			source:   "registry.lab/yndd/nddp-srl:~0.1",
+			wantRepo: "registry.lab/yndd/nddp-srl",
+			matches:  "v0.1.5",
+			rejects:  "v0.2.0",
+			wantOK:   true,
+		},
+		"Range": {
+			reason:   "A range constraint should be split from its repository.",
+			source:   "yndd/nddp-srl:>=0.1.0, <0.3.0",
+			wantRepo: "yndd/nddp-srl",
+			matches:  "v0.2.0",
+			rejects:  "v0.3.0",
+			wantOK:   true,
+		},
+		"RegistryPort": {
+			reason:   "The port of a registry should not be mistaken for a constraint.",
+			source:   "registry.lab:5000/yndd/nddp-srl:^0.1",
+			wantRepo: "registry.lab:5000/yndd/nddp-srl",
+			matches:  "v0.1.2",
+			rejects:  "v1.0.0",
+			wantOK:   true,
+		},
+		"Tag": {
+			reason: "A valid tag should be used as is, even if it could be read as a version constraint.",
+			source: "registry.lab/yndd/nddp-srl:v0.1.0",
+		},
+		"NoIdentifier": {
+			reason: "A source without a tag or constraint does not carry a constraint.",
+			source: "registry.lab:5000/yndd/nddp-srl",
+		},
+		"Digest": {
+			reason: "A source with a digest does not carry a constraint.",
+			source: "registry.lab/yndd/nddp-srl@sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+		},
+		"URL": {
+			reason: "A URL source does not carry a constraint.",
+			source: "https://packages.lab/nddp-srl.nddpkg",
+		},
+		"Invalid": {
+			reason: "An identifier that is neither a tag nor a constraint does not carry a constraint.",
+			source: "registry.lab/yndd/nddp-srl:~~",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			repo, c, ok := ParseSourceConstraint(tc.source)
+			if ok != tc.wantOK {
+				t.Fatalf("\n%s\nParseSourceConstraint(...): got ok %t, want %t", tc.reason, ok, tc.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if repo != tc.wantRepo {
+				t.Errorf("\n%s\nParseSourceConstraint(...): got repository %q, want %q", tc.reason, repo, tc.wantRepo)
+			}
+			if !c.Check(semver.MustParse(tc.matches)) {
+				t.Errorf("\n%s\nParseSourceConstraint(...): constraint is not satisfied by %s", tc.reason, tc.matches)
+			}
+			if c.Check(semver.MustParse(tc.rejects)) {
+				t.Errorf("\n%s\nParseSourceConstraint(...): constraint is satisfied by %s", tc.reason, tc.rejects)
+			}
+		})
+	}
+}
+
+func TestParseConstraint(t *testing.T) {
+	cases := map[string]struct {
+		reason  string
+		s       string
+		version string
+		want    bool
+		wantErr bool
+	}{
+		"Empty": {
+			reason:  "An empty constraint should be satisfied by every version.",
+			version: "v9.9.9",
+			want:    true,
+		},
+		"Satisfied": {
+			reason:  "A version within the constraint should satisfy it.",
+			s:       ">=v0.1.0",
+			version: "v0.2.0",
+			want:    true,
+		},
+		"Unsatisfied": {
+			reason:  "A version outside the constraint should not satisfy it.",
+			s:       "~0.1",
+			version: "v0.2.0",
+		},
+		"Invalid": {
+			reason:  "A constraint that cannot be parsed should return an error.",
+			s:       "~~",
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c, err := ParseConstraint(tc.s)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("\n%s\nParseConstraint(...): error %v, want error %t", tc.reason, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := c.Check(semver.MustParse(tc.version)); got != tc.want {
+				t.Errorf("\n%s\nParseConstraint(...): %s satisfies the constraint: got %t, want %t", tc.reason, tc.version, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		tags   []string
+		c      string
+		want   string
+	}{
+		"Highest": {
+			reason: "The highest matching version should be returned, whatever the order of the tags.",
+			tags:   []string{"v0.1.1", "v0.1.10", "v0.1.2"},
+			c:      "~0.1",
+			want:   "v0.1.10",
+		},
+		"Constrained": {
+			reason: "Versions that do not satisfy the constraint should be ignored.",
+			tags:   []string{"v0.1.0", "v0.1.1", "v0.2.0"},
+			c:      "~0.1",
+			want:   "v0.1.1",
+		},
+		"OriginalTag": {
+			reason: "The tag should be returned as written rather than normalised.",
+			tags:   []string{"0.1.0", "v0.0.9"},
+			c:      ">=0.0.1",
+			want:   "0.1.0",
+		},
+		"NotSemver": {
+			reason: "Tags that are not semantic versions should be ignored.",
+			tags:   []string{"latest", "main", "v0.1.0"},
+			c:      "*",
+			want:   "v0.1.0",
+		},
+		"Prerelease": {
+			reason: "A prerelease should not satisfy a constraint without a prerelease.",
+			tags:   []string{"v0.1.0", "v0.2.0-rc.1"},
+			c:      ">=0.1.0",
+			want:   "v0.1.0",
+		},
+		"None": {
+			reason: "An empty string should be returned if no tag satisfies the constraint.",
+			tags:   []string{"v0.1.0", "latest"},
+			c:      ">=1.0.0",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c, err := ParseConstraint(tc.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := LatestVersion(tc.tags, c); got != tc.want {
+				t.Errorf("\n%s\nLatestVersion(...): got %q, want %q", tc.reason, got, tc.want)
+			}
+		})
+	}
+}
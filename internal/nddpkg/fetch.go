@@ -19,6 +19,7 @@ package nddpkg
 import (
 	"context"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/authn/k8schain"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -34,54 +35,85 @@ type Fetcher interface {
 	Tags(ctx context.Context, ref name.Reference, secrets ...string) ([]string, error)
 }
 
+// K8sFetcherOption configures a K8sFetcher.
+type K8sFetcherOption func(*K8sFetcher)
+
+// WithRegistryTransport specifies how the K8sFetcher should connect to
+// registries, e.g. to trust extra CA bundles or reach insecure registries.
+func WithRegistryTransport(t *RegistryTransport) K8sFetcherOption {
+	return func(i *K8sFetcher) {
+		i.transport = t
+	}
+}
+
 // K8sFetcher uses kubernetes credentials to fetch package images.
 type K8sFetcher struct {
 	client    kubernetes.Interface
 	namespace string
+	transport *RegistryTransport
 }
 
 // NewK8sFetcher creates a new K8sFetcher.
-func NewK8sFetcher(client kubernetes.Interface, namespace string) *K8sFetcher {
-	return &K8sFetcher{
+func NewK8sFetcher(client kubernetes.Interface, namespace string, o ...K8sFetcherOption) *K8sFetcher {
+	i := &K8sFetcher{
 		client:    client,
 		namespace: namespace,
 	}
+	for _, fn := range o {
+		fn(i)
+	}
+	return i
 }
 
 // Fetch fetches a package image.
 func (i *K8sFetcher) Fetch(ctx context.Context, ref name.Reference, secrets ...string) (v1.Image, error) {
-	auth, err := k8schain.New(ctx, i.client, k8schain.Options{
-		Namespace:        i.namespace,
-		ImagePullSecrets: secrets,
-	})
+	ref, opts, err := i.remote(ctx, ref, secrets)
 	if err != nil {
 		return nil, err
 	}
-	return remote.Image(ref, remote.WithAuthFromKeychain(auth), remote.WithContext(ctx))
+	return remote.Image(ref, opts...)
 }
 
 // Head fetches a package descriptor.
 func (i *K8sFetcher) Head(ctx context.Context, ref name.Reference, secrets ...string) (*v1.Descriptor, error) {
-	auth, err := k8schain.New(ctx, i.client, k8schain.Options{
-		Namespace:        i.namespace,
-		ImagePullSecrets: secrets,
-	})
+	ref, opts, err := i.remote(ctx, ref, secrets)
 	if err != nil {
 		return nil, err
 	}
-	return remote.Head(ref, remote.WithAuthFromKeychain(auth), remote.WithContext(ctx))
+	return remote.Head(ref, opts...)
 }
 
 // Tags fetches a package's tags.
 func (i *K8sFetcher) Tags(ctx context.Context, ref name.Reference, secrets ...string) ([]string, error) {
+	ref, opts, err := i.remote(ctx, ref, secrets)
+	if err != nil {
+		return nil, err
+	}
+	return remote.List(ref.Context(), opts...)
+}
+
+// remote returns the reference and options every remote call of the
+// K8sFetcher uses, authenticating with the supplied pull secrets.
+func (i *K8sFetcher) remote(ctx context.Context, ref name.Reference, secrets []string) (name.Reference, []remote.Option, error) {
 	auth, err := k8schain.New(ctx, i.client, k8schain.Options{
 		Namespace:        i.namespace,
 		ImagePullSecrets: secrets,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	ref, err = i.transport.Reference(ref)
+	if err != nil {
+		return nil, nil, err
 	}
-	return remote.List(ref.Context(), remote.WithAuthFromKeychain(auth), remote.WithContext(ctx))
+	return ref, RemoteOptions(ctx, auth, i.transport), nil
+}
+
+// RemoteOptions returns the options of a remote call that authenticates using
+// the supplied keychain and connects using the supplied RegistryTransport, if
+// any.
+func RemoteOptions(ctx context.Context, auth authn.Keychain, t *RegistryTransport) []remote.Option {
+	return append([]remote.Option{remote.WithAuthFromKeychain(auth), remote.WithContext(ctx)}, t.Options()...)
 }
 
 // NopFetcher always returns an empty image and never returns error.
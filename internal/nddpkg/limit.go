@@ -0,0 +1,386 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultRegistryQPS is the default sustained rate of calls per registry.
+	DefaultRegistryQPS = 5
+
+	// DefaultRegistryBurst is the default number of calls per registry that
+	// may exceed the sustained rate.
+	DefaultRegistryBurst = 10
+
+	// DefaultMaxRetries is the default number of times a call that failed
+	// with a retryable error is retried.
+	DefaultMaxRetries = 4
+
+	defaultInitialBackoff = 1 * time.Second
+	defaultMaxBackoff     = 1 * time.Minute
+	defaultSharedTimeout  = 5 * time.Minute
+
+	opFetch = "fetch"
+	opHead  = "head"
+	opTags  = "tags"
+)
+
+// LimitingFetcherOption configures a LimitingFetcher.
+type LimitingFetcherOption func(*LimitingFetcher)
+
+// WithRateLimit limits the calls to each registry to the supplied sustained
+// rate per second, allowing bursts of the supplied size but at least one call.
+// A non-positive rate does not limit calls.
+func WithRateLimit(qps float64, burst int) LimitingFetcherOption {
+	return func(f *LimitingFetcher) {
+		f.limit = rate.Limit(qps)
+		if qps <= 0 {
+			f.limit = rate.Inf
+		}
+		f.burst = burst
+		if burst < 1 {
+			f.burst = 1
+		}
+	}
+}
+
+// WithMaxRetries sets how often a call that failed with a retryable error is
+// retried.
+func WithMaxRetries(n int) LimitingFetcherOption {
+	return func(f *LimitingFetcher) {
+		f.maxRetries = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry, which doubles with every
+// further retry up to the supplied maximum.
+func WithBackoff(initial, max time.Duration) LimitingFetcherOption {
+	return func(f *LimitingFetcher) {
+		f.initialBackoff = initial
+		f.maxBackoff = max
+	}
+}
+
+// WithSharedTimeout sets how long a Head or Tags call shared by concurrent
+// callers may take, including its retries. Shared calls do not run under the
+// context of any caller, such that a caller that gives up does not fail the
+// others.
+func WithSharedTimeout(d time.Duration) LimitingFetcherOption {
+	return func(f *LimitingFetcher) {
+		f.sharedTimeout = d
+	}
+}
+
+// A LimitingFetcher protects registries from the Fetcher it wraps. Calls are
+// limited per registry by a token bucket, calls that fail because a registry
+// is unavailable or throttling are retried with exponential backoff, and
+// concurrent identical Head and Tags calls are made only once. A Retry-After
+// duration reported by a registry through a RegistryTransport delays all
+// calls to that registry.
+type LimitingFetcher struct {
+	fetcher Fetcher
+	group   singleflight.Group
+
+	limit          rate.Limit
+	burst          int
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	sharedTimeout  time.Duration
+
+	mu         sync.Mutex
+	registries map[string]*registryLimiter
+}
+
+type registryLimiter struct {
+	limiter *rate.Limiter
+
+	// notBefore is the time before which no call may be made to the
+	// registry, because it asked to retry after it.
+	notBefore time.Time
+}
+
+// NewLimitingFetcher returns a LimitingFetcher that wraps the supplied
+// Fetcher.
+func NewLimitingFetcher(f Fetcher, o ...LimitingFetcherOption) *LimitingFetcher {
+	lf := &LimitingFetcher{
+		fetcher:        f,
+		limit:          DefaultRegistryQPS,
+		burst:          DefaultRegistryBurst,
+		maxRetries:     DefaultMaxRetries,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		sharedTimeout:  defaultSharedTimeout,
+		registries:     map[string]*registryLimiter{},
+	}
+	for _, fn := range o {
+		fn(lf)
+	}
+	return lf
+}
+
+// Fetch fetches a package image.
+func (f *LimitingFetcher) Fetch(ctx context.Context, ref name.Reference, secrets ...string) (v1.Image, error) {
+	var img v1.Image
+	err := f.do(ctx, ref.Context().RegistryStr(), opFetch, func(ctx context.Context) error {
+		var err error
+		img, err = f.fetcher.Fetch(ctx, ref, secrets...)
+		return err
+	})
+	return img, err
+}
+
+// Head fetches a package descriptor. Concurrent calls for the same reference
+// and secrets share a single call.
+func (f *LimitingFetcher) Head(ctx context.Context, ref name.Reference, secrets ...string) (*v1.Descriptor, error) {
+	reg := ref.Context().RegistryStr()
+	v, err := f.shared(ctx, dedupKey(opHead, ref.Name(), secrets), reg, opHead, func(ctx context.Context) (interface{}, error) {
+		var d *v1.Descriptor
+		err := f.do(ctx, reg, opHead, func(ctx context.Context) error {
+			var err error
+			d, err = f.fetcher.Head(ctx, ref, secrets...)
+			return err
+		})
+		return d, err
+	})
+	d, _ := v.(*v1.Descriptor)
+	if err != nil || d == nil {
+		return d, err
+	}
+	// Callers must not share a descriptor they may modify.
+	c := *d
+	return &c, nil
+}
+
+// Tags fetches a package's tags. Concurrent calls for the same repository and
+// secrets share a single call.
+func (f *LimitingFetcher) Tags(ctx context.Context, ref name.Reference, secrets ...string) ([]string, error) {
+	reg := ref.Context().RegistryStr()
+	v, err := f.shared(ctx, dedupKey(opTags, ref.Context().Name(), secrets), reg, opTags, func(ctx context.Context) (interface{}, error) {
+		var tags []string
+		err := f.do(ctx, reg, opTags, func(ctx context.Context) error {
+			var err error
+			tags, err = f.fetcher.Tags(ctx, ref, secrets...)
+			return err
+		})
+		return tags, err
+	})
+	tags, _ := v.([]string)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), tags...), nil
+}
+
+// shared calls fn once for concurrent calls with the same key. The call runs
+// under its own context with the shared timeout rather than under the context
+// of the caller that happened to start it, and every caller stops waiting for
+// it once its own context is done.
+func (f *LimitingFetcher) shared(ctx context.Context, key, reg, op string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	ch := f.group.DoChan(key, func() (interface{}, error) {
+		sctx, cancel := context.WithTimeout(context.Background(), f.sharedTimeout)
+		defer cancel()
+		return fn(sctx)
+	})
+	select {
+	case r := <-ch:
+		if r.Shared {
+			registryDeduplicated.WithLabelValues(reg, op).Inc()
+		}
+		return r.Val, r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func dedupKey(op, ref string, secrets []string) string {
+	return op + "\x00" + ref + "\x00" + strings.Join(secrets, ",")
+}
+
+// do calls fn, waiting for the rate limit of the registry before every
+// attempt and retrying retryable errors with exponential backoff.
+func (f *LimitingFetcher) do(ctx context.Context, reg, op string, fn func(ctx context.Context) error) error {
+	backoff := f.initialBackoff
+	for attempt := 0; ; attempt++ {
+		if err := f.wait(ctx, reg); err != nil {
+			return err
+		}
+		rctx, ra := withRetryAfter(ctx)
+		err := fn(rctx)
+		if err == nil {
+			registryRequests.WithLabelValues(reg, op, resultSuccess).Inc()
+			return nil
+		}
+		if attempt >= f.maxRetries || !isRetryable(err) {
+			registryRequests.WithLabelValues(reg, op, resultError).Inc()
+			return err
+		}
+		registryRetries.WithLabelValues(reg, op).Inc()
+
+		delay := backoff
+		if d := ra.get(); d > 0 {
+			delay = d
+			f.pause(reg, d)
+		}
+		if delay > f.maxBackoff {
+			delay = f.maxBackoff
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+		if backoff *= 2; backoff > f.maxBackoff {
+			backoff = f.maxBackoff
+		}
+	}
+}
+
+// wait blocks until a call may be made to the supplied registry.
+func (f *LimitingFetcher) wait(ctx context.Context, reg string) error {
+	f.mu.Lock()
+	rl, ok := f.registries[reg]
+	if !ok {
+		rl = &registryLimiter{limiter: rate.NewLimiter(f.limit, f.burst)}
+		f.registries[reg] = rl
+	}
+	notBefore := rl.notBefore
+	f.mu.Unlock()
+
+	start := time.Now()
+	defer func() {
+		registryWait.WithLabelValues(reg).Observe(time.Since(start).Seconds())
+	}()
+	if err := sleep(ctx, time.Until(notBefore)); err != nil {
+		return err
+	}
+	return rl.limiter.Wait(ctx)
+}
+
+// pause delays all calls to the supplied registry by the supplied duration.
+func (f *LimitingFetcher) pause(reg string, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rl, ok := f.registries[reg]; ok {
+		if t := time.Now().Add(d); t.After(rl.notBefore) {
+			rl.notBefore = t
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// isRetryable returns true if the supplied error indicates that a registry is
+// throttling, temporarily unavailable or could not be reached in time.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		switch terr.StatusCode {
+		case http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+type retryAfterKey struct{}
+
+// A retryAfter records the longest Retry-After duration reported by the
+// responses to the requests of a single call.
+type retryAfter struct {
+	mu sync.Mutex
+	d  time.Duration
+}
+
+func withRetryAfter(ctx context.Context) (context.Context, *retryAfter) {
+	ra := &retryAfter{}
+	return context.WithValue(ctx, retryAfterKey{}, ra), ra
+}
+
+func (ra *retryAfter) get() time.Duration {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	return ra.d
+}
+
+// observeRetryAfter records the Retry-After duration of a throttled or
+// unavailable response with the call whose context the request carries.
+func observeRetryAfter(ctx context.Context, res *http.Response) {
+	if res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+	ra, ok := ctx.Value(retryAfterKey{}).(*retryAfter)
+	if !ok {
+		return
+	}
+	d := parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	if d > ra.d {
+		ra.d = d
+	}
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+)
+
+// blockingFetcher returns tags and descriptors once it is released, unless
+// the context of the call is done first.
+type blockingFetcher struct {
+	Fetcher
+	started   chan struct{}
+	release   chan struct{}
+	cancelled int32
+}
+
+func (b *blockingFetcher) block(ctx context.Context) error {
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		atomic.AddInt32(&b.cancelled, 1)
+		return ctx.Err()
+	}
+}
+
+func (b *blockingFetcher) Tags(ctx context.Context, _ name.Reference, _ ...string) ([]string, error) {
+	if err := b.block(ctx); err != nil {
+		return nil, err
+	}
+	return []string{"v0.1.0"}, nil
+}
+
+func (b *blockingFetcher) Head(ctx context.Context, _ name.Reference, _ ...string) (*v1.Descriptor, error) {
+	if err := b.block(ctx); err != nil {
+		return nil, err
+	}
+	return &v1.Descriptor{Size: 1}, nil
+}
+
+func TestLimitingFetcherSharedCallerCancelled(t *testing.T) {
+	ref, err := name.ParseReference("registry.lab/yndd/nddp-srl:v0.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		reason string
+		call   func(f *LimitingFetcher, ctx context.Context) (interface{}, error)
+		want   interface{}
+	}{
+		"Tags": {
+			reason: "Tags shared with a caller that gave up should still be returned to the other callers.",
+			call: func(f *LimitingFetcher, ctx context.Context) (interface{}, error) {
+				return f.Tags(ctx, ref)
+			},
+			want: []string{"v0.1.0"},
+		},
+		"Head": {
+			reason: "A descriptor shared with a caller that gave up should still be returned to the other callers.",
+			call: func(f *LimitingFetcher, ctx context.Context) (interface{}, error) {
+				return f.Head(ctx, ref)
+			},
+			want: &v1.Descriptor{Size: 1},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := &blockingFetcher{started: make(chan struct{}, 2), release: make(chan struct{})}
+			f := NewLimitingFetcher(b, WithRateLimit(0, 0))
+
+			// The first caller starts the shared call, then gives up.
+			first, cancel := context.WithCancel(context.Background())
+			firstErr := make(chan error, 1)
+			go func() {
+				_, err := tc.call(f, first)
+				firstErr <- err
+			}()
+			<-b.started
+
+			type result struct {
+				v   interface{}
+				err error
+			}
+			second := make(chan result, 1)
+			go func() {
+				v, err := tc.call(f, context.Background())
+				second <- result{v, err}
+			}()
+
+			cancel()
+			if err := <-firstErr; !errors.Is(err, context.Canceled) {
+				t.Errorf("\n%s\nfirst caller: got error %v, want %v", tc.reason, err, context.Canceled)
+			}
+
+			close(b.release)
+			select {
+			case r := <-second:
+				if r.err != nil {
+					t.Fatalf("\n%s\nsecond caller: %v", tc.reason, r.err)
+				}
+				if diff := cmp.Diff(tc.want, r.v); diff != "" {
+					t.Errorf("\n%s\nsecond caller: -want, +got:\n%s", tc.reason, diff)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("\n%s\nsecond caller did not return", tc.reason)
+			}
+			if n := atomic.LoadInt32(&b.cancelled); n != 0 {
+				t.Errorf("\n%s\ngot %d registry calls cancelled by a caller giving up, want none", tc.reason, n)
+			}
+		})
+	}
+}
+
+func TestLimitingFetcherSharedTimeout(t *testing.T) {
+	ref, err := name.ParseReference("registry.lab/yndd/nddp-srl:v0.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &blockingFetcher{started: make(chan struct{}, 1), release: make(chan struct{})}
+	f := NewLimitingFetcher(b, WithRateLimit(0, 0), WithMaxRetries(0), WithSharedTimeout(10*time.Millisecond))
+
+	// A caller without a deadline must not wait for a hanging registry forever.
+	if _, err := f.Tags(context.Background(), ref); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Tags(...): got error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
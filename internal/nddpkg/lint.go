@@ -17,6 +17,8 @@ limitations under the License.
 package nddpkg
 
 import (
+	"fmt"
+
 	"github.com/Masterminds/semver"
 	"github.com/pkg/errors"
 	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
@@ -36,12 +38,34 @@ const (
 	errNotCRD             = "object is not a CRD"
 	errBadConstraints     = "package version constraints are poorly formatted"
 	errNddIncompatibleFmt = "package is not compatible with Ndd version (%s)"
+	errNddRequiredFmt     = "package requires Ndd version %s, but the Ndd version is %s"
 )
 
 // NewProviderLinter is a convenience function for creating a package linter for
-// providers.
-func NewProviderLinter() parser.Linter {
-	return parser.NewPackageLinter(parser.PackageLinterFns(OneMeta), parser.ObjectLinterFns(IsProvider, PackageValidSemver), parser.ObjectLinterFns(IsCRD))
+// providers. Packages must be compatible with the supplied Ndd version.
+func NewProviderLinter(v version.Operations) parser.Linter {
+	return parser.NewPackageLinter(parser.PackageLinterFns(OneMeta), parser.ObjectLinterFns(IsProvider, PackageValidSemver, PackageNddCompatible(v)), parser.ObjectLinterFns(IsCRD))
+}
+
+// NewIntentLinter is a convenience function for creating a package linter for
+// intents. Packages must be compatible with the supplied Ndd version.
+func NewIntentLinter(v version.Operations) parser.Linter {
+	return parser.NewPackageLinter(parser.PackageLinterFns(OneMeta), parser.ObjectLinterFns(IsIntent, PackageValidSemver, PackageNddCompatible(v)), parser.ObjectLinterFns(IsCRD))
+}
+
+type incompatibleError struct {
+	required string
+	actual   string
+}
+
+func (e incompatibleError) Error() string {
+	return fmt.Sprintf(errNddRequiredFmt, e.required, e.actual)
+}
+
+// IsIncompatible returns true if the supplied error indicates that a package
+// is not compatible with the Ndd version.
+func IsIncompatible(err error) bool {
+	return errors.As(err, &incompatibleError{})
 }
 
 // OneMeta checks that there is only one meta object in the package.
@@ -61,16 +85,26 @@ func IsProvider(o runtime.Object) error {
 	return nil
 }
 
+// IsIntent checks that an object is an Intent meta type.
+func IsIntent(o runtime.Object) error {
+	po, _ := TryConvert(o, &pkgmetav1.Intent{})
+	if _, ok := po.(*pkgmetav1.Intent); !ok {
+		return errors.New(errNotMetaIntent)
+	}
+	return nil
+}
+
 // PackageNddCompatible checks that the current Ndd version is
-// compatible with the package constraints.
+// compatible with the package constraints. Development builds that carry no
+// version are compatible with every package.
 func PackageNddCompatible(v version.Operations) parser.ObjectLinterFn {
 	return func(o runtime.Object) error {
-		p, ok := TryConvertToPkg(o, &pkgmetav1.Provider{})
+		p, ok := TryConvertToPkg(o, &pkgmetav1.Provider{}, &pkgmetav1.Intent{})
 		if !ok {
 			return errors.New(errNotMeta)
 		}
 
-		if p.GetNddConstraints() == nil {
+		if p.GetNddConstraints() == nil || v.GetVersionString() == "" {
 			return nil
 		}
 		in, err := v.InConstraints(p.GetNddConstraints().Version)
@@ -78,7 +112,7 @@ func PackageNddCompatible(v version.Operations) parser.ObjectLinterFn {
 			return errors.Wrapf(err, errNddIncompatibleFmt, v.GetVersionString())
 		}
 		if !in {
-			return errors.Errorf(errNddIncompatibleFmt, v.GetVersionString())
+			return incompatibleError{required: p.GetNddConstraints().Version, actual: v.GetVersionString()}
 		}
 		return nil
 	}
@@ -86,7 +120,7 @@ func PackageNddCompatible(v version.Operations) parser.ObjectLinterFn {
 
 // PackageValidSemver checks that the package uses valid semver ranges.
 func PackageValidSemver(o runtime.Object) error {
-	p, ok := TryConvertToPkg(o, &pkgmetav1.Provider{})
+	p, ok := TryConvertToPkg(o, &pkgmetav1.Provider{}, &pkgmetav1.Intent{})
 	if !ok {
 		return errors.New(errNotMeta)
 	}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	cacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ndd_package_cache_size_bytes",
+		Help: "Total size of the package images in the image cache.",
+	})
+	cacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ndd_package_cache_hits_total",
+		Help: "Number of package images retrieved from the image cache.",
+	})
+	cacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ndd_package_cache_misses_total",
+		Help: "Number of package images not found in the image cache.",
+	})
+	cacheHitRatio = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ndd_package_cache_hit_ratio",
+		Help: "Ratio of image cache lookups that were hits.",
+	})
+	corruptImages = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ndd_package_cache_corrupt_images_total",
+		Help: "Number of corrupt package images found in the image cache.",
+	})
+
+	registryRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ndd_package_registry_requests_total",
+		Help: "Number of package registry calls by registry, operation and result, after retries.",
+	}, []string{"registry", "operation", "result"})
+	registryRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ndd_package_registry_retries_total",
+		Help: "Number of package registry calls retried because the registry was throttling or unavailable.",
+	}, []string{"registry", "operation"})
+	registryDeduplicated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ndd_package_registry_deduplicated_total",
+		Help: "Number of package registry calls that shared the result of a concurrent identical call.",
+	}, []string{"registry", "operation"})
+	registryWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ndd_package_registry_rate_limit_wait_seconds",
+		Help:    "Time package registry calls waited for the rate limit of their registry.",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"registry"})
+
+	lookups struct {
+		mu     sync.Mutex
+		hits   float64
+		misses float64
+	}
+)
+
+func init() {
+	metrics.Registry.MustRegister(cacheSize, cacheHits, cacheMisses, cacheHitRatio, corruptImages,
+		registryRequests, registryRetries, registryDeduplicated, registryWait)
+}
+
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+)
+
+func recordLookup(hit bool) {
+	lookups.mu.Lock()
+	defer lookups.mu.Unlock()
+	if hit {
+		cacheHits.Inc()
+		lookups.hits++
+	} else {
+		cacheMisses.Inc()
+		lookups.misses++
+	}
+	cacheHitRatio.Set(lookups.hits / (lookups.hits + lookups.misses))
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	errReadRegistryConfig  = "cannot read registry config"
+	errParseRegistryConfig = "cannot parse registry config"
+	errRewriteRuleFmt      = "invalid rewrite rule %q -> %q"
+	errRewriteRefFmt       = "cannot rewrite %q to %q"
+
+	// wildcardSuffix may end both sides of a rewrite rule, to make explicit
+	// that everything below the prefix is rewritten.
+	wildcardSuffix = "/*"
+)
+
+// A RegistryConfig configures how package and controller images are pulled
+// from registries.
+type RegistryConfig struct {
+	// Mirrors maps a registry, e.g. docker.io, to the location that mirrors
+	// it, e.g. harbor.corp/dockerhub.
+	Mirrors map[string]string `json:"mirrors,omitempty"`
+
+	// Rewrites replace a prefix of an image reference, e.g. ghcr.io/yndd/*
+	// with harbor.corp/yndd-mirror/*. Rewrites take precedence over mirrors.
+	Rewrites []RewriteRule `json:"rewrites,omitempty"`
+
+	// CABundles are paths to PEM encoded CA certificates, or to directories
+	// of them, that are trusted in addition to the system roots.
+	CABundles []string `json:"caBundles,omitempty"`
+
+	// InsecureRegistries may be reached over plain HTTP, or over TLS without
+	// verifying their certificates, e.g. registry.lab:5000.
+	InsecureRegistries []string `json:"insecureRegistries,omitempty"`
+}
+
+// A RewriteRule replaces the From prefix of an image reference with To.
+type RewriteRule struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// LoadRegistryConfig reads a RegistryConfig from the supplied YAML file. A
+// file that does not exist is an empty configuration, such that the file may
+// be mounted from an optional ConfigMap.
+func LoadRegistryConfig(fs afero.Fs, path string) (RegistryConfig, error) {
+	c := RegistryConfig{}
+	if path == "" {
+		return c, nil
+	}
+	b, err := afero.ReadFile(fs, path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, errors.Wrap(err, errReadRegistryConfig)
+	}
+	return c, errors.Wrap(yaml.UnmarshalStrict(b, &c), errParseRegistryConfig)
+}
+
+type rewriteRule struct {
+	from   string
+	to     string
+	mirror bool
+}
+
+// A Rewriter rewrites image references according to the mirrors and rewrite
+// rules of a RegistryConfig. The rule with the longest matching prefix is
+// applied. A nil Rewriter does not rewrite any reference.
+type Rewriter struct {
+	rules []rewriteRule
+}
+
+// NewRewriter returns a Rewriter for the supplied RegistryConfig.
+func NewRewriter(c RegistryConfig) (*Rewriter, error) {
+	r := &Rewriter{}
+	add := func(from, to string, mirror bool) error {
+		f, err := normalizePrefix(from)
+		if err != nil || strings.TrimSpace(to) == "" {
+			return errors.Errorf(errRewriteRuleFmt, from, to)
+		}
+		r.rules = append(r.rules, rewriteRule{from: f, to: strings.TrimSuffix(to, wildcardSuffix), mirror: mirror})
+		return nil
+	}
+	for _, rr := range c.Rewrites {
+		if err := add(rr.From, rr.To, false); err != nil {
+			return nil, err
+		}
+	}
+	registries := make([]string, 0, len(c.Mirrors))
+	for reg := range c.Mirrors {
+		registries = append(registries, reg)
+	}
+	sort.Strings(registries)
+	for _, reg := range registries {
+		if err := add(reg, c.Mirrors[reg], true); err != nil {
+			return nil, err
+		}
+	}
+	// Longest prefix first; rewrites before mirrors of the same prefix.
+	sort.SliceStable(r.rules, func(i, j int) bool {
+		if len(r.rules[i].from) != len(r.rules[j].from) {
+			return len(r.rules[i].from) > len(r.rules[j].from)
+		}
+		return !r.rules[i].mirror && r.rules[j].mirror
+	})
+	return r, nil
+}
+
+// normalizePrefix returns the fully qualified form of a rule prefix, such that
+// e.g. docker.io/library matches index.docker.io/library/nginx.
+func normalizePrefix(prefix string) (string, error) {
+	p := strings.TrimSuffix(strings.TrimSpace(prefix), wildcardSuffix)
+	if p == "" {
+		return "", errors.New("empty prefix")
+	}
+	parts := strings.SplitN(p, "/", 2)
+	reg, err := name.NewRegistry(parts[0])
+	if err != nil {
+		return "", err
+	}
+	if len(parts) == 1 {
+		return reg.RegistryStr(), nil
+	}
+	return reg.RegistryStr() + "/" + parts[1], nil
+}
+
+// Rewrite returns the supplied reference with the matching rule applied, or
+// the reference itself if no rule matches.
+func (r *Rewriter) Rewrite(ref name.Reference) (name.Reference, error) {
+	nr, _, err := r.rewrite(ref)
+	return nr, err
+}
+
+func (r *Rewriter) rewrite(ref name.Reference) (name.Reference, bool, error) {
+	if r == nil {
+		return ref, false, nil
+	}
+	repo := ref.Context().Name()
+	for _, rr := range r.rules {
+		if repo != rr.from && !strings.HasPrefix(repo, rr.from+"/") {
+			continue
+		}
+		rewritten := rr.to + strings.TrimPrefix(repo, rr.from)
+		// The identifier separator is ':' for a tag and '@' for a digest.
+		sep := ":"
+		if _, ok := ref.(name.Digest); ok {
+			sep = "@"
+		}
+		nr, err := name.ParseReference(rewritten + sep + ref.Identifier())
+		if err != nil {
+			return nil, false, errors.Wrapf(err, errRewriteRefFmt, ref.String(), rewritten)
+		}
+		return nr, true, nil
+	}
+	return ref, false, nil
+}
+
+// RewriteImage returns the supplied image with the matching rule applied.
+// Images that cannot be parsed or rewritten are returned unchanged, such that
+// the container runtime reports the problem.
+func (r *Rewriter) RewriteImage(image string) string {
+	if r == nil || image == "" {
+		return image
+	}
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return image
+	}
+	nr, ok, err := r.rewrite(ref)
+	if err != nil || !ok {
+		return image
+	}
+	return nr.Name()
+}
+
+// A RewritingFetcher rewrites package references before passing them to the
+// Fetcher it wraps. References are only rewritten where they are pulled, such
+// that packages keep the identity they were declared with.
+type RewritingFetcher struct {
+	fetcher  Fetcher
+	rewriter *Rewriter
+}
+
+// NewRewritingFetcher returns a Fetcher that rewrites package references using
+// the supplied Rewriter before fetching them with the supplied Fetcher.
+func NewRewritingFetcher(f Fetcher, r *Rewriter) *RewritingFetcher {
+	return &RewritingFetcher{fetcher: f, rewriter: r}
+}
+
+// Fetch fetches a package image from its rewritten reference.
+func (f *RewritingFetcher) Fetch(ctx context.Context, ref name.Reference, secrets ...string) (v1.Image, error) {
+	r, err := f.rewriter.Rewrite(ref)
+	if err != nil {
+		return nil, err
+	}
+	return f.fetcher.Fetch(ctx, r, secrets...)
+}
+
+// Head fetches a package descriptor from its rewritten reference.
+func (f *RewritingFetcher) Head(ctx context.Context, ref name.Reference, secrets ...string) (*v1.Descriptor, error) {
+	r, err := f.rewriter.Rewrite(ref)
+	if err != nil {
+		return nil, err
+	}
+	return f.fetcher.Head(ctx, r, secrets...)
+}
+
+// Tags fetches a package's tags from its rewritten repository.
+func (f *RewritingFetcher) Tags(ctx context.Context, ref name.Reference, secrets ...string) ([]string, error) {
+	r, err := f.rewriter.Rewrite(ref)
+	if err != nil {
+		return nil, err
+	}
+	return f.fetcher.Tags(ctx, r, secrets...)
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SignatureAnnotation is the layer annotation of a signature image that
+	// holds the base64 encoded signature of the layer's payload.
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// SimpleSigningMediaType is the media type of signature image layers
+	// whose payload is a simple signing document.
+	SimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	// signatureTagSuffix is the suffix of the tag signatures are stored at.
+	signatureTagSuffix = ".sig"
+)
+
+const (
+	errDecodePublicKey     = "failed to decode PEM public key"
+	errParsePublicKey      = "failed to parse public key"
+	errUnsupportedKey      = "unsupported public key type"
+	errSignatureManifest   = "failed to get signature manifest"
+	errSignaturePayload    = "failed to read signature payload"
+	errNoTrustedSignature  = "package is not signed by a trusted key"
+	errSignedDigestInvalid = "signature payload does not refer to package digest"
+)
+
+// An UnverifiedError indicates that a package is not signed by a trusted key,
+// as opposed to its signature not being obtainable.
+type UnverifiedError struct {
+	msg string
+}
+
+// Unverified returns an UnverifiedError with the supplied message.
+func Unverified(msg string) error {
+	return &UnverifiedError{msg: msg}
+}
+
+func (e *UnverifiedError) Error() string {
+	return e.msg
+}
+
+// IsUnverified returns true if the supplied error, or any error it wraps, is
+// an UnverifiedError.
+func IsUnverified(err error) bool {
+	var e *UnverifiedError
+	return errors.As(err, &e)
+}
+
+// simpleSigning is the payload that is signed to sign an image.
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// SignatureTag returns the tag the signatures of the image with the supplied
+// digest are stored at in a repository.
+func SignatureTag(repo name.Repository, d v1.Hash) name.Tag {
+	return repo.Tag(fmt.Sprintf("%s-%s%s", d.Algorithm, d.Hex, signatureTagSuffix))
+}
+
+// ParsePublicKey parses a PEM encoded ECDSA, RSA or Ed25519 public key.
+func ParsePublicKey(key string) (crypto.PublicKey, error) {
+	b, _ := pem.Decode([]byte(key))
+	if b == nil {
+		return nil, errors.New(errDecodePublicKey)
+	}
+	pub, err := x509.ParsePKIXPublicKey(b.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, errParsePublicKey)
+	}
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return pub, nil
+	default:
+		return nil, errors.New(errUnsupportedKey)
+	}
+}
+
+// VerifySignature returns nil if the signature image sig carries a signature
+// of the image with digest d that was made by one of the supplied keys. An
+// UnverifiedError is returned if it does not.
+func VerifySignature(sig v1.Image, d v1.Hash, keys []crypto.PublicKey) error {
+	m, err := sig.Manifest()
+	if err != nil {
+		return errors.Wrap(err, errSignatureManifest)
+	}
+	for _, l := range m.Layers {
+		if string(l.MediaType) != SimpleSigningMediaType {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(l.Annotations[SignatureAnnotation])
+		if err != nil || len(signature) == 0 {
+			continue
+		}
+		payload, err := layerPayload(sig, l.Digest)
+		if err != nil {
+			return err
+		}
+		if !verifiedByAny(keys, payload, signature) {
+			continue
+		}
+		ss := &simpleSigning{}
+		if err := json.Unmarshal(payload, ss); err != nil || ss.Critical.Image.DockerManifestDigest != d.String() {
+			return Unverified(errSignedDigestInvalid)
+		}
+		return nil
+	}
+	return Unverified(errNoTrustedSignature)
+}
+
+func layerPayload(img v1.Image, d v1.Hash) ([]byte, error) {
+	l, err := img.LayerByDigest(d)
+	if err != nil {
+		return nil, errors.Wrap(err, errSignaturePayload)
+	}
+	// Signature payloads are stored as is, so the compressed contents of the
+	// layer are the payload.
+	rc, err := l.Compressed()
+	if err != nil {
+		return nil, errors.Wrap(err, errSignaturePayload)
+	}
+	defer func() { _ = rc.Close() }()
+	b, err := ioutil.ReadAll(rc)
+	return b, errors.Wrap(err, errSignaturePayload)
+}
+
+func verifiedByAny(keys []crypto.PublicKey, payload, signature []byte) bool {
+	h := sha256.Sum256(payload)
+	for _, k := range keys {
+		switch pub := k.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(pub, h[:], signature) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(pub, crypto.SHA256, h[:], signature) == nil {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(pub, payload, signature) {
+				return true
+			}
+		}
+	}
+	return false
+}
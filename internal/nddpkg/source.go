@@ -0,0 +1,330 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Package source schemes that do not refer to an OCI image in a registry.
+const (
+	// SourceSchemeFile refers to a compiled package on a local filesystem,
+	// e.g. file:///packages/provider.nddpkg.
+	SourceSchemeFile = "file"
+
+	// SourceSchemeHTTP and SourceSchemeHTTPS refer to a compiled package that
+	// is downloaded from a URL. The URL fragment must carry the sha256
+	// checksum of the package, e.g.
+	// https://example.com/provider.nddpkg#sha256=<hex>.
+	SourceSchemeHTTP  = "http"
+	SourceSchemeHTTPS = "https"
+
+	// SourceSchemeConfigMap and SourceSchemeSecret refer to a package YAML
+	// stream embedded in a ConfigMap or Secret key, e.g.
+	// configmap://<namespace>/<name>/<key>. The object must be in the
+	// namespace ndd runs in, which may be omitted.
+	SourceSchemeConfigMap = "configmap"
+	SourceSchemeSecret    = "secret"
+)
+
+const (
+	errUnknownSourceScheme = "no package source backend for scheme"
+	errOpenPackage         = "failed to open package"
+	errPackageDigest       = "failed to compute package digest"
+	errMissingChecksum     = "package URL must carry a sha256 checksum fragment, e.g. #sha256=<hex>"
+	errChecksumMismatch    = "package checksum does not match"
+	errDownloadPackage     = "failed to download package"
+	errObjectSource        = "package source must be of the form <scheme>://<namespace>/<name>/<key>"
+	errGetPackageObject    = "failed to get object containing package"
+	errObjectNamespace     = "object containing package must be in the namespace ndd runs in"
+	errMissingStreamKey    = "object does not contain package key"
+
+	checksumPrefix = "sha256="
+)
+
+// A SourceBackend fetches packages from a package source that is not an OCI
+// registry.
+type SourceBackend interface {
+	Fetch(ctx context.Context, u *url.URL) (v1.Image, error)
+	Head(ctx context.Context, u *url.URL) (*v1.Descriptor, error)
+}
+
+// Sources fetches packages using the backend registered for the scheme of a
+// package source.
+type Sources map[string]SourceBackend
+
+// NewK8sSources creates the default package source backends. Packages are
+// downloaded using the supplied RegistryTransport, if any.
+func NewK8sSources(client kubernetes.Interface, namespace string, t *RegistryTransport) Sources {
+	h := NewHTTPBackend(t.HTTPClient())
+	return Sources{
+		SourceSchemeFile:      NewFileBackend(afero.NewOsFs()),
+		SourceSchemeHTTP:      h,
+		SourceSchemeHTTPS:     h,
+		SourceSchemeConfigMap: NewConfigMapBackend(client, namespace),
+		SourceSchemeSecret:    NewSecretBackend(client, namespace),
+	}
+}
+
+// ParseSourceURL parses a package source that does not refer to an OCI image
+// in a registry. The returned bool is false for any other source.
+func ParseSourceURL(source string) (*url.URL, bool) {
+	i := strings.Index(source, "://")
+	if i < 0 {
+		return nil, false
+	}
+	switch source[:i] {
+	case SourceSchemeFile, SourceSchemeHTTP, SourceSchemeHTTPS, SourceSchemeConfigMap, SourceSchemeSecret:
+	default:
+		return nil, false
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, false
+	}
+	return u, true
+}
+
+// SourceIdentity returns the package source with any checksum stripped, such
+// that it identifies the package independently of its version.
+func SourceIdentity(u *url.URL) string {
+	c := *u
+	c.Fragment = ""
+	c.RawFragment = ""
+	return c.String()
+}
+
+// Fetch fetches the package at the supplied source.
+func (s Sources) Fetch(ctx context.Context, source string) (v1.Image, error) {
+	u, b, err := s.backend(source)
+	if err != nil {
+		return nil, err
+	}
+	return b.Fetch(ctx, u)
+}
+
+// Head fetches a descriptor of the package at the supplied source.
+func (s Sources) Head(ctx context.Context, source string) (*v1.Descriptor, error) {
+	u, b, err := s.backend(source)
+	if err != nil {
+		return nil, err
+	}
+	return b.Head(ctx, u)
+}
+
+func (s Sources) backend(source string) (*url.URL, SourceBackend, error) {
+	u, ok := ParseSourceURL(source)
+	if !ok {
+		return nil, nil, errors.Errorf("%s: %s", errUnknownSourceScheme, source)
+	}
+	b, ok := s[u.Scheme]
+	if !ok {
+		return nil, nil, errors.Errorf("%s: %s", errUnknownSourceScheme, u.Scheme)
+	}
+	return u, b, nil
+}
+
+// FileBackend fetches compiled packages from a filesystem, such as a volume
+// mounted into the ndd pod.
+type FileBackend struct {
+	fs afero.Fs
+}
+
+// NewFileBackend creates a new FileBackend.
+func NewFileBackend(fs afero.Fs) *FileBackend {
+	return &FileBackend{fs: fs}
+}
+
+// Fetch opens the compiled package at the path of the URL.
+func (f *FileBackend) Fetch(ctx context.Context, u *url.URL) (v1.Image, error) {
+	img, err := tarball.Image(fsOpener(filepath.Clean(u.Path), f.fs), nil)
+	return img, errors.Wrap(err, errOpenPackage)
+}
+
+// Head returns a descriptor of the compiled package at the path of the URL.
+func (f *FileBackend) Head(ctx context.Context, u *url.URL) (*v1.Descriptor, error) {
+	img, err := f.Fetch(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return imageDescriptor(img)
+}
+
+// HTTPBackend downloads compiled packages and verifies their checksum.
+type HTTPBackend struct {
+	client *http.Client
+}
+
+// NewHTTPBackend creates a new HTTPBackend.
+func NewHTTPBackend(c *http.Client) *HTTPBackend {
+	return &HTTPBackend{client: c}
+}
+
+// Fetch downloads the compiled package at the URL and verifies that it matches
+// the checksum in the URL fragment.
+func (h *HTTPBackend) Fetch(ctx context.Context, u *url.URL) (v1.Image, error) {
+	sum, err := checksum(u)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, SourceIdentity(u), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, errDownloadPackage)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, errDownloadPackage)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s: %s", errDownloadPackage, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, errDownloadPackage)
+	}
+	got := sha256.Sum256(b)
+	if hex.EncodeToString(got[:]) != sum {
+		return nil, errors.New(errChecksumMismatch)
+	}
+	img, err := tarball.Image(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}, nil)
+	return img, errors.Wrap(err, errOpenPackage)
+}
+
+// Head returns a descriptor identifying the package by the checksum in the URL
+// fragment, without downloading it.
+func (h *HTTPBackend) Head(ctx context.Context, u *url.URL) (*v1.Descriptor, error) {
+	sum, err := checksum(u)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Descriptor{Digest: v1.Hash{Algorithm: "sha256", Hex: sum}}, nil
+}
+
+func checksum(u *url.URL) (string, error) {
+	if !strings.HasPrefix(u.Fragment, checksumPrefix) {
+		return "", errors.New(errMissingChecksum)
+	}
+	return strings.ToLower(strings.TrimPrefix(u.Fragment, checksumPrefix)), nil
+}
+
+// ObjectBackend builds packages from a package YAML stream embedded in a
+// Kubernetes object.
+type ObjectBackend struct {
+	namespace string
+	get       func(ctx context.Context, namespace, name, key string) ([]byte, bool, error)
+}
+
+// NewConfigMapBackend creates an ObjectBackend that reads package streams from
+// ConfigMaps.
+func NewConfigMapBackend(client kubernetes.Interface, namespace string) *ObjectBackend {
+	return &ObjectBackend{
+		namespace: namespace,
+		get: func(ctx context.Context, namespace, name, key string) ([]byte, bool, error) {
+			cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, false, err
+			}
+			if s, ok := cm.Data[key]; ok {
+				return []byte(s), true, nil
+			}
+			b, ok := cm.BinaryData[key]
+			return b, ok, nil
+		},
+	}
+}
+
+// NewSecretBackend creates an ObjectBackend that reads package streams from
+// Secrets.
+func NewSecretBackend(client kubernetes.Interface, namespace string) *ObjectBackend {
+	return &ObjectBackend{
+		namespace: namespace,
+		get: func(ctx context.Context, namespace, name, key string) ([]byte, bool, error) {
+			s, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, false, err
+			}
+			b, ok := s.Data[key]
+			return b, ok, nil
+		},
+	}
+}
+
+// Fetch builds a package image from the package stream the URL refers to.
+// Objects in other namespaces than the one ndd runs in are never read, since
+// anyone who may install a package could otherwise read them.
+func (o *ObjectBackend) Fetch(ctx context.Context, u *url.URL) (v1.Image, error) {
+	parts := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.New(errObjectSource)
+	}
+	if u.Host != "" && u.Host != o.namespace {
+		return nil, errors.Errorf("%s: %s", errObjectNamespace, u.Host)
+	}
+	b, ok, err := o.get(ctx, o.namespace, parts[0], parts[1])
+	if err != nil {
+		return nil, errors.Wrap(err, errGetPackageObject)
+	}
+	if !ok {
+		return nil, errors.Errorf("%s: %s", errMissingStreamKey, parts[1])
+	}
+	return ImageFromStream(bytes.NewBuffer(b))
+}
+
+// Head returns a descriptor of the package image built from the package
+// stream the URL refers to.
+func (o *ObjectBackend) Head(ctx context.Context, u *url.URL) (*v1.Descriptor, error) {
+	img, err := o.Fetch(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return imageDescriptor(img)
+}
+
+func imageDescriptor(img v1.Image) (*v1.Descriptor, error) {
+	d, err := img.Digest()
+	if err != nil {
+		return nil, errors.Wrap(err, errPackageDigest)
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		return nil, errors.Wrap(err, errPackageDigest)
+	}
+	size, err := img.Size()
+	if err != nil {
+		return nil, errors.Wrap(err, errPackageDigest)
+	}
+	return &v1.Descriptor{Digest: d, MediaType: mt, Size: size}, nil
+}
@@ -0,0 +1,311 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kfake "k8s.io/client-go/kubernetes/fake"
+)
+
+const packageStream = `apiVersion: meta.pkg.ndd.yndd.io/v1
+kind: Provider
+metadata:
+  name: nddp-srl
+`
+
+// compiledPackage returns an image and the compiled package it is written to.
+func compiledPackage(t *testing.T) (v1.Image, []byte) {
+	t.Helper()
+	img := dockerImage(t)
+	buf := &bytes.Buffer{}
+	if err := tarball.Write(nil, img, buf); err != nil {
+		t.Fatal(err)
+	}
+	return img, buf.Bytes()
+}
+
+func configName(t *testing.T, img v1.Image) v1.Hash {
+	t.Helper()
+	h, err := img.ConfigName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestFileBackendFetch(t *testing.T) {
+	img, b := compiledPackage(t)
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/packages/nddp-srl.nddpkg", b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		reason  string
+		source  string
+		wantErr bool
+	}{
+		"Found": {
+			reason: "The compiled package at the path of the URL should be returned.",
+			source: "file:///packages/nddp-srl.nddpkg",
+		},
+		"Unclean": {
+			reason: "The path of the URL should be cleaned.",
+			source: "file:///packages/../packages/./nddp-srl.nddpkg",
+		},
+		"NotFound": {
+			reason:  "A compiled package that does not exist should return an error.",
+			source:  "file:///packages/nddp-ndda.nddpkg",
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := NewFileBackend(fs).Fetch(context.Background(), mustParseURL(t, tc.source))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("\n%s\nFetch(...): error %v, want error %t", tc.reason, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if configName(t, got) != configName(t, img) {
+				t.Errorf("\n%s\nFetch(...): got a different package", tc.reason)
+			}
+		})
+	}
+}
+
+func TestHTTPBackendFetch(t *testing.T) {
+	img, b := compiledPackage(t)
+	sum := sha256.Sum256(b)
+	hexSum := hex.EncodeToString(sum[:])
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nddp-srl.nddpkg" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	// Do not log the handshakes refused by clients that do not trust the
+	// server.
+	s.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	s.StartTLS()
+	defer s.Close()
+	host := mustParseURL(t, s.URL).Host
+
+	// The CA bundle trusting the test server.
+	fs := afero.NewMemMapFs()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	if err := afero.WriteFile(fs, "/etc/ndd/ca/ca.crt", ca, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		reason  string
+		config  RegistryConfig
+		source  string
+		wantErr bool
+	}{
+		"TrustedCA": {
+			reason: "A package served with a certificate issued by a configured CA should be downloaded.",
+			config: RegistryConfig{CABundles: []string{"/etc/ndd/ca"}},
+			source: s.URL + "/nddp-srl.nddpkg#sha256=" + hexSum,
+		},
+		"InsecureHost": {
+			reason: "A package served by an insecure host should be downloaded without verifying its certificate.",
+			config: RegistryConfig{InsecureRegistries: []string{host}},
+			source: s.URL + "/nddp-srl.nddpkg#sha256=" + hexSum,
+		},
+		"UntrustedCA": {
+			reason:  "A package served with a certificate that is not trusted should not be downloaded.",
+			source:  s.URL + "/nddp-srl.nddpkg#sha256=" + hexSum,
+			wantErr: true,
+		},
+		"MissingChecksum": {
+			reason:  "A URL without a checksum should be rejected.",
+			config:  RegistryConfig{CABundles: []string{"/etc/ndd/ca"}},
+			source:  s.URL + "/nddp-srl.nddpkg",
+			wantErr: true,
+		},
+		"ChecksumMismatch": {
+			reason:  "A package that does not match the checksum of its URL should be rejected.",
+			config:  RegistryConfig{CABundles: []string{"/etc/ndd/ca"}},
+			source:  s.URL + "/nddp-srl.nddpkg#sha256=" + hex.EncodeToString(make([]byte, sha256.Size)),
+			wantErr: true,
+		},
+		"NotFound": {
+			reason:  "A package that cannot be downloaded should return an error.",
+			config:  RegistryConfig{CABundles: []string{"/etc/ndd/ca"}},
+			source:  s.URL + "/nddp-ndda.nddpkg#sha256=" + hexSum,
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rt, err := NewRegistryTransport(fs, tc.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := NewHTTPBackend(rt.HTTPClient()).Fetch(context.Background(), mustParseURL(t, tc.source))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("\n%s\nFetch(...): error %v, want error %t", tc.reason, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if configName(t, got) != configName(t, img) {
+				t.Errorf("\n%s\nFetch(...): got a different package", tc.reason)
+			}
+		})
+	}
+}
+
+func TestHTTPBackendHead(t *testing.T) {
+	const sum = "fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf"
+
+	// Head must not download the package, so no server is needed.
+	h := NewHTTPBackend(nil)
+	got, err := h.Head(context.Background(), mustParseURL(t, "https://packages.lab/nddp-srl.nddpkg#sha256="+sum))
+	if err != nil {
+		t.Fatalf("Head(...): %v", err)
+	}
+	if want := (v1.Hash{Algorithm: "sha256", Hex: sum}); got.Digest != want {
+		t.Errorf("Head(...): got digest %s, want %s", got.Digest, want)
+	}
+	if _, err := h.Head(context.Background(), mustParseURL(t, "https://packages.lab/nddp-srl.nddpkg")); err == nil {
+		t.Errorf("Head(...): want error for a URL without a checksum")
+	}
+}
+
+func TestObjectBackendFetch(t *testing.T) {
+	want, err := ImageFromStream(bytes.NewBufferString(packageStream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := kfake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "nddp-srl", Namespace: "ndd-system"},
+			Data:       map[string]string{"package.yaml": packageStream},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "nddp-srl-binary", Namespace: "ndd-system"},
+			BinaryData: map[string][]byte{"package.yaml": []byte(packageStream)},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "nddp-srl", Namespace: "tenant"},
+			Data:       map[string][]byte{"package.yaml": []byte(packageStream)},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "nddp-srl", Namespace: "ndd-system"},
+			Data:       map[string][]byte{"package.yaml": []byte(packageStream)},
+		},
+	)
+	cm := NewConfigMapBackend(client, "ndd-system")
+	secret := NewSecretBackend(client, "ndd-system")
+
+	cases := map[string]struct {
+		reason  string
+		backend *ObjectBackend
+		source  string
+		wantErr bool
+	}{
+		"ConfigMap": {
+			reason:  "A package stream in a ConfigMap in the namespace of the URL should be built into a package.",
+			backend: cm,
+			source:  "configmap://ndd-system/nddp-srl/package.yaml",
+		},
+		"ConfigMapBinaryData": {
+			reason:  "A package stream in the binary data of a ConfigMap should be built into a package.",
+			backend: cm,
+			source:  "configmap://ndd-system/nddp-srl-binary/package.yaml",
+		},
+		"DefaultNamespace": {
+			reason:  "A URL without a namespace should refer to the namespace ndd runs in.",
+			backend: cm,
+			source:  "configmap:///nddp-srl/package.yaml",
+		},
+		"Secret": {
+			reason:  "A package stream in a Secret should be built into a package.",
+			backend: secret,
+			source:  "secret://ndd-system/nddp-srl/package.yaml",
+		},
+		"MissingKey": {
+			reason:  "An object without the key of the URL should return an error.",
+			backend: cm,
+			source:  "configmap://ndd-system/nddp-srl/other.yaml",
+			wantErr: true,
+		},
+		"MissingObject": {
+			reason:  "An object that does not exist should return an error.",
+			backend: secret,
+			source:  "secret://ndd-system/nddp-ndda/package.yaml",
+			wantErr: true,
+		},
+		"OtherNamespace": {
+			reason:  "An object in another namespace than the one ndd runs in should never be read.",
+			backend: secret,
+			source:  "secret://tenant/nddp-srl/package.yaml",
+			wantErr: true,
+		},
+		"InvalidPath": {
+			reason:  "A URL that does not name an object and key should be rejected.",
+			backend: cm,
+			source:  "configmap://ndd-system/nddp-srl",
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.backend.Fetch(context.Background(), mustParseURL(t, tc.source))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("\n%s\nFetch(...): error %v, want error %t", tc.reason, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if digest(t, got) != digest(t, want) {
+				t.Errorf("\n%s\nFetch(...): got package %s, want %s", tc.reason, digest(t, got), digest(t, want))
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const (
+	errSystemCertPool    = "cannot load system certificate pool"
+	errReadCABundleFmt   = "cannot read CA bundle %s"
+	errNoCertificatesFmt = "CA bundle %s contains no PEM encoded certificates"
+	errInsecureRegFmt    = "invalid insecure registry %q"
+)
+
+// A RegistryTransport connects to registries. It trusts the system roots and
+// any extra CA bundles, and reaches insecure registries over plain HTTP or
+// over TLS without verifying their certificates.
+type RegistryTransport struct {
+	secure   http.RoundTripper
+	insecure http.RoundTripper
+
+	// registries that may be reached insecurely, by registry host.
+	registries map[string]bool
+}
+
+// NewRegistryTransport returns a RegistryTransport for the CA bundles and
+// insecure registries of the supplied RegistryConfig. A CA bundle may be a
+// PEM file or a directory of PEM files, such as a mounted ConfigMap. CA
+// bundles that do not exist are ignored, such that they may be mounted from an
+// optional ConfigMap.
+func NewRegistryTransport(fs afero.Fs, c RegistryConfig) (*RegistryTransport, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, errors.Wrap(err, errSystemCertPool)
+	}
+	for _, path := range c.CABundles {
+		if err := appendCABundle(fs, roots, path); err != nil {
+			return nil, err
+		}
+	}
+
+	t := &RegistryTransport{registries: map[string]bool{}}
+	for _, r := range c.InsecureRegistries {
+		reg, err := name.NewRegistry(strings.TrimSpace(r))
+		if err != nil {
+			return nil, errors.Wrapf(err, errInsecureRegFmt, r)
+		}
+		t.registries[reg.RegistryStr()] = true
+	}
+
+	secure := remote.DefaultTransport.Clone()
+	secure.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	insecure := remote.DefaultTransport.Clone()
+	insecure.TLSClientConfig = &tls.Config{RootCAs: roots, InsecureSkipVerify: true} // nolint:gosec
+	t.secure, t.insecure = secure, insecure
+	return t, nil
+}
+
+func appendCABundle(fs afero.Fs, pool *x509.CertPool, path string) error {
+	fi, err := fs.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, errReadCABundleFmt, path)
+	}
+	files := []string{path}
+	if fi.IsDir() {
+		infos, err := afero.ReadDir(fs, path)
+		if err != nil {
+			return errors.Wrapf(err, errReadCABundleFmt, path)
+		}
+		files = files[:0]
+		for _, i := range infos {
+			// Skip the hidden data directories of mounted ConfigMaps.
+			if i.IsDir() || strings.HasPrefix(i.Name(), ".") {
+				continue
+			}
+			files = append(files, filepath.Join(path, i.Name()))
+		}
+	}
+	for _, f := range files {
+		pem, err := afero.ReadFile(fs, f)
+		if err != nil {
+			return errors.Wrapf(err, errReadCABundleFmt, f)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.Errorf(errNoCertificatesFmt, f)
+		}
+	}
+	return nil
+}
+
+// RoundTrip sends requests to insecure registries without verifying their
+// certificates, and all other requests with verification. The Retry-After
+// duration of a throttled response is reported to a LimitingFetcher.
+func (t *RegistryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt := t.secure
+	if t.registries[req.URL.Host] {
+		rt = t.insecure
+	}
+	res, err := rt.RoundTrip(req)
+	if err == nil {
+		observeRetryAfter(req.Context(), res)
+	}
+	return res, err
+}
+
+// Reference returns the supplied reference, marked as insecure if its registry
+// may be reached insecurely such that it is tried over plain HTTP.
+func (t *RegistryTransport) Reference(ref name.Reference) (name.Reference, error) {
+	if t == nil || !t.registries[ref.Context().RegistryStr()] {
+		return ref, nil
+	}
+	return name.ParseReference(ref.String(), name.Insecure)
+}
+
+// Options returns the remote options that connect using the RegistryTransport.
+// A nil RegistryTransport returns no options, i.e. the remote defaults.
+func (t *RegistryTransport) Options() []remote.Option {
+	if t == nil {
+		return nil
+	}
+	return []remote.Option{remote.WithTransport(t)}
+}
+
+// HTTPClient returns an HTTP client that connects using the RegistryTransport,
+// such that packages downloaded from HTTP servers trust the same CA bundles
+// and insecure hosts as registries. A nil RegistryTransport returns the
+// default client.
+func (t *RegistryTransport) HTTPClient() *http.Client {
+	if t == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: t}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// UploadPath is the path under which package images are uploaded. The
+	// name of the package follows it, e.g. /packages/nddp-srl.
+	UploadPath = "/packages/"
+
+	// DefaultMaxUploadSize is the default maximum size of an uploaded
+	// package image.
+	DefaultMaxUploadSize = 100 << 20
+
+	// UploadTokenHeader is the header an uploaded package image must carry
+	// the upload token in. The Authorization header cannot be used, since the
+	// API server service proxy does not pass it on.
+	UploadTokenHeader = "X-Ndd-Upload-Token"
+
+	errUploadMethod       = "package images must be uploaded with PUT"
+	errUploadUnauthorized = "invalid package upload token"
+	errUploadName         = "invalid package name"
+	errUploadTooLarge     = "package image exceeds the maximum upload size"
+	errUploadRead         = "cannot read uploaded package image"
+	errUploadInvalid      = "uploaded package image is not a valid image tarball"
+	errUploadImport       = "cannot import package image"
+	errUploadServe        = "cannot serve package uploads"
+)
+
+// An Importer imports package images that cannot be fetched from a registry.
+type Importer interface {
+	Import(id string, img v1.Image) error
+}
+
+// An UploadResult is returned for a successfully uploaded package image.
+type UploadResult struct {
+	// Source is the source a package must use, together with a
+	// PackagePullPolicy of Never, to install the uploaded package image.
+	Source string `json:"source"`
+
+	// Digest of the uploaded package image.
+	Digest string `json:"digest"`
+}
+
+// UploadHandlerOption configures an UploadHandler.
+type UploadHandlerOption func(*UploadHandler)
+
+// WithMaxUploadSize bounds the size of an uploaded package image.
+func WithMaxUploadSize(bytes int64) UploadHandlerOption {
+	return func(h *UploadHandler) {
+		h.maxSize = bytes
+	}
+}
+
+// WithUploadToken requires uploaded package images to carry the supplied
+// token in the UploadTokenHeader. An UploadHandler without a token rejects all
+// uploads.
+func WithUploadToken(token string) UploadHandlerOption {
+	return func(h *UploadHandler) {
+		h.token = token
+	}
+}
+
+// WithUploadLogger specifies how the UploadHandler should log messages.
+func WithUploadLogger(l logging.Logger) UploadHandlerOption {
+	return func(h *UploadHandler) {
+		h.log = l
+	}
+}
+
+// An UploadHandler imports package image tarballs, as written by kubectl ndd
+// package build, that are PUT to UploadPath followed by the package name. The
+// image is imported under an id derived from the package name and the image
+// digest, such that an upload never replaces a different image. Only uploads
+// that carry the upload token are imported.
+type UploadHandler struct {
+	importer Importer
+	token    string
+	maxSize  int64
+	log      logging.Logger
+}
+
+// NewUploadHandler returns an UploadHandler that imports package images using
+// the supplied Importer.
+func NewUploadHandler(i Importer, o ...UploadHandlerOption) *UploadHandler {
+	h := &UploadHandler{
+		importer: i,
+		maxSize:  DefaultMaxUploadSize,
+		log:      logging.NewNopLogger(),
+	}
+	for _, fn := range o {
+		fn(h)
+	}
+	return h
+}
+
+// ServeHTTP imports an uploaded package image.
+func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, errUploadMethod, http.StatusMethodNotAllowed)
+		return
+	}
+	if h.token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(UploadTokenHeader)), []byte(h.token)) != 1 {
+		http.Error(w, errUploadUnauthorized, http.StatusUnauthorized)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, UploadPath)
+	if name == r.URL.Path || len(validation.IsDNS1123Label(name)) > 0 {
+		http.Error(w, errUploadName, http.StatusBadRequest)
+		return
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, h.maxSize+1))
+	if err != nil {
+		http.Error(w, errUploadRead, http.StatusBadRequest)
+		return
+	}
+	if int64(len(b)) > h.maxSize {
+		http.Error(w, errUploadTooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+	img, err := tarball.Image(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}, nil)
+	if err == nil {
+		err = validate.Image(img)
+	}
+	if err != nil {
+		http.Error(w, errors.Wrap(err, errUploadInvalid).Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := img.Digest()
+	if err != nil {
+		http.Error(w, errors.Wrap(err, errUploadInvalid).Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := UploadResult{Source: FriendlyID(name, d.Hex), Digest: d.String()}
+	if err := h.importer.Import(res.Source, img); err != nil {
+		h.log.Info(errUploadImport, "name", name, "error", err)
+		http.Error(w, errUploadImport, http.StatusInternalServerError)
+		return
+	}
+	h.log.Debug("Imported package image", "name", name, "source", res.Source, "digest", res.Digest)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// An UploadServer serves an UploadHandler until its context is cancelled.
+type UploadServer struct {
+	server *http.Server
+}
+
+// NewUploadServer returns an UploadServer that serves the supplied handler on
+// the supplied address.
+func NewUploadServer(addr string, h *UploadHandler) *UploadServer {
+	mux := http.NewServeMux()
+	mux.Handle(UploadPath, h)
+	return &UploadServer{server: newServer(addr, mux)}
+}
+
+// Start serves package uploads until the supplied context is cancelled.
+func (s *UploadServer) Start(ctx context.Context) error {
+	return serve(ctx, s.server, errUploadServe)
+}
+
+func newServer(addr string, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// serve serves the supplied server until the supplied context is cancelled.
+func serve(ctx context.Context, s *http.Server, msg string) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return errors.Wrap(err, msg)
+	case <-ctx.Done():
+		sctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return s.Shutdown(sctx)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+type importerFn func(id string, img v1.Image) error
+
+func (fn importerFn) Import(id string, img v1.Image) error { return fn(id, img) }
+
+func TestUploadHandler(t *testing.T) {
+	img := dockerImage(t)
+	buf := &bytes.Buffer{}
+	if err := tarball.Write(nil, img, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		reason   string
+		token    string
+		header   string
+		want     int
+		imported bool
+	}{
+		"NoToken": {
+			reason: "An UploadHandler without a token should reject all uploads.",
+			want:   http.StatusUnauthorized,
+		},
+		"MissingToken": {
+			reason: "An upload without the token should be rejected.",
+			token:  "secret",
+			want:   http.StatusUnauthorized,
+		},
+		"WrongToken": {
+			reason: "An upload with a different token should be rejected.",
+			token:  "secret",
+			header: "guess",
+			want:   http.StatusUnauthorized,
+		},
+		"Authorized": {
+			reason:   "An upload with the token should be imported.",
+			token:    "secret",
+			header:   "secret",
+			want:     http.StatusCreated,
+			imported: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			imported := false
+			h := NewUploadHandler(importerFn(func(string, v1.Image) error {
+				imported = true
+				return nil
+			}), WithUploadToken(tc.token))
+
+			r := httptest.NewRequest(http.MethodPut, UploadPath+"pkg", bytes.NewReader(buf.Bytes()))
+			if tc.header != "" {
+				r.Header.Set(UploadTokenHeader, tc.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.want {
+				t.Errorf("\n%s\nServeHTTP(...): got status %d, want %d: %s", tc.reason, w.Code, tc.want, w.Body.String())
+			}
+			if imported != tc.imported {
+				t.Errorf("\n%s\nServeHTTP(...): imported %t, want %t", tc.reason, imported, tc.imported)
+			}
+		})
+	}
+}
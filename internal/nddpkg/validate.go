@@ -0,0 +1,480 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	extv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+	"github.com/yndd/ndd-core/internal/version"
+	"github.com/yndd/ndd-runtime/pkg/parser"
+)
+
+const (
+	errReadDocuments = "cannot read YAML documents"
+
+	errNoPodFmt             = "%s package does not define a controller pod"
+	errNoContainers         = "pod does not define any containers"
+	errNoContainerFmt       = "container %d does not define a container"
+	errNoContainerNameFmt   = "container %d has no name"
+	errNoContainerImageFmt  = "container %s has no image"
+	errContainerPortFmt     = "container %s port %d is out of range 1-65535"
+	errDeploymentTypeFmt    = "pod type %q must be one of statefulset or deployment"
+	errReplicasFmt          = "pod replicas %d exceed the maximum of %d replicas"
+	errExtraNoNameFmt       = "container %s has an extra without a name"
+	errExtraDuplicateFmt    = "extra %q of container %s is also defined by container %s"
+	errExtraPortFmt         = "extra %q %s %d is out of range 1-65535"
+	errExtraProtocolFmt     = "extra %q protocol %q must be one of TCP, UDP or SCTP"
+	errDependencyPackageFmt = "dependency %q is not a valid package reference"
+	errDependencyTypeFmt    = "dependency %q has unknown package type %q"
+	errDependencyConstrFmt  = "dependency %q has invalid version constraints %q"
+	errCRDNoSchemaFmt       = "version %s has no OpenAPI v3 schema"
+	errCRDSchemaFmt         = "version %s schema cannot be converted: %s"
+	errCRDStructuralFmt     = "version %s schema is not structural: %s"
+	errNoVerbsFmt           = "permission request %d has no verbs"
+	warnWildcardFmt         = "permission request %d grants all %s"
+	warnSensitiveFmt        = "permission request %d grants access to %s"
+	warnEscalatingVerbFmt   = "permission request %d grants the %q verb, which allows privilege escalation"
+	warnNonResourceURLsFmt  = "permission request %d grants access to non-resource URLs %s"
+)
+
+// Validation rules.
+const (
+	RuleParse        = "parse"
+	RuleOneMeta      = "one-meta"
+	RuleMetaType     = "meta-type"
+	RuleSemver       = "semver"
+	RuleCompatible   = "ndd-compatible"
+	RuleDependencies = "dependencies"
+	RulePod          = "pod"
+	RulePermissions  = "permissions"
+	RuleCRD          = "crd"
+	RuleCRDSchema    = "crd-schema"
+)
+
+// A Severity indicates how serious a Finding is.
+type Severity string
+
+// Finding severities.
+const (
+	// SeverityError findings prevent a package from being built or installed.
+	SeverityError Severity = "error"
+
+	// SeverityWarning findings should be reviewed, but do not prevent a
+	// package from being built or installed.
+	SeverityWarning Severity = "warning"
+)
+
+// A Location identifies an object in a package.
+type Location struct {
+	// File the object was read from.
+	File string `json:"file,omitempty"`
+
+	// Document is the index of the YAML document in the file, starting at 1.
+	Document int `json:"document,omitempty"`
+
+	// Object is the kind and name of the object, e.g. Provider/ndd-provider.
+	Object string `json:"object,omitempty"`
+}
+
+// String returns a human readable location.
+func (l Location) String() string {
+	s := l.File
+	if l.Document > 0 {
+		s = fmt.Sprintf("%s#%d", s, l.Document)
+	}
+	if l.Object != "" {
+		if s != "" {
+			s += " "
+		}
+		s += l.Object
+	}
+	return s
+}
+
+// A Finding is a problem found while validating a package.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+	Location
+	Message string `json:"message"`
+}
+
+// A Document is a single YAML document of a package.
+type Document struct {
+	Location
+	Data []byte
+}
+
+// ReadDocuments splits the supplied YAML stream of the supplied file into its
+// documents.
+func ReadDocuments(file string, r io.Reader) ([]Document, error) {
+	yr := yaml.NewYAMLReader(bufio.NewReader(r))
+	docs := []Document{}
+	for i := 1; ; i++ {
+		b, err := yr.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, errReadDocuments)
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		docs = append(docs, Document{Location: Location{File: file, Document: i}, Data: b})
+	}
+}
+
+// A Validator validates packages. Unlike a parser.Linter it does not stop at
+// the first problem, but reports every finding with its location.
+type Validator struct {
+	parser    parser.Parser
+	versioner version.Operations
+}
+
+// NewValidator returns a Validator that parses package documents with the
+// supplied parser. Packages must be compatible with the supplied Ndd version.
+func NewValidator(p parser.Parser, v version.Operations) *Validator {
+	return &Validator{parser: p, versioner: v}
+}
+
+type located struct {
+	Location
+	obj runtime.Object
+}
+
+// Validate the package made up of the supplied documents.
+func (v *Validator) Validate(ctx context.Context, docs []Document) []Finding {
+	findings := []Finding{}
+	metas := []located{}
+	objs := []located{}
+	for _, d := range docs {
+		pkg, err := v.parser.Parse(ctx, ioutil.NopCloser(bytes.NewReader(d.Data)))
+		if err != nil {
+			findings = append(findings, Finding{Severity: SeverityError, Rule: RuleParse, Location: d.Location, Message: err.Error()})
+			continue
+		}
+		for _, o := range pkg.GetMeta() {
+			metas = append(metas, located{Location: locate(d.Location, o), obj: o})
+		}
+		for _, o := range pkg.GetObjects() {
+			objs = append(objs, located{Location: locate(d.Location, o), obj: o})
+		}
+	}
+
+	if len(metas) != 1 {
+		findings = append(findings, Finding{Severity: SeverityError, Rule: RuleOneMeta, Message: fmt.Sprintf("%s, found %d", errNotExactlyOneMeta, len(metas))})
+	}
+	for _, m := range metas {
+		findings = append(findings, v.validateMeta(m)...)
+	}
+	for _, o := range objs {
+		findings = append(findings, validateObject(o)...)
+	}
+	return findings
+}
+
+func (v *Validator) validateMeta(m located) []Finding {
+	findings := []Finding{}
+	add := func(s Severity, rule string, err error) {
+		if err != nil {
+			findings = append(findings, Finding{Severity: s, Rule: rule, Location: m.Location, Message: err.Error()})
+		}
+	}
+	if IsProvider(m.obj) != nil && IsIntent(m.obj) != nil {
+		add(SeverityError, RuleMetaType, errors.New(errNotMeta))
+		return findings
+	}
+	// Compatibility cannot be checked against poorly formatted constraints.
+	if err := PackageValidSemver(m.obj); err != nil {
+		add(SeverityError, RuleSemver, err)
+	} else {
+		add(SeverityError, RuleCompatible, PackageNddCompatible(v.versioner)(m.obj))
+	}
+
+	p, _ := TryConvertToPkg(m.obj, &pkgmetav1.Provider{}, &pkgmetav1.Intent{})
+	for _, err := range validateDependencies(p.GetDependencies()) {
+		add(SeverityError, RuleDependencies, err)
+	}
+
+	pod, kind := podOf(m.obj)
+	if pod == nil {
+		add(SeverityError, RulePod, errors.Errorf(errNoPodFmt, kind))
+		return findings
+	}
+	for _, err := range validatePod(pod) {
+		add(SeverityError, RulePod, err)
+	}
+	errs, warns := reviewPermissions(pod.PermissionRequests)
+	for _, err := range errs {
+		add(SeverityError, RulePermissions, err)
+	}
+	for _, err := range warns {
+		add(SeverityWarning, RulePermissions, err)
+	}
+	return findings
+}
+
+func validateObject(o located) []Finding {
+	findings := []Finding{}
+	add := func(rule string, err error) {
+		findings = append(findings, Finding{Severity: SeverityError, Rule: rule, Location: o.Location, Message: err.Error()})
+	}
+	if err := IsCRD(o.obj); err != nil {
+		add(RuleCRD, err)
+		return findings
+	}
+	for _, err := range validateCRDSchemas(o.obj) {
+		add(RuleCRDSchema, err)
+	}
+	return findings
+}
+
+// locate adds the kind and name of the supplied object to the supplied
+// location.
+func locate(l Location, o runtime.Object) Location {
+	kind := o.GetObjectKind().GroupVersionKind().Kind
+	if a, err := meta.Accessor(o); err == nil && a.GetName() != "" {
+		kind += "/" + a.GetName()
+	}
+	l.Object = kind
+	return l
+}
+
+// podOf returns the controller pod of the supplied package meta and the kind
+// of the package.
+func podOf(o runtime.Object) (*pkgmetav1.PodSpec, string) {
+	switch m := o.(type) {
+	case *pkgmetav1.Provider:
+		return m.Spec.Pod, pkgmetav1.ProviderKind
+	case *pkgmetav1.Intent:
+		return m.Spec.Pod, pkgmetav1.IntentKind
+	}
+	return nil, o.GetObjectKind().GroupVersionKind().Kind
+}
+
+func validateDependencies(deps []pkgmetav1.Dependency) []error {
+	errs := []error{}
+	for _, d := range deps {
+		if _, err := name.ParseReference(d.Package); err != nil {
+			errs = append(errs, errors.Errorf(errDependencyPackageFmt, d.Package))
+		}
+		switch d.Type {
+		case "", pkgmetav1.ProviderPackageType, pkgmetav1.IntentPackageType:
+		default:
+			errs = append(errs, errors.Errorf(errDependencyTypeFmt, d.Package, d.Type))
+		}
+		if _, err := ParseConstraint(d.Constraints); err != nil {
+			errs = append(errs, errors.Errorf(errDependencyConstrFmt, d.Package, d.Constraints))
+		}
+	}
+	return errs
+}
+
+func validatePod(pod *pkgmetav1.PodSpec) []error { // nolint:gocyclo
+	errs := []error{}
+	switch pod.Type {
+	case "", pkgmetav1.DeploymentTypeDeployment, pkgmetav1.DeploymentTypeStatefulset:
+	default:
+		errs = append(errs, errors.Errorf(errDeploymentTypeFmt, pod.Type))
+	}
+	if pod.Replicas != nil && pod.MaxReplicas != nil && *pod.Replicas > *pod.MaxReplicas {
+		errs = append(errs, errors.Errorf(errReplicasFmt, *pod.Replicas, *pod.MaxReplicas))
+	}
+	if len(pod.Containers) == 0 {
+		errs = append(errs, errors.New(errNoContainers))
+	}
+
+	// Extras are rendered into objects named after them, so their names must
+	// be unique across the containers of the pod.
+	extras := map[string]string{}
+	for i, c := range pod.Containers {
+		if c == nil || c.Container == nil {
+			errs = append(errs, errors.Errorf(errNoContainerFmt, i))
+			continue
+		}
+		cname := c.Container.Name
+		if cname == "" {
+			errs = append(errs, errors.Errorf(errNoContainerNameFmt, i))
+			cname = fmt.Sprintf("%d", i)
+		}
+		if c.Container.Image == "" {
+			errs = append(errs, errors.Errorf(errNoContainerImageFmt, cname))
+		}
+		for _, p := range c.Container.Ports {
+			if !validPort(int64(p.ContainerPort)) {
+				errs = append(errs, errors.Errorf(errContainerPortFmt, cname, p.ContainerPort))
+			}
+		}
+		for _, e := range c.Extras {
+			if e == nil || e.Name == "" {
+				errs = append(errs, errors.Errorf(errExtraNoNameFmt, cname))
+				continue
+			}
+			if other, ok := extras[e.Name]; ok {
+				errs = append(errs, errors.Errorf(errExtraDuplicateFmt, e.Name, cname, other))
+			}
+			extras[e.Name] = cname
+			if e.Port != 0 && !validPort(int64(e.Port)) {
+				errs = append(errs, errors.Errorf(errExtraPortFmt, e.Name, "port", e.Port))
+			}
+			if e.TargetPort != 0 && !validPort(int64(e.TargetPort)) {
+				errs = append(errs, errors.Errorf(errExtraPortFmt, e.Name, "targetPort", e.TargetPort))
+			}
+			switch corev1.Protocol(e.Protocol) {
+			case "", corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+			default:
+				errs = append(errs, errors.Errorf(errExtraProtocolFmt, e.Name, e.Protocol))
+			}
+		}
+	}
+	return errs
+}
+
+func validPort(p int64) bool {
+	return p >= 1 && p <= 65535
+}
+
+// sensitiveResources are resources that a package should only request access
+// to if it really needs to.
+var sensitiveResources = map[string]bool{
+	"secrets":               true,
+	"clusterroles":          true,
+	"clusterrolebindings":   true,
+	"roles":                 true,
+	"rolebindings":          true,
+	"serviceaccounts/token": true,
+}
+
+// escalatingVerbs allow a subject to gain permissions it was not granted.
+var escalatingVerbs = map[string]bool{
+	"escalate":    true,
+	"bind":        true,
+	"impersonate": true,
+}
+
+// reviewPermissions returns the permission requests that are invalid, and the
+// ones that are valid but grant broad or sensitive access.
+func reviewPermissions(rules []rbacv1.PolicyRule) (errs, warns []error) {
+	for i, r := range rules {
+		if len(r.Verbs) == 0 {
+			errs = append(errs, errors.Errorf(errNoVerbsFmt, i))
+		}
+		for _, f := range []struct {
+			what   string
+			values []string
+		}{
+			{what: "API groups", values: r.APIGroups},
+			{what: "resources", values: r.Resources},
+			{what: "verbs", values: r.Verbs},
+		} {
+			for _, v := range f.values {
+				if v == rbacv1.ResourceAll {
+					warns = append(warns, errors.Errorf(warnWildcardFmt, i, f.what))
+					break
+				}
+			}
+		}
+		sensitive := []string{}
+		for _, res := range r.Resources {
+			if sensitiveResources[res] {
+				sensitive = append(sensitive, res)
+			}
+		}
+		if len(sensitive) > 0 {
+			warns = append(warns, errors.Errorf(warnSensitiveFmt, i, strings.Join(sensitive, ", ")))
+		}
+		for _, v := range r.Verbs {
+			if escalatingVerbs[v] {
+				warns = append(warns, errors.Errorf(warnEscalatingVerbFmt, i, v))
+			}
+		}
+		if len(r.NonResourceURLs) > 0 {
+			warns = append(warns, errors.Errorf(warnNonResourceURLsFmt, i, strings.Join(r.NonResourceURLs, ", ")))
+		}
+	}
+	return errs, warns
+}
+
+// validateCRDSchemas checks that every version of the supplied CRD has a
+// structural schema, as required by apiextensions.k8s.io/v1.
+func validateCRDSchemas(o runtime.Object) []error {
+	errs := []error{}
+	check := func(version string, s *apiextensions.JSONSchemaProps) {
+		ss, err := schema.NewStructural(s)
+		if err != nil {
+			errs = append(errs, errors.Errorf(errCRDStructuralFmt, version, err))
+			return
+		}
+		for _, e := range schema.ValidateStructural(field.NewPath("spec", "versions").Key(version).Child("schema", "openAPIV3Schema"), ss) {
+			errs = append(errs, errors.Errorf(errCRDStructuralFmt, version, e))
+		}
+	}
+	switch crd := o.(type) {
+	case *extv1.CustomResourceDefinition:
+		for _, ver := range crd.Spec.Versions {
+			if ver.Schema == nil || ver.Schema.OpenAPIV3Schema == nil {
+				errs = append(errs, errors.Errorf(errCRDNoSchemaFmt, ver.Name))
+				continue
+			}
+			s := &apiextensions.JSONSchemaProps{}
+			if err := extv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(ver.Schema.OpenAPIV3Schema, s, nil); err != nil {
+				errs = append(errs, errors.Errorf(errCRDSchemaFmt, ver.Name, err))
+				continue
+			}
+			check(ver.Name, s)
+		}
+	case *extv1beta1.CustomResourceDefinition:
+		for _, ver := range crd.Spec.Versions {
+			v := crd.Spec.Validation
+			if ver.Schema != nil {
+				v = ver.Schema
+			}
+			if v == nil || v.OpenAPIV3Schema == nil {
+				errs = append(errs, errors.Errorf(errCRDNoSchemaFmt, ver.Name))
+				continue
+			}
+			s := &apiextensions.JSONSchemaProps{}
+			if err := extv1beta1.Convert_v1beta1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(v.OpenAPIV3Schema, s, nil); err != nil {
+				errs = append(errs, errors.Errorf(errCRDSchemaFmt, ver.Name, err))
+				continue
+			}
+			check(ver.Name, s)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,359 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+)
+
+const (
+	// WebhookPath is the path registries send push notifications to.
+	WebhookPath = "/registry/events"
+
+	maxWebhookSize = 1 << 20
+
+	errWebhookMethod       = "registry notifications must be sent with POST"
+	errWebhookUnauthorized = "invalid registry notification credentials"
+	errWebhookRead         = "cannot read registry notification"
+	errWebhookFormat       = "unknown registry notification format"
+	errWebhookParse        = "cannot parse registry notification"
+	errWebhookNotify       = "cannot process registry notification"
+	errWebhookServe        = "cannot serve registry notifications"
+
+	headerGitHubEvent     = "X-GitHub-Event"
+	headerGitHubSignature = "X-Hub-Signature-256"
+)
+
+// A PushEvent reports that an image was pushed to a registry.
+type PushEvent struct {
+	// Repository the image was pushed to, fully qualified, e.g.
+	// ghcr.io/yndd/nddp-srl.
+	Repository string `json:"repository"`
+
+	// Tag the image was pushed with. Empty if the image was pushed by
+	// digest only.
+	Tag string `json:"tag,omitempty"`
+
+	// Digest of the pushed image.
+	Digest string `json:"digest,omitempty"`
+}
+
+// A PushNotifier is notified of images pushed to registries.
+type PushNotifier interface {
+	Notify(ctx context.Context, events []PushEvent) error
+}
+
+// ParsePushEvents parses a registry notification in the Docker distribution,
+// Harbor or GitHub package event format into the images it reports as
+// pushed. Notifications of anything other than pushed images, e.g. pulls or
+// deletions, contain no PushEvents.
+func ParsePushEvents(h http.Header, body []byte) ([]PushEvent, error) {
+	if e := h.Get(headerGitHubEvent); e != "" {
+		if e != "package" && e != "registry_package" {
+			return nil, nil
+		}
+		return parseGitHubEvent(body)
+	}
+	var probe struct {
+		Events    json.RawMessage `json:"events"`
+		Type      string          `json:"type"`
+		EventData json.RawMessage `json:"event_data"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return nil, errors.Wrap(err, errWebhookParse)
+	}
+	switch {
+	case probe.Events != nil:
+		return parseDistributionEvents(body)
+	case probe.Type != "" && probe.EventData != nil:
+		return parseHarborEvent(body)
+	}
+	return nil, errors.New(errWebhookFormat)
+}
+
+type distributionEnvelope struct {
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			MediaType  string `json:"mediaType"`
+			Digest     string `json:"digest"`
+			Repository string `json:"repository"`
+			URL        string `json:"url"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+}
+
+// parseDistributionEvents parses the notifications of a Docker distribution
+// registry, which also reports pushed blobs.
+func parseDistributionEvents(body []byte) ([]PushEvent, error) {
+	env := &distributionEnvelope{}
+	if err := json.Unmarshal(body, env); err != nil {
+		return nil, errors.Wrap(err, errWebhookParse)
+	}
+	events := []PushEvent{}
+	for _, e := range env.Events {
+		if e.Action != "push" || !isManifest(e.Target.MediaType) {
+			continue
+		}
+		// The target URL is the registry's own view of its host, which the
+		// request host may differ from behind a proxy.
+		host := e.Request.Host
+		if u, err := url.Parse(e.Target.URL); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		repo, err := name.NewRepository(host + "/" + e.Target.Repository)
+		if err != nil {
+			return nil, errors.Wrap(err, errWebhookParse)
+		}
+		events = append(events, PushEvent{Repository: repo.Name(), Tag: e.Target.Tag, Digest: e.Target.Digest})
+	}
+	return events, nil
+}
+
+func isManifest(mediaType string) bool {
+	return strings.Contains(mediaType, "manifest") || strings.Contains(mediaType, "image.index")
+}
+
+type harborEvent struct {
+	Type      string `json:"type"`
+	EventData struct {
+		Resources []struct {
+			Digest      string `json:"digest"`
+			Tag         string `json:"tag"`
+			ResourceURL string `json:"resource_url"`
+		} `json:"resources"`
+	} `json:"event_data"`
+}
+
+// parseHarborEvent parses a Harbor webhook notification.
+func parseHarborEvent(body []byte) ([]PushEvent, error) {
+	he := &harborEvent{}
+	if err := json.Unmarshal(body, he); err != nil {
+		return nil, errors.Wrap(err, errWebhookParse)
+	}
+	if he.Type != "PUSH_ARTIFACT" && he.Type != "pushImage" {
+		return nil, nil
+	}
+	events := make([]PushEvent, 0, len(he.EventData.Resources))
+	for _, r := range he.EventData.Resources {
+		ref, err := name.ParseReference(r.ResourceURL)
+		if err != nil {
+			return nil, errors.Wrap(err, errWebhookParse)
+		}
+		events = append(events, PushEvent{Repository: ref.Context().Name(), Tag: r.Tag, Digest: r.Digest})
+	}
+	return events, nil
+}
+
+type gitHubPackage struct {
+	Name        string `json:"name"`
+	PackageType string `json:"package_type"`
+	Owner       struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	PackageVersion struct {
+		Version           string `json:"version"`
+		PackageURL        string `json:"package_url"`
+		ContainerMetadata struct {
+			Tag struct {
+				Name   string `json:"name"`
+				Digest string `json:"digest"`
+			} `json:"tag"`
+		} `json:"container_metadata"`
+	} `json:"package_version"`
+}
+
+type gitHubEvent struct {
+	Action          string         `json:"action"`
+	Package         *gitHubPackage `json:"package"`
+	RegistryPackage *gitHubPackage `json:"registry_package"`
+}
+
+// parseGitHubEvent parses a GitHub package or registry_package webhook
+// notification, as sent for images pushed to GHCR.
+func parseGitHubEvent(body []byte) ([]PushEvent, error) {
+	ge := &gitHubEvent{}
+	if err := json.Unmarshal(body, ge); err != nil {
+		return nil, errors.Wrap(err, errWebhookParse)
+	}
+	p := ge.Package
+	if p == nil {
+		p = ge.RegistryPackage
+	}
+	if p == nil || ge.Action != "published" || !strings.EqualFold(p.PackageType, "container") {
+		return nil, nil
+	}
+
+	tag := p.PackageVersion.ContainerMetadata.Tag
+	digest := tag.Digest
+	if digest == "" {
+		digest = p.PackageVersion.Version
+	}
+	// The package URL ends in a colon if the version has no tag.
+	repo := strings.TrimSuffix(p.PackageVersion.PackageURL, ":")
+	if repo == "" {
+		repo = "ghcr.io/" + p.Owner.Login + "/" + p.Name
+	}
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	r, err := name.NewRepository(strings.ToLower(repo))
+	if err != nil {
+		return nil, errors.Wrap(err, errWebhookParse)
+	}
+	return []PushEvent{{Repository: r.Name(), Tag: tag.Name, Digest: digest}}, nil
+}
+
+// WebhookHandlerOption configures a WebhookHandler.
+type WebhookHandlerOption func(*WebhookHandler)
+
+// WithWebhookSecret requires notifications to carry the supplied secret,
+// either as an Authorization header, optionally as a bearer token, or as the
+// key of a GitHub X-Hub-Signature-256 signature.
+func WithWebhookSecret(secret string) WebhookHandlerOption {
+	return func(h *WebhookHandler) {
+		h.secret = secret
+	}
+}
+
+// WithWebhookInsecure accepts notifications without credentials if no secret
+// is specified. Anyone who can reach the handler can then trigger package
+// reconciles.
+func WithWebhookInsecure() WebhookHandlerOption {
+	return func(h *WebhookHandler) {
+		h.insecure = true
+	}
+}
+
+// WithWebhookLogger specifies how the WebhookHandler should log messages.
+func WithWebhookLogger(l logging.Logger) WebhookHandlerOption {
+	return func(h *WebhookHandler) {
+		h.log = l
+	}
+}
+
+// A WebhookHandler passes the images pushed according to the registry
+// notifications POSTed to it to a PushNotifier. It responds with the
+// PushEvents it parsed, such that recorded notifications can be replayed to
+// verify how they are understood.
+type WebhookHandler struct {
+	notifier PushNotifier
+	secret   string
+	insecure bool
+	log      logging.Logger
+}
+
+// NewWebhookHandler returns a WebhookHandler that notifies the supplied
+// PushNotifier. Notifications are refused unless a secret is specified or the
+// handler is explicitly insecure.
+func NewWebhookHandler(n PushNotifier, o ...WebhookHandlerOption) *WebhookHandler {
+	h := &WebhookHandler{
+		notifier: n,
+		log:      logging.NewNopLogger(),
+	}
+	for _, fn := range o {
+		fn(h)
+	}
+	return h
+}
+
+// ServeHTTP handles a registry notification.
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, errWebhookMethod, http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, errWebhookRead, http.StatusBadRequest)
+		return
+	}
+	if !h.authorized(r.Header, body) {
+		http.Error(w, errWebhookUnauthorized, http.StatusUnauthorized)
+		return
+	}
+	events, err := ParsePushEvents(r.Header, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(events) > 0 {
+		if err := h.notifier.Notify(r.Context(), events); err != nil {
+			h.log.Info(errWebhookNotify, "error", err)
+			http.Error(w, errWebhookNotify, http.StatusInternalServerError)
+			return
+		}
+	}
+	h.log.Debug("Received registry notification", "events", events)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(struct {
+		Events []PushEvent `json:"events"`
+	}{Events: events})
+}
+
+func (h *WebhookHandler) authorized(hdr http.Header, body []byte) bool {
+	if h.secret == "" {
+		return h.insecure
+	}
+	if sig := hdr.Get(headerGitHubSignature); sig != "" {
+		mac := hmac.New(sha256.New, []byte(h.secret))
+		_, _ = mac.Write(body)
+		want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(sig), []byte(want))
+	}
+	auth := strings.TrimPrefix(hdr.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(auth), []byte(h.secret)) == 1
+}
+
+// A WebhookServer serves a WebhookHandler until its context is cancelled.
+type WebhookServer struct {
+	server *http.Server
+}
+
+// NewWebhookServer returns a WebhookServer that serves the supplied handler on
+// the supplied address.
+func NewWebhookServer(addr string, h *WebhookHandler) *WebhookServer {
+	mux := http.NewServeMux()
+	mux.Handle(WebhookPath, h)
+	return &WebhookServer{server: newServer(addr, mux)}
+}
+
+// Start serves registry notifications until the supplied context is
+// cancelled.
+func (s *WebhookServer) Start(ctx context.Context) error {
+	return serve(ctx, s.server, errWebhookServe)
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nddpkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParsePushEvents(t *testing.T) {
+	const digest = "sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf"
+
+	type args struct {
+		event string
+		file  string
+		body  string
+	}
+	cases := map[string]struct {
+		reason  string
+		args    args
+		want    []PushEvent
+		wantErr bool
+	}{
+		"Distribution": {
+			reason: "Only pushed manifests should be reported, on the host of the registry's own URL rather than the request host.",
+			args:   args{file: "distribution.json"},
+			want:   []PushEvent{{Repository: "registry.lab:5000/yndd/nddp-srl", Tag: "v0.1.0", Digest: digest}},
+		},
+		"DistributionIndex": {
+			reason: "A pushed OCI image index should be reported like a manifest.",
+			args:   args{file: "distribution_oci_index.json"},
+			want: []PushEvent{{
+				Repository: "10.1.2.3:5000/nddp-srl",
+				Tag:        "latest",
+				Digest:     "sha256:3c1b4b1f0b4c1f4b6e9d6b3a7c1e0f8d9a2b4c6d8e0f1a3b5c7d9e1f3a5b7c9d",
+			}},
+		},
+		"HarborPush": {
+			reason: "A Harbor artifact push should be reported on the repository of its resource URL.",
+			args:   args{file: "harbor_push.json"},
+			want:   []PushEvent{{Repository: "harbor.lab/yndd/nddp-srl", Tag: "v0.1.0", Digest: digest}},
+		},
+		"HarborPull": {
+			reason: "A Harbor artifact pull should not be reported.",
+			args:   args{file: "harbor_pull.json"},
+		},
+		"GHCRPackage": {
+			reason: "A published GHCR container package should be reported with its tag.",
+			args:   args{event: "package", file: "ghcr_package_published.json"},
+			want:   []PushEvent{{Repository: "ghcr.io/yndd/nddp-srl", Tag: "v0.1.0", Digest: digest}},
+		},
+		"GHCRRegistryPackageUntagged": {
+			reason: "An untagged GHCR registry package should be reported without a tag, by its version digest.",
+			args:   args{event: "registry_package", file: "ghcr_registry_package_untagged.json"},
+			want: []PushEvent{{
+				Repository: "ghcr.io/yndd/nddp-srl",
+				Digest:     "sha256:2d8c1b7a9f3e5d6c4b2a1f0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c",
+			}},
+		},
+		"GitHubPing": {
+			reason: "GitHub events other than package events should not be reported.",
+			args:   args{event: "ping", body: `{"zen":"Keep it logically awesome.","hook_id":1}`},
+		},
+		"UnknownFormat": {
+			reason:  "A notification in an unknown format should be rejected.",
+			args:    args{body: `{"action":"push"}`},
+			wantErr: true,
+		},
+		"InvalidJSON": {
+			reason:  "A notification that is not JSON should be rejected.",
+			args:    args{body: `events`},
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			body := []byte(tc.args.body)
+			if tc.args.file != "" {
+				b, err := ioutil.ReadFile(filepath.Join("testdata", "webhook", tc.args.file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = b
+			}
+			h := http.Header{}
+			if tc.args.event != "" {
+				h.Set(headerGitHubEvent, tc.args.event)
+			}
+
+			got, err := ParsePushEvents(h, body)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("\n%s\nParsePushEvents(...): error %v, want error %t", tc.reason, err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("\n%s\nParsePushEvents(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+type notifierFn func(ctx context.Context, events []PushEvent) error
+
+func (fn notifierFn) Notify(ctx context.Context, events []PushEvent) error { return fn(ctx, events) }
+
+func TestWebhookHandlerAuthorization(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "webhook", "harbor_push.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		_, _ = mac.Write(body)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	cases := map[string]struct {
+		reason   string
+		o        []WebhookHandlerOption
+		header   http.Header
+		want     int
+		notified bool
+	}{
+		"NoSecret": {
+			reason: "A WebhookHandler without a secret should reject all notifications.",
+			header: http.Header{"Authorization": []string{"Bearer secret"}},
+			want:   http.StatusUnauthorized,
+		},
+		"Insecure": {
+			reason:   "An insecure WebhookHandler without a secret should accept notifications without credentials.",
+			o:        []WebhookHandlerOption{WithWebhookInsecure()},
+			header:   http.Header{},
+			want:     http.StatusAccepted,
+			notified: true,
+		},
+		"MissingSecret": {
+			reason: "A notification without the secret should be rejected.",
+			o:      []WebhookHandlerOption{WithWebhookSecret("secret")},
+			header: http.Header{},
+			want:   http.StatusUnauthorized,
+		},
+		"WrongSecret": {
+			reason: "A notification with a different secret should be rejected.",
+			o:      []WebhookHandlerOption{WithWebhookSecret("secret")},
+			header: http.Header{"Authorization": []string{"Bearer guess"}},
+			want:   http.StatusUnauthorized,
+		},
+		"Bearer": {
+			reason:   "A notification with the secret as a bearer token should be accepted.",
+			o:        []WebhookHandlerOption{WithWebhookSecret("secret")},
+			header:   http.Header{"Authorization": []string{"Bearer secret"}},
+			want:     http.StatusAccepted,
+			notified: true,
+		},
+		"Authorization": {
+			reason:   "A notification with the secret as its Authorization header should be accepted.",
+			o:        []WebhookHandlerOption{WithWebhookSecret("secret")},
+			header:   http.Header{"Authorization": []string{"secret"}},
+			want:     http.StatusAccepted,
+			notified: true,
+		},
+		"GitHubSignature": {
+			reason:   "A notification signed with the secret should be accepted.",
+			o:        []WebhookHandlerOption{WithWebhookSecret("secret")},
+			header:   http.Header{headerGitHubSignature: []string{sign("secret")}},
+			want:     http.StatusAccepted,
+			notified: true,
+		},
+		"WrongGitHubSignature": {
+			reason: "A notification signed with a different secret should be rejected.",
+			o:      []WebhookHandlerOption{WithWebhookSecret("secret")},
+			header: http.Header{headerGitHubSignature: []string{sign("guess")}},
+			want:   http.StatusUnauthorized,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			notified := false
+			n := notifierFn(func(_ context.Context, _ []PushEvent) error {
+				notified = true
+				return nil
+			})
+			r := httptest.NewRequest(http.MethodPost, WebhookPath, bytes.NewReader(body))
+			r.Header = tc.header
+			w := httptest.NewRecorder()
+
+			NewWebhookHandler(n, tc.o...).ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Errorf("\n%s\nServeHTTP(...): got status %d, want %d", tc.reason, w.Code, tc.want)
+			}
+			if notified != tc.notified {
+				t.Errorf("\n%s\nServeHTTP(...): notified %t, want %t", tc.reason, notified, tc.notified)
+			}
+		})
+	}
+}
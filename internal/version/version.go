@@ -41,6 +41,14 @@ func New() *Versioner {
 	}
 }
 
+// NewVersioner creates a new versioner for the supplied version rather than
+// the current Ndd version.
+func NewVersioner(v string) *Versioner {
+	return &Versioner{
+		version: v,
+	}
+}
+
 // GetVersionString returns the current Ndd version as string.
 func (v *Versioner) GetVersionString() string {
 	return v.version